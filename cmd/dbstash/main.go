@@ -3,24 +3,40 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/urfave/cli/v3"
+	"github.com/viperadnan-git/dbstash/internal/binlog"
+	"github.com/viperadnan-git/dbstash/internal/catalog"
 	"github.com/viperadnan-git/dbstash/internal/config"
 	"github.com/viperadnan-git/dbstash/internal/engine"
 	"github.com/viperadnan-git/dbstash/internal/health"
 	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/manifest"
+	"github.com/viperadnan-git/dbstash/internal/notify"
+	"github.com/viperadnan-git/dbstash/internal/oplog"
 	"github.com/viperadnan-git/dbstash/internal/pipeline"
+	"github.com/viperadnan-git/dbstash/internal/preflight"
+	"github.com/viperadnan-git/dbstash/internal/restore"
 	"github.com/viperadnan-git/dbstash/internal/scheduler"
+	"github.com/viperadnan-git/dbstash/internal/tunnel"
+	"github.com/viperadnan-git/dbstash/internal/wal"
 )
 
 var version = "dev"
 
 func main() {
+	manifest.Version = version
+
 	app := &cli.Command{
 		Name:    "dbstash",
 		Usage:   "Database backup via rclone",
@@ -39,6 +55,7 @@ func main() {
 			engineCommand("mysql", "MySQL backup"),
 			engineCommand("mariadb", "MariaDB backup"),
 			engineCommand("redis", "Redis backup"),
+			engineCommand("sqlite", "SQLite backup"),
 		},
 	}
 
@@ -59,6 +76,63 @@ func engineCommand(engineKey, usage string) *cli.Command {
 			Sources: cli.EnvVars("DB_AUTH_SOURCE"),
 		})
 	}
+	if engineKey == "mongo" {
+		flags = append(flags, &cli.BoolFlag{
+			Name:    "backup-oplog",
+			Usage:   "Dump with --oplog for a consistent point in time and record the oplog position (requires --backup-all-databases)",
+			Sources: cli.EnvVars("BACKUP_OPLOG"),
+		})
+	}
+	if engineKey == "mysql" || engineKey == "mariadb" {
+		flags = append(flags, &cli.BoolFlag{
+			Name:    "backup-binlog-position",
+			Usage:   "Record the binlog position of each dump for binlog replay (stream/file mode)",
+			Sources: cli.EnvVars("BACKUP_BINLOG_POSITION"),
+		}, &cli.StringFlag{
+			Name:    "dump-tool",
+			Usage:   "Dump tool: mysqldump, mariadb-dump, mysqlpump (stream/file), or mydumper (directory/tar); restores use the matching loader",
+			Sources: cli.EnvVars("DUMP_TOOL"),
+		})
+	}
+	if engineKey == "redis" {
+		flags = append(flags, &cli.StringFlag{
+			Name:    "redis-sentinel-master",
+			Usage:   "Look up this master through the Sentinel at --db-uri/--db-host and back it up",
+			Sources: cli.EnvVars("REDIS_SENTINEL_MASTER"),
+		}, &cli.StringFlag{
+			Name:    "redis-sentinel-role",
+			Usage:   "Server to back up with --redis-sentinel-master: master or replica",
+			Value:   "master",
+			Sources: cli.EnvVars("REDIS_SENTINEL_ROLE"),
+		}, &cli.BoolFlag{
+			Name:    "redis-cluster",
+			Usage:   "Back up every master shard of the cluster --db-uri/--db-host belongs to, one object per shard",
+			Sources: cli.EnvVars("REDIS_CLUSTER"),
+		})
+	}
+	if engineKey == "sqlite" {
+		flags = append(flags, &cli.StringFlag{
+			Name:    "db-path",
+			Usage:   "Path to the SQLite database file",
+			Sources: cli.EnvVars("DB_PATH"),
+		})
+	}
+
+	commands := []*cli.Command{
+		restoreCommand(engineKey),
+		listCommand(engineKey),
+		verifyCommand(engineKey),
+		drillCommand(engineKey),
+	}
+	if engineKey == "pg" {
+		commands = append(commands, walCommands()...)
+	}
+	if engineKey == "mysql" || engineKey == "mariadb" {
+		commands = append(commands, binlogCommands(engineKey)...)
+	}
+	if engineKey == "mongo" {
+		commands = append(commands, oplogCommands()...)
+	}
 
 	return &cli.Command{
 		Name:  engineKey,
@@ -71,6 +145,423 @@ func engineCommand(engineKey, usage string) *cli.Command {
 			}
 			return run(cfg)
 		},
+		Commands: commands,
+	}
+}
+
+// restoreCommand creates the "restore" subcommand for the given engine. It
+// inherits the engine's connection and rclone flags.
+func restoreCommand(engineKey string) *cli.Command {
+	flags := []cli.Flag{
+		&cli.StringFlag{
+			Name:     "from",
+			Usage:    "Backup to restore: name relative to --rclone-remote or a full rclone path",
+			Required: true,
+			Sources:  cli.EnvVars("RESTORE_FROM"),
+		},
+	}
+	if engineKey != "redis" {
+		flags = append(flags,
+			&cli.StringFlag{
+				Name:    "target-db",
+				Usage:   "Restore into this database instead of the configured one (must exist)",
+				Sources: cli.EnvVars("RESTORE_TARGET_DB"),
+			},
+			&cli.BoolFlag{
+				Name:    "clean",
+				Usage:   "Drop existing objects before restoring them",
+				Sources: cli.EnvVars("RESTORE_CLEAN"),
+			},
+			&cli.IntFlag{
+				Name:    "jobs",
+				Usage:   "Parallel restore workers where the tool supports them (0 = tool default)",
+				Sources: cli.EnvVars("RESTORE_JOBS"),
+			},
+		)
+	}
+	if engineKey == "pg" || engineKey == "mysql" || engineKey == "mariadb" {
+		flags = append(flags, &cli.StringFlag{
+			Name:    "data-dir",
+			Usage:   "Empty data directory a physical backup is extracted into (server stopped)",
+			Sources: cli.EnvVars("RESTORE_DATA_DIR"),
+		})
+	}
+	if engineKey == "mysql" || engineKey == "mariadb" || engineKey == "mongo" {
+		archived := "binlogs"
+		if engineKey == "mongo" {
+			archived = "oplog"
+		}
+		flags = append(flags, &cli.StringFlag{
+			Name:    "until",
+			Usage:   "After restoring, replay the archived " + archived + " up to this time (RFC 3339 or YYYY-MM-DD; \"latest\" = all)",
+			Sources: cli.EnvVars("RESTORE_UNTIL"),
+		})
+	}
+	if engineKey == "redis" {
+		flags = append(flags, &cli.StringFlag{
+			Name:     "rdb-path",
+			Usage:    "Destination path of the staged RDB file (e.g. /data/dump.rdb)",
+			Required: true,
+			Sources:  cli.EnvVars("RESTORE_RDB_PATH"),
+		})
+	}
+
+	return &cli.Command{
+		Name:  "restore",
+		Usage: "Restore a backup from the remote into the database",
+		Flags: flags,
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			cfg, err := configFromCLI(engineKey, cmd)
+			if err != nil {
+				return fmt.Errorf("configuration error: %s", err)
+			}
+			opts := restore.Options{
+				From:     cmd.String("from"),
+				RDBPath:  cmd.String("rdb-path"),
+				DataDir:  cmd.String("data-dir"),
+				TargetDB: cmd.String("target-db"),
+				Clean:    cmd.Bool("clean"),
+				Jobs:     int(cmd.Int("jobs")),
+			}
+			return runRestore(ctx, cfg, opts, cmd.String("until"))
+		},
+	}
+}
+
+// listCommand creates the "list" subcommand that prints the backup catalog
+// for the given engine. Only the rclone flags are required.
+func listCommand(engineKey string) *cli.Command {
+	return &cli.Command{
+		Name:  "list",
+		Usage: "List backups on the remote",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "output",
+				Usage: "Output format: table or json",
+				Value: "table",
+			},
+			&cli.StringFlag{
+				Name:  "sort",
+				Usage: "Sort by: time (newest first), name, or size (largest first)",
+				Value: "time",
+			},
+			&cli.BoolFlag{
+				Name:  "reverse",
+				Usage: "Reverse the sort order",
+			},
+			&cli.StringFlag{
+				Name:  "since",
+				Usage: "Only backups modified at or after this date (YYYY-MM-DD or RFC 3339)",
+			},
+			&cli.StringFlag{
+				Name:  "until",
+				Usage: "Only backups modified at or before this date (YYYY-MM-DD or RFC 3339)",
+			},
+			&cli.StringFlag{
+				Name:  "database",
+				Usage: "Only backups of this database",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			cfg, err := readCLIConfig(engineKey, cmd)
+			if err != nil {
+				return fmt.Errorf("configuration error: %s", err)
+			}
+			if err := cfg.PrepareCatalog(); err != nil {
+				return fmt.Errorf("configuration error: %s", err)
+			}
+			return runList(ctx, cfg, cmd)
+		},
+	}
+}
+
+// verifyCommand creates the "verify" subcommand that downloads a backup and
+// checks it without restoring. Like list, it needs only the rclone flags.
+func verifyCommand(engineKey string) *cli.Command {
+	return &cli.Command{
+		Name:  "verify",
+		Usage: "Download a backup and check that it is intact",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "from",
+				Usage:   "Backup to verify: name relative to --rclone-remote or a full rclone path (default: newest)",
+				Sources: cli.EnvVars("VERIFY_FROM"),
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			cfg, err := readCLIConfig(engineKey, cmd)
+			if err != nil {
+				return fmt.Errorf("configuration error: %s", err)
+			}
+			if err := cfg.PrepareCatalog(); err != nil {
+				return fmt.Errorf("configuration error: %s", err)
+			}
+			return runVerify(ctx, cfg, cmd.String("from"))
+		},
+	}
+}
+
+// drillCommand creates the "drill" subcommand that runs a single restore
+// drill into --drill-target-db.
+func drillCommand(engineKey string) *cli.Command {
+	return &cli.Command{
+		Name:  "drill",
+		Usage: "Restore the newest backup into the scratch database and run the sanity queries",
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			cfg, err := configFromCLI(engineKey, cmd)
+			if err != nil {
+				return fmt.Errorf("configuration error: %s", err)
+			}
+			if err := cfg.ValidateDrill(); err != nil {
+				return fmt.Errorf("configuration error: %s", err)
+			}
+			logger.Init(cfg.LogLevel, cfg.LogFormat)
+
+			eng, err := engine.New(cfg.Engine)
+			if err != nil {
+				return fmt.Errorf("failed to initialize engine: %w", err)
+			}
+			return scheduler.RunDrill(ctx, cfg, eng, nil)
+		},
+	}
+}
+
+// walCommands creates the PostgreSQL WAL archiving subcommands: wal-push
+// and wal-fetch for archive_command and restore_command, wal-receive for
+// a long-running pg_receivewal, and recovery-config for point-in-time
+// recovery. Apart from wal-receive they need only the rclone flags.
+func walCommands() []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:      "wal-push",
+			Usage:     "Archive a WAL file (archive_command = 'dbstash pg wal-push %p')",
+			ArgsUsage: "<path>",
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				if cmd.NArg() != 1 {
+					return fmt.Errorf("usage: wal-push <path>")
+				}
+				cfg, err := walConfig(cmd)
+				if err != nil {
+					return err
+				}
+				return wal.Push(ctx, cfg, cmd.Args().First())
+			},
+		},
+		{
+			Name:      "wal-fetch",
+			Usage:     "Fetch an archived WAL file (restore_command = 'dbstash pg wal-fetch %f %p')",
+			ArgsUsage: "<name> <destination>",
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				if cmd.NArg() != 2 {
+					return fmt.Errorf("usage: wal-fetch <name> <destination>")
+				}
+				cfg, err := walConfig(cmd)
+				if err != nil {
+					return err
+				}
+				return wal.Fetch(ctx, cfg, cmd.Args().Get(0), cmd.Args().Get(1))
+			},
+		},
+		{
+			Name:  "wal-receive",
+			Usage: "Stream WAL with pg_receivewal and archive every completed segment",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "spool-dir",
+					Usage:   "Directory pg_receivewal writes to before segments are shipped (default: <backup-temp-dir>/wal-spool)",
+					Sources: cli.EnvVars("WAL_SPOOL_DIR"),
+				},
+				&cli.StringFlag{
+					Name:    "slot",
+					Usage:   "Replication slot to stream from, created if missing",
+					Sources: cli.EnvVars("WAL_SLOT"),
+				},
+			},
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				cfg, err := walConfig(cmd)
+				if err != nil {
+					return err
+				}
+				if cfg.DBURI == "" && cfg.DBHost == "" {
+					return fmt.Errorf("configuration error: either DB_URI (or DB_URI_FILE) or DB_HOST must be set")
+				}
+				opts := wal.ReceiveOptions{
+					SpoolDir: cmd.String("spool-dir"),
+					Slot:     cmd.String("slot"),
+				}
+				if opts.SpoolDir == "" {
+					opts.SpoolDir = filepath.Join(cfg.BackupTempDir, "wal-spool")
+				}
+
+				// Reach the database through the SSH bastion while receiving
+				t, cfg, err := tunnel.Open(cfg)
+				if err != nil {
+					return err
+				}
+				defer t.Close()
+
+				ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+				defer stop()
+				return wal.Receive(ctx, cfg, opts)
+			},
+		},
+		{
+			Name:  "recovery-config",
+			Usage: "Print the base backup and recovery settings for point-in-time recovery",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "target-time",
+					Usage: "Recover up to this time (RFC 3339 or YYYY-MM-DD; default: all archived WAL)",
+				},
+			},
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				cfg, err := walConfig(cmd)
+				if err != nil {
+					return err
+				}
+				return runRecoveryConfig(ctx, cfg, cmd.String("target-time"))
+			},
+		},
+	}
+}
+
+// walConfig reads and validates the config for the WAL subcommands.
+func walConfig(cmd *cli.Command) (*config.Config, error) {
+	cfg, err := readCLIConfig("pg", cmd)
+	if err != nil {
+		return nil, fmt.Errorf("configuration error: %s", err)
+	}
+	if err := cfg.PrepareCatalog(); err != nil {
+		return nil, fmt.Errorf("configuration error: %s", err)
+	}
+	logger.Init(cfg.LogLevel, cfg.LogFormat)
+	return cfg, nil
+}
+
+// binlogCommands creates the MySQL/MariaDB binlog archiving subcommands.
+// binlog-receive copies binlogs from the server with mysqlbinlog and
+// archives every closed one; restore --until replays them.
+func binlogCommands(engineKey string) []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:  "binlog-receive",
+			Usage: "Stream binlogs with mysqlbinlog and archive every closed binlog",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "spool-dir",
+					Usage:   "Directory mysqlbinlog writes to before binlogs are shipped (default: <backup-temp-dir>/binlog-spool)",
+					Sources: cli.EnvVars("BINLOG_SPOOL_DIR"),
+				},
+				&cli.StringFlag{
+					Name:    "start-file",
+					Usage:   "Binlog to start from when nothing is spooled (default: newest archived, then the newest dump's)",
+					Sources: cli.EnvVars("BINLOG_START_FILE"),
+				},
+				&cli.StringFlag{
+					Name:    "flush-interval",
+					Usage:   "Run FLUSH BINARY LOGS this often so the current binlog is archived (e.g. 15m; 0 = only on server rotation)",
+					Value:   "0",
+					Sources: cli.EnvVars("BINLOG_FLUSH_INTERVAL"),
+				},
+			},
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				cfg, err := readCLIConfig(engineKey, cmd)
+				if err != nil {
+					return fmt.Errorf("configuration error: %s", err)
+				}
+				if err := cfg.PrepareCatalog(); err != nil {
+					return fmt.Errorf("configuration error: %s", err)
+				}
+				if cfg.DBURI == "" && cfg.DBHost == "" {
+					return fmt.Errorf("configuration error: either DB_URI (or DB_URI_FILE) or DB_HOST must be set")
+				}
+				logger.Init(cfg.LogLevel, cfg.LogFormat)
+
+				opts := binlog.ReceiveOptions{
+					SpoolDir:  cmd.String("spool-dir"),
+					StartFile: cmd.String("start-file"),
+				}
+				if opts.SpoolDir == "" {
+					opts.SpoolDir = filepath.Join(cfg.BackupTempDir, "binlog-spool")
+				}
+				if s := cmd.String("flush-interval"); s != "0" && s != "" {
+					if opts.FlushInterval, err = time.ParseDuration(s); err != nil {
+						return fmt.Errorf("invalid --flush-interval %q: %w", s, err)
+					}
+				}
+
+				eng, err := engine.New(cfg.Engine)
+				if err != nil {
+					return fmt.Errorf("failed to initialize engine: %w", err)
+				}
+
+				// Reach the database through the SSH bastion while receiving
+				t, cfg, err := tunnel.Open(cfg)
+				if err != nil {
+					return err
+				}
+				defer t.Close()
+
+				ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+				defer stop()
+				return binlog.Receive(ctx, cfg, eng, opts)
+			},
+		},
+	}
+}
+
+// oplogCommands creates the MongoDB oplog archiving subcommands.
+// oplog-receive tails local.oplog.rs and archives it in slices; restore
+// --until replays them.
+func oplogCommands() []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:  "oplog-receive",
+			Usage: "Tail the oplog and archive it in slices",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "interval",
+					Usage:   "How often a new oplog slice is cut and archived (e.g. 1m, 15m)",
+					Value:   "1m",
+					Sources: cli.EnvVars("OPLOG_INTERVAL"),
+				},
+			},
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				cfg, err := readCLIConfig("mongo", cmd)
+				if err != nil {
+					return fmt.Errorf("configuration error: %s", err)
+				}
+				if err := cfg.PrepareCatalog(); err != nil {
+					return fmt.Errorf("configuration error: %s", err)
+				}
+				if cfg.DBURI == "" && cfg.DBHost == "" {
+					return fmt.Errorf("configuration error: either DB_URI (or DB_URI_FILE) or DB_HOST must be set")
+				}
+				logger.Init(cfg.LogLevel, cfg.LogFormat)
+
+				var opts oplog.ReceiveOptions
+				s := cmd.String("interval")
+				if opts.Interval, err = time.ParseDuration(s); err != nil || opts.Interval <= 0 {
+					return fmt.Errorf("invalid --interval %q: must be a positive duration", s)
+				}
+
+				eng, err := engine.New(cfg.Engine)
+				if err != nil {
+					return fmt.Errorf("failed to initialize engine: %w", err)
+				}
+
+				// Reach the database through the SSH bastion while receiving
+				t, cfg, err := tunnel.Open(cfg)
+				if err != nil {
+					return err
+				}
+				defer t.Close()
+
+				ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+				defer stop()
+				return oplog.Receive(ctx, cfg, eng, opts)
+			},
+		},
 	}
 }
 
@@ -118,6 +609,51 @@ func commonFlags() []cli.Flag {
 			Usage:   "Path to file containing database password",
 			Sources: cli.EnvVars("DB_PASSWORD_FILE"),
 		},
+		&cli.StringFlag{
+			Name:    "db-tls-mode",
+			Usage:   "TLS mode: disable, prefer, require, verify-ca, or verify-full",
+			Sources: cli.EnvVars("DB_TLS_MODE"),
+		},
+		&cli.StringFlag{
+			Name:    "db-tls-ca-file",
+			Usage:   "CA certificate that signs the server certificate",
+			Sources: cli.EnvVars("DB_TLS_CA_FILE"),
+		},
+		&cli.StringFlag{
+			Name:    "db-tls-cert-file",
+			Usage:   "Client certificate for TLS (mongo: certificate and key in one PEM file)",
+			Sources: cli.EnvVars("DB_TLS_CERT_FILE"),
+		},
+		&cli.StringFlag{
+			Name:    "db-tls-key-file",
+			Usage:   "Client certificate key for TLS",
+			Sources: cli.EnvVars("DB_TLS_KEY_FILE"),
+		},
+		&cli.StringFlag{
+			Name:    "db-ssh-host",
+			Usage:   "SSH bastion (host[:port]) to tunnel the database connection through",
+			Sources: cli.EnvVars("DB_SSH_HOST"),
+		},
+		&cli.StringFlag{
+			Name:    "db-ssh-user",
+			Usage:   "SSH bastion user",
+			Sources: cli.EnvVars("DB_SSH_USER"),
+		},
+		&cli.StringFlag{
+			Name:    "db-ssh-key",
+			Usage:   "SSH private key for the bastion",
+			Sources: cli.EnvVars("DB_SSH_KEY"),
+		},
+		&cli.StringFlag{
+			Name:    "db-ssh-key-file",
+			Usage:   "Path to file containing the SSH private key for the bastion",
+			Sources: cli.EnvVars("DB_SSH_KEY_FILE"),
+		},
+		&cli.StringFlag{
+			Name:    "db-ssh-known-hosts-file",
+			Usage:   "known_hosts file that verifies the bastion's host key (default: ~/.ssh/known_hosts)",
+			Sources: cli.EnvVars("DB_SSH_KNOWN_HOSTS_FILE"),
+		},
 
 		// Rclone
 		&cli.StringFlag{
@@ -154,6 +690,12 @@ func commonFlags() []cli.Flag {
 			Value:   "stream",
 			Sources: cli.EnvVars("BACKUP_MODE"),
 		},
+		&cli.StringFlag{
+			Name:    "backup-method",
+			Usage:   "Backup method: logical (dump tool) or physical (pg_basebackup for pg, xtrabackup/mariabackup for mysql/mariadb)",
+			Value:   "logical",
+			Sources: cli.EnvVars("BACKUP_METHOD"),
+		},
 		&cli.StringFlag{
 			Name:    "backup-name-template",
 			Usage:   "Filename template with tokens: {db}, {engine}, {date}, {time}, {timestamp}, {ts}, {uuid}",
@@ -170,6 +712,11 @@ func commonFlags() []cli.Flag {
 			Usage:   "Override file extension",
 			Sources: cli.EnvVars("BACKUP_EXTENSION"),
 		},
+		&cli.StringFlag{
+			Name:    "backup-compression",
+			Usage:   "Compress the dump output: gzip, zstd, or xz, with an optional level (e.g. zstd:6)",
+			Sources: cli.EnvVars("BACKUP_COMPRESSION"),
+		},
 		&cli.BoolFlag{
 			Name:    "backup-on-start",
 			Usage:   "Run backup immediately on start",
@@ -181,6 +728,26 @@ func commonFlags() []cli.Flag {
 			Usage:   "Dump all databases (pg, mysql/mariadb, mongo)",
 			Sources: cli.EnvVars("BACKUP_ALL_DATABASES", "BACKUP_ALL_DBS"),
 		},
+		&cli.BoolFlag{
+			Name:    "backup-split-databases",
+			Usage:   "With --backup-all-databases, back up each database separately (pg, mysql/mariadb, mongo)",
+			Sources: cli.EnvVars("BACKUP_SPLIT_DATABASES"),
+		},
+		&cli.StringFlag{
+			Name:    "backup-include",
+			Usage:   "Comma-separated glob patterns of the tables or collections to dump (db.pattern with --backup-split-databases)",
+			Sources: cli.EnvVars("BACKUP_INCLUDE"),
+		},
+		&cli.StringFlag{
+			Name:    "backup-exclude",
+			Usage:   "Comma-separated glob patterns of the tables or collections to skip (db or db.pattern with --backup-split-databases)",
+			Sources: cli.EnvVars("BACKUP_EXCLUDE"),
+		},
+		&cli.IntFlag{
+			Name:    "backup-parallelism",
+			Usage:   "Parallel dump jobs: pg_dump --jobs (directory/tar modes) or mongodump --numParallelCollections (0 = tool default)",
+			Sources: cli.EnvVars("BACKUP_PARALLELISM"),
+		},
 		&cli.StringFlag{
 			Name:    "backup-timeout",
 			Usage:   "Max duration for a backup (e.g. 1h, 30m)",
@@ -193,6 +760,24 @@ func commonFlags() []cli.Flag {
 			Value:   true,
 			Sources: cli.EnvVars("BACKUP_LOCK"),
 		},
+		&cli.BoolFlag{
+			Name:    "preflight-check",
+			Usage:   "Check the database is reachable before each backup",
+			Value:   true,
+			Sources: cli.EnvVars("PREFLIGHT_CHECK"),
+		},
+		&cli.IntFlag{
+			Name:    "preflight-retries",
+			Usage:   "Retries of the pre-flight check before the backup fails",
+			Value:   3,
+			Sources: cli.EnvVars("PREFLIGHT_RETRIES"),
+		},
+		&cli.StringFlag{
+			Name:    "preflight-backoff",
+			Usage:   "Delay before the first pre-flight retry, doubled for each one after",
+			Value:   "5s",
+			Sources: cli.EnvVars("PREFLIGHT_BACKOFF"),
+		},
 		&cli.StringFlag{
 			Name:    "backup-temp-dir",
 			Usage:   "Temp directory for directory/tar modes",
@@ -228,6 +813,35 @@ func commonFlags() []cli.Flag {
 			Sources: cli.EnvVars("RETENTION_MAX_DAYS"),
 		},
 
+		// Verification
+		&cli.StringFlag{
+			Name:    "verify-schedule",
+			Usage:   "Cron expression for verifying the newest backup (empty = disabled)",
+			Sources: cli.EnvVars("VERIFY_SCHEDULE"),
+		},
+
+		// Restore drills
+		&cli.StringFlag{
+			Name:    "drill-schedule",
+			Usage:   "Cron expression for restore drills into --drill-target-db (empty = disabled)",
+			Sources: cli.EnvVars("DRILL_SCHEDULE"),
+		},
+		&cli.StringFlag{
+			Name:    "drill-target-db",
+			Usage:   "Scratch database restore drills restore into (dropped and recreated each drill)",
+			Sources: cli.EnvVars("DRILL_TARGET_DB"),
+		},
+		&cli.StringFlag{
+			Name:    "drill-queries",
+			Usage:   "Sanity SQL (or JS for mongo) run against the scratch database after a drill restore",
+			Sources: cli.EnvVars("DRILL_QUERIES"),
+		},
+		&cli.StringFlag{
+			Name:    "drill-queries-file",
+			Usage:   "Path to file containing drill sanity queries",
+			Sources: cli.EnvVars("DRILL_QUERIES_FILE"),
+		},
+
 		// Notifications
 		&cli.StringFlag{
 			Name:    "notify-webhook-url",
@@ -269,8 +883,24 @@ func commonFlags() []cli.Flag {
 	}
 }
 
-// configFromCLI builds a Config from parsed CLI flags with env var fallback.
+// configFromCLI builds a validated Config from parsed CLI flags with env var
+// fallback.
 func configFromCLI(engineKey string, cmd *cli.Command) (*config.Config, error) {
+	cfg, err := readCLIConfig(engineKey, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate
+	if err := cfg.Prepare(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// readCLIConfig populates a Config from parsed CLI flags without validating it.
+func readCLIConfig(engineKey string, cmd *cli.Command) (*config.Config, error) {
 	cfg := &config.Config{}
 	cfg.Engine = engineKey
 
@@ -287,6 +917,18 @@ func configFromCLI(engineKey string, cmd *cli.Command) (*config.Config, error) {
 	if cfg.DBPassword == "" {
 		cfg.DBPassword = config.ResolveFileValue(cmd.String("db-password-file"))
 	}
+	cfg.DBPath = cmd.String("db-path")
+	cfg.DBTLSMode = cmd.String("db-tls-mode")
+	cfg.DBTLSCAFile = cmd.String("db-tls-ca-file")
+	cfg.DBTLSCertFile = cmd.String("db-tls-cert-file")
+	cfg.DBTLSKeyFile = cmd.String("db-tls-key-file")
+	cfg.DBSSHHost = cmd.String("db-ssh-host")
+	cfg.DBSSHUser = cmd.String("db-ssh-user")
+	cfg.DBSSHKey = cmd.String("db-ssh-key")
+	if cfg.DBSSHKey == "" {
+		cfg.DBSSHKey = config.ResolveFileValue(cmd.String("db-ssh-key-file"))
+	}
+	cfg.DBSSHKnownHostsFile = cmd.String("db-ssh-known-hosts-file")
 	cfg.DBAuthSource = cmd.String("db-auth-source")
 	if cfg.DBAuthSource == "" {
 		cfg.DBAuthSource = "admin"
@@ -308,11 +950,23 @@ func configFromCLI(engineKey string, cmd *cli.Command) (*config.Config, error) {
 	// Schedule & Backup
 	cfg.BackupSchedule = cmd.String("backup-schedule")
 	cfg.BackupMode = cmd.String("backup-mode")
+	cfg.BackupMethod = cmd.String("backup-method")
 	cfg.BackupNameTemplate = cmd.String("backup-name-template")
 	cfg.BackupCompress = cmd.Bool("backup-compress")
 	cfg.BackupExtension = cmd.String("backup-extension")
+	cfg.BackupCompression = cmd.String("backup-compression")
 	cfg.BackupOnStart = cmd.Bool("backup-on-start")
 	cfg.BackupAllDatabases = cmd.Bool("backup-all-databases")
+	cfg.BackupSplitDatabases = cmd.Bool("backup-split-databases")
+	cfg.BackupInclude = cmd.String("backup-include")
+	cfg.BackupExclude = cmd.String("backup-exclude")
+	cfg.BackupParallelism = int(cmd.Int("backup-parallelism"))
+	cfg.BackupBinlogPosition = cmd.Bool("backup-binlog-position")
+	cfg.DumpTool = cmd.String("dump-tool")
+	cfg.RedisSentinelMaster = cmd.String("redis-sentinel-master")
+	cfg.RedisSentinelRole = cmd.String("redis-sentinel-role")
+	cfg.RedisCluster = cmd.Bool("redis-cluster")
+	cfg.BackupOplog = cmd.Bool("backup-oplog")
 	cfg.DumpExtraArgs = cmd.String("dump-extra-args")
 	cfg.Timezone = cmd.String("tz")
 	cfg.BackupTempDir = cmd.String("backup-temp-dir")
@@ -329,11 +983,30 @@ func configFromCLI(engineKey string, cmd *cli.Command) (*config.Config, error) {
 
 	cfg.BackupLock = cmd.Bool("backup-lock")
 	cfg.DryRun = cmd.Bool("dry-run")
+	cfg.PreflightCheck = cmd.Bool("preflight-check")
+	cfg.PreflightRetries = int(cmd.Int("preflight-retries"))
+	backoffStr := cmd.String("preflight-backoff")
+	backoff, err := time.ParseDuration(backoffStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --preflight-backoff %q: %w", backoffStr, err)
+	}
+	cfg.PreflightBackoff = backoff
 
 	// Retention
 	cfg.RetentionMaxFiles = int(cmd.Int("retention-max-files"))
 	cfg.RetentionMaxDays = int(cmd.Int("retention-max-days"))
 
+	// Verification
+	cfg.VerifySchedule = cmd.String("verify-schedule")
+
+	// Restore drills
+	cfg.DrillSchedule = cmd.String("drill-schedule")
+	cfg.DrillTargetDB = cmd.String("drill-target-db")
+	cfg.DrillQueries = cmd.String("drill-queries")
+	if cfg.DrillQueries == "" {
+		cfg.DrillQueries = config.ResolveFileValue(cmd.String("drill-queries-file"))
+	}
+
 	// Notifications
 	cfg.NotifyWebhookURL = cmd.String("notify-webhook-url")
 	cfg.NotifyOn = cmd.String("notify-on")
@@ -346,11 +1019,6 @@ func configFromCLI(engineKey string, cmd *cli.Command) (*config.Config, error) {
 	cfg.LogLevel = cmd.String("log-level")
 	cfg.LogFormat = cmd.String("log-format")
 
-	// Validate
-	if err := cfg.Prepare(); err != nil {
-		return nil, err
-	}
-
 	return cfg, nil
 }
 
@@ -381,10 +1049,10 @@ func run(cfg *config.Config) error {
 	scheduler.CheckConflictingFlags(cfg, eng)
 
 	// Warn if BACKUP_COMPRESS is set but engine doesn't support it
-	if cfg.BackupCompress && !eng.SupportsCompression() {
+	if cfg.BackupCompress && !eng.SupportsCompression() && cfg.CompressionAlgorithm == "" {
 		log.Warn().
 			Str("engine", eng.Name()).
-			Msg("BACKUP_COMPRESS=true but this engine has no native compression; ignoring")
+			Msg("BACKUP_COMPRESS=true but this engine has no native compression; ignoring (set BACKUP_COMPRESSION to compress the dump output)")
 	}
 
 	// Initialize pipeline
@@ -399,6 +1067,11 @@ func run(cfg *config.Config) error {
 		return nil
 	}
 
+	// Refuse to start with a dump tool that cannot back up the server
+	if err := checkVersions(cfg, eng); err != nil {
+		log.Fatal().Err(err).Str("category", preflight.VersionMismatch).Msg("dump tool cannot back up this server")
+	}
+
 	// One-time backup mode
 	if cfg.ScheduleOnce {
 		log.Info().Msg("running one-time backup")
@@ -439,6 +1112,278 @@ func run(cfg *config.Config) error {
 	return nil
 }
 
+// runRestore executes a single restore with a validated Config. If until
+// is set, the archived binlogs or oplog are replayed on top of the restored
+// dump up to that time ("latest" replays them all).
+func runRestore(ctx context.Context, cfg *config.Config, opts restore.Options, until string) error {
+	logger.Init(cfg.LogLevel, cfg.LogFormat)
+	log := logger.With(cfg.Engine, cfg.DBNameOrDefault(), "")
+
+	eng, err := engine.New(cfg.Engine)
+	if err != nil {
+		return fmt.Errorf("failed to initialize engine: %w", err)
+	}
+
+	// Check the replay before restoring anything
+	var rp *replay
+	if until != "" {
+		var untilTime time.Time
+		if until != "latest" {
+			if untilTime, err = parseTargetTime(cfg, until); err != nil {
+				return fmt.Errorf("invalid --until: %w", err)
+			}
+		}
+		if rp, err = planReplay(ctx, cfg, eng, opts, untilTime); err != nil {
+			return err
+		}
+	}
+
+	remotePath := restore.RemotePath(cfg, opts.From)
+
+	if cfg.DryRun {
+		log.Info().Msg("=== DRY RUN MODE ===")
+		log.Info().Str("from", remotePath).Msg("backup")
+		cmd, err := restore.Command(ctx, cfg, eng, opts)
+		if err != nil {
+			log.Warn().Err(err).Msg("could not build restore command for dry run")
+		} else {
+			log.Info().Str("command", config.MaskCmdArgs(cmd.Args)).Msg("restore command")
+			engine.Cleanup(cmd)
+		}
+		if rp != nil {
+			log.Info().Str("until", until).Strs(rp.kind, rp.files).Str("start_position", rp.start).Msg(rp.name + " replay")
+		}
+		log.Info().Msg("=== END DRY RUN ===")
+		return nil
+	}
+
+	// Reach the database through the SSH bastion for the restore and replay
+	t, cfg, err := tunnel.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	log.Info().Str("from", remotePath).Msg("restore started")
+	start := time.Now()
+
+	if err := restore.Run(ctx, cfg, eng, opts); err != nil {
+		log.Error().Err(err).Msg("restore failed")
+		return err
+	}
+
+	if rp != nil {
+		log.Info().Str("until", until).Int(rp.kind, len(rp.files)).Msg("replaying " + rp.name)
+		if err := rp.run(cfg); err != nil {
+			log.Error().Err(err).Msg(rp.name + " replay failed")
+			return err
+		}
+		log.Info().Msg(rp.name + " replay completed")
+	}
+
+	log.Info().Dur("duration", time.Since(start)).Msg("restore completed successfully")
+	if eng.Name() == "redis" {
+		log.Info().Str("rdb_path", opts.RDBPath).Msg("RDB staged; restart redis-server (with appendonly disabled) to load it")
+	}
+	return nil
+}
+
+// replay is a checked log replay that runs after the restore.
+type replay struct {
+	name  string // "binlog" or "oplog"
+	kind  string // log field naming files
+	files []string
+	start string
+	run   func(cfg *config.Config) error
+}
+
+// planReplay checks that the archived log can roll the dump opts.From
+// forward to until and returns the replay to run after restoring it.
+func planReplay(ctx context.Context, cfg *config.Config, eng engine.Engine, opts restore.Options, until time.Time) (*replay, error) {
+	if cfg.Engine == "mongo" {
+		if opts.TargetDB != "" {
+			return nil, fmt.Errorf("--until cannot be combined with --target-db: the oplog replays into the original namespaces")
+		}
+		plan, err := oplog.NewPlan(ctx, cfg, opts.From, until)
+		if err != nil {
+			return nil, err
+		}
+		return &replay{
+			name:  "oplog",
+			kind:  "slices",
+			files: plan.Slices,
+			start: plan.Start.String(),
+			run:   func(cfg *config.Config) error { return oplog.Replay(ctx, cfg, eng, plan) },
+		}, nil
+	}
+
+	plan, err := binlog.NewPlan(ctx, cfg, opts.From, until)
+	if err != nil {
+		return nil, err
+	}
+	return &replay{
+		name:  "binlog",
+		kind:  "binlogs",
+		files: plan.Files,
+		start: plan.StartPosition,
+		run:   func(cfg *config.Config) error { return binlog.Replay(ctx, cfg, eng, plan, opts.TargetDB) },
+	}, nil
+}
+
+// runVerify verifies a single backup and reports the result.
+func runVerify(ctx context.Context, cfg *config.Config, from string) error {
+	logger.Init(cfg.LogLevel, cfg.LogFormat)
+
+	eng, err := engine.New(cfg.Engine)
+	if err != nil {
+		return fmt.Errorf("failed to initialize engine: %w", err)
+	}
+
+	return scheduler.RunVerify(ctx, cfg, eng, from)
+}
+
+// runRecoveryConfig prints the base backup to restore for recovery up to
+// targetTime and the settings that replay the archived WAL.
+func runRecoveryConfig(ctx context.Context, cfg *config.Config, targetTime string) error {
+	eng, err := engine.New(cfg.Engine)
+	if err != nil {
+		return fmt.Errorf("failed to initialize engine: %w", err)
+	}
+
+	var target time.Time
+	if targetTime != "" {
+		if target, err = parseTargetTime(cfg, targetTime); err != nil {
+			return fmt.Errorf("invalid --target-time: %w", err)
+		}
+	}
+
+	base, err := wal.BaseBackup(ctx, cfg, eng, target)
+	if err != nil {
+		return err
+	}
+
+	fetch := "dbstash pg --rclone-remote " + shellQuote(cfg.RcloneRemote)
+	if cfg.RcloneConfigFile != "" {
+		fetch += " --rclone-config-file " + shellQuote(cfg.RcloneConfigFile)
+	}
+	fetch += " wal-fetch %f %p"
+
+	fmt.Printf("# Base backup: %s (start LSN %s on timeline %s)\n", base.Name, base.Metadata["start_lsn"], base.Metadata["timeline"])
+	fmt.Printf("# 1. With the server stopped, extract it into an empty data directory:\n")
+	fmt.Printf("#      dbstash pg restore --from %s --data-dir <PGDATA>\n", shellQuote(base.Name))
+	fmt.Printf("# 2. Append the settings below to <PGDATA>/postgresql.auto.conf and\n")
+	fmt.Printf("#    create an empty <PGDATA>/recovery.signal file.\n")
+	fmt.Printf("# 3. Start the server; it replays the archived WAL and promotes.\n")
+	fmt.Print(wal.RecoverySettings(fetch, target))
+	return nil
+}
+
+// parseTargetTime parses a point-in-time recovery target. Dates without a
+// zone are read in the configured TZ.
+func parseTargetTime(cfg *config.Config, s string) (time.Time, error) {
+	loc := time.UTC
+	if cfg.Timezone != "" {
+		if l, err := time.LoadLocation(cfg.Timezone); err == nil {
+			loc = l
+		}
+	}
+	return parseDate(s, loc, false)
+}
+
+// shellSafe matches arguments that need no quoting in a shell command.
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_./:@%+=-]+$`)
+
+// shellQuote quotes s for a POSIX shell if needed.
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runList prints the backups on the remote that match the list flags.
+func runList(ctx context.Context, cfg *config.Config, cmd *cli.Command) error {
+	logger.Init(cfg.LogLevel, cfg.LogFormat)
+
+	eng, err := engine.New(cfg.Engine)
+	if err != nil {
+		return fmt.Errorf("failed to initialize engine: %w", err)
+	}
+
+	loc := time.UTC
+	if cfg.Timezone != "" {
+		if l, err := time.LoadLocation(cfg.Timezone); err == nil {
+			loc = l
+		}
+	}
+
+	var filter catalog.Filter
+	filter.Database = cmd.String("database")
+	if s := cmd.String("since"); s != "" {
+		if filter.Since, err = parseDate(s, loc, false); err != nil {
+			return fmt.Errorf("invalid --since: %w", err)
+		}
+	}
+	if s := cmd.String("until"); s != "" {
+		if filter.Until, err = parseDate(s, loc, true); err != nil {
+			return fmt.Errorf("invalid --until: %w", err)
+		}
+	}
+
+	entries, err := catalog.List(ctx, cfg, eng)
+	if err != nil {
+		return err
+	}
+	entries = catalog.Apply(entries, filter)
+	if err := catalog.Sort(entries, cmd.String("sort"), cmd.Bool("reverse")); err != nil {
+		return err
+	}
+
+	switch cmd.String("output") {
+	case "json":
+		if entries == nil {
+			entries = []catalog.Entry{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSIZE\tMODIFIED\tENGINE\tDATABASE\tMODE\tCOMPRESSED\tCOMPRESSION")
+		for _, e := range entries {
+			size := "-"
+			if e.Size >= 0 {
+				size = notify.FormatSize(e.Size)
+			}
+			compression := "-"
+			if e.Compression != "" {
+				compression = e.Compression
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%t\t%s\n",
+				e.Name, size, e.ModTime.In(loc).Format(time.RFC3339), e.Engine, e.Database, e.Mode, e.Compressed, compression)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("invalid --output %q (valid: table, json)", cmd.String("output"))
+	}
+}
+
+// parseDate parses an RFC 3339 timestamp or a YYYY-MM-DD date in loc. With
+// endOfDay, a bare date covers the whole day.
+func parseDate(s string, loc *time.Location, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not YYYY-MM-DD or RFC 3339", s)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
 func dryRun(cfg *config.Config, eng engine.Engine) {
 	log := logger.Log
 	log.Info().Msg("=== DRY RUN MODE ===")
@@ -447,7 +1392,7 @@ func dryRun(cfg *config.Config, eng engine.Engine) {
 	log.Info().Str("schedule", cfg.BackupSchedule).Msg("schedule")
 	log.Info().Str("remote", cfg.RcloneRemote).Msg("rclone remote")
 	log.Info().Str("template", cfg.BackupNameTemplate).Msg("name template")
-	log.Info().Bool("compress", cfg.BackupCompress).Msg("compression")
+	log.Info().Bool("compress", cfg.BackupCompress).Str("algorithm", cfg.CompressionAlgorithm).Int("level", cfg.CompressionLevel).Msg("compression")
 
 	// Connection info (masked)
 	if cfg.DBURI != "" {
@@ -462,17 +1407,69 @@ func dryRun(cfg *config.Config, eng engine.Engine) {
 			Msg("connection")
 	}
 
-	// Build a sample dump command
-	cmd, err := eng.DumpCommand(cfg, cfg.BackupMode, "/tmp/dbstash-dry-run")
+	// A split backup lists the databases, then dumps each one
+	dumpCfg := cfg
+	if cfg.BackupSplitDatabases {
+		if lister, ok := eng.(engine.DatabaseLister); ok {
+			if cmd, err := lister.ListDatabasesCommand(cfg); err != nil {
+				log.Warn().Err(err).Msg("could not build list databases command for dry run")
+			} else {
+				log.Info().Str("command", config.MaskCmdArgs(cmd.Args)).Msg("list databases command")
+				engine.Cleanup(cmd)
+			}
+			if cmd, err := lister.GlobalsCommand(cfg); err == nil && cmd != nil {
+				log.Info().Str("command", config.MaskCmdArgs(cmd.Args)).Msg("globals command")
+				engine.Cleanup(cmd)
+			}
+		}
+		dumpCfg = cfg.ForDatabase("example")
+	}
+
+	// A cluster backup lists the master shards, then dumps each one
+	if cfg.RedisCluster {
+		log.Info().Msg("cluster shards are listed with CLUSTER NODES")
+		dumpCfg = cfg.ForShard("slots-0-16383", "shard-master:6379")
+	}
+
+	// Build a sample dump command; tar mode dumps a directory first
+	mode := cfg.BackupMode
+	if mode == "tar" {
+		mode = "directory"
+	}
+	cmd, err := eng.DumpCommand(dumpCfg, mode, "/tmp/dbstash-dry-run")
 	if err != nil {
 		log.Warn().Err(err).Msg("could not build dump command for dry run")
 	} else {
-		log.Info().Str("command", config.MaskCmdArgs(cmd.Args)).Msg("dump command")
+		log.Info().Str("command", config.MaskCmdArgs(cmd.Args)).Str("version", engine.ToolVersion(cmd.Args[0])).Msg("dump command")
+		engine.Cleanup(cmd)
+	}
+	if err := checkVersions(cfg, eng); err != nil {
+		log.Error().Err(err).Str("category", preflight.VersionMismatch).Msg("dump tool cannot back up this server")
 	}
 
 	log.Info().Msg("=== END DRY RUN ===")
 }
 
+// checkVersions reads the server version, through the SSH tunnel if one
+// is set, and compares it with the dump tool's. It returns an error only
+// if the dump tool cannot back up the server; an unreachable server is
+// left to the pre-flight check of each backup.
+func checkVersions(cfg *config.Config, eng engine.Engine) error {
+	log := logger.With(cfg.Engine, cfg.DBNameOrDefault(), "")
+	t, tunneled, err := tunnel.Open(cfg)
+	if err != nil {
+		log.Warn().Err(err).Msg("could not read the server version")
+		return nil
+	}
+	defer t.Close()
+
+	server, err := preflight.CheckVersions(context.Background(), tunneled, eng, log)
+	if server != "" {
+		log.Info().Str("server_version", server).Msg("server version")
+	}
+	return err
+}
+
 func maskPassword(pw string) string {
 	if pw == "" {
 		return ""
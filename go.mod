@@ -4,9 +4,12 @@ go 1.25.5
 
 require (
 	github.com/google/uuid v1.6.0
+	github.com/klauspost/compress v1.18.0
 	github.com/robfig/cron/v3 v3.0.1
 	github.com/rs/zerolog v1.34.0
+	github.com/ulikunitz/xz v0.5.15
 	github.com/urfave/cli/v3 v3.6.2
+	golang.org/x/crypto v0.47.0
 )
 
 require (
@@ -0,0 +1,179 @@
+// Package archive keeps continuously archived database logs, PostgreSQL
+// WAL and MySQL/MariaDB binlogs, in a directory under RCLONE_REMOTE. Each
+// file is stored once under its own name; retention leaves these
+// directories alone and the callers prune them.
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/pipeline"
+	"github.com/viperadnan-git/dbstash/internal/retention"
+)
+
+// RemoteDir returns the rclone path of the archive directory dir.
+func RemoteDir(cfg *config.Config, dir string) string {
+	return strings.TrimRight(cfg.RcloneRemote, "/") + "/" + dir
+}
+
+// Push archives the file at path into dir. A file that is already
+// archived with the same content is accepted, so uploads can safely be
+// retried; different content under the same name is an error.
+func Push(ctx context.Context, cfg *config.Config, dir, path string) error {
+	name := filepath.Base(path)
+	remotePath := RemoteDir(cfg, dir) + "/" + name
+	log := logger.Log.With().Str("archive", dir).Str("file", name).Logger()
+
+	if exists(ctx, cfg, remotePath) {
+		same, err := sameContent(ctx, cfg, path, remotePath)
+		if err != nil {
+			return err
+		}
+		if !same {
+			return fmt.Errorf("%s is already archived with different content", name)
+		}
+		log.Debug().Msg("file already archived")
+		return nil
+	}
+
+	args := []string{"copyto", path, remotePath}
+	args = append(args, pipeline.RcloneConfigArgs(cfg)...)
+	cmd := exec.CommandContext(ctx, "rclone", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("rclone copyto failed: %w (stderr: %s)", err, stderr.String())
+	}
+
+	log.Debug().Str("remote_path", remotePath).Msg("archived file")
+	return nil
+}
+
+// Fetch copies the archived file name in dir to dest. It fails if the
+// file is not archived.
+func Fetch(ctx context.Context, cfg *config.Config, dir, name, dest string) error {
+	remotePath := RemoteDir(cfg, dir) + "/" + name
+	if !exists(ctx, cfg, remotePath) {
+		return fmt.Errorf("%s is not archived", name)
+	}
+
+	args := []string{"copyto", remotePath, dest}
+	args = append(args, pipeline.RcloneConfigArgs(cfg)...)
+	cmd := exec.CommandContext(ctx, "rclone", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("rclone copyto failed: %w (stderr: %s)", err, stderr.String())
+	}
+	return nil
+}
+
+// List returns the files in the archive directory dir, or nothing if
+// nothing has been archived there yet.
+func List(ctx context.Context, cfg *config.Config, dir string) ([]retention.RemoteEntry, error) {
+	top, err := retention.ListRemote(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	for _, entry := range top {
+		if entry.IsDir && entry.Path == dir {
+			found = true
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+
+	args := []string{"lsjson", "--files-only", RemoteDir(cfg, dir)}
+	args = append(args, pipeline.RcloneConfigArgs(cfg)...)
+	cmd := exec.CommandContext(ctx, "rclone", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("rclone lsjson: %w (stderr: %s)", err, stderr.String())
+	}
+
+	var entries []retention.RemoteEntry
+	if err := json.Unmarshal(stdout.Bytes(), &entries); err != nil {
+		return nil, fmt.Errorf("parsing rclone lsjson output: %w", err)
+	}
+	return entries, nil
+}
+
+// Delete removes entries from the archive directory dir and returns how
+// many were deleted. Failures are logged and skipped.
+func Delete(ctx context.Context, cfg *config.Config, dir string, entries []retention.RemoteEntry) int {
+	deleted := 0
+	for _, entry := range entries {
+		remotePath := RemoteDir(cfg, dir) + "/" + entry.Path
+		args := []string{"deletefile", remotePath}
+		args = append(args, pipeline.RcloneConfigArgs(cfg)...)
+		cmd := exec.CommandContext(ctx, "rclone", args...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			logger.Log.Warn().Err(err).Str("path", remotePath).Str("stderr", stderr.String()).Msg("failed to delete archived file")
+			continue
+		}
+		deleted++
+	}
+	return deleted
+}
+
+// exists reports whether remotePath is an object on the remote. Lookup
+// errors are treated as "does not exist".
+func exists(ctx context.Context, cfg *config.Config, remotePath string) bool {
+	args := []string{"lsjson", "--stat", remotePath}
+	args = append(args, pipeline.RcloneConfigArgs(cfg)...)
+	return exec.CommandContext(ctx, "rclone", args...).Run() == nil
+}
+
+// sameContent compares the SHA-256 of a local file with that of a remote
+// object, downloading the object to hash it.
+func sameContent(ctx context.Context, cfg *config.Config, localPath, remotePath string) (bool, error) {
+	local, err := hashLocal(localPath)
+	if err != nil {
+		return false, fmt.Errorf("hashing %s: %w", localPath, err)
+	}
+
+	args := []string{"cat", remotePath}
+	args = append(args, pipeline.RcloneConfigArgs(cfg)...)
+	cmd := exec.CommandContext(ctx, "rclone", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	h := sha256.New()
+	cmd.Stdout = h
+	if err := cmd.Run(); err != nil {
+		return false, fmt.Errorf("rclone cat failed: %w (stderr: %s)", err, stderr.String())
+	}
+	return hex.EncodeToString(h.Sum(nil)) == local, nil
+}
+
+// hashLocal returns the hex SHA-256 of the file at path.
+func hashLocal(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
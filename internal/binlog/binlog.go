@@ -0,0 +1,63 @@
+// Package binlog archives MySQL and MariaDB binary logs under the binlog/
+// prefix of RCLONE_REMOTE and replays them on top of a restored dump for
+// point-in-time recovery. Binlogs are copied from the server by a
+// long-running mysqlbinlog (Receive); dumps taken with
+// BACKUP_BINLOG_POSITION=true record where replay starts.
+package binlog
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/viperadnan-git/dbstash/internal/archive"
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/engine"
+	"github.com/viperadnan-git/dbstash/internal/retention"
+)
+
+// RemoteDir returns the rclone path binlogs are archived to.
+func RemoteDir(cfg *config.Config) string {
+	return archive.RemoteDir(cfg, retention.BinlogDir)
+}
+
+// ParseName splits a binlog file name such as "mysql-bin.000042" into its
+// base name and sequence number. ok is false for anything else.
+func ParseName(name string) (base string, seq int, ok bool) {
+	i := strings.LastIndex(name, ".")
+	if i <= 0 || i == len(name)-1 {
+		return "", 0, false
+	}
+	seq, err := strconv.Atoi(name[i+1:])
+	if err != nil || seq < 0 {
+		return "", 0, false
+	}
+	return name[:i], seq, true
+}
+
+// sortNames orders binlog file names by sequence number and drops
+// anything that is not a binlog file.
+func sortNames(names []string) []string {
+	var result []string
+	for _, name := range names {
+		if _, _, ok := ParseName(name); ok {
+			result = append(result, name)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		_, a, _ := ParseName(result[i])
+		_, b, _ := ParseName(result[j])
+		return a < b
+	})
+	return result
+}
+
+// mysqlEngine returns eng as the MySQL engine.
+func mysqlEngine(eng engine.Engine) (*engine.MySQL, error) {
+	m, ok := eng.(*engine.MySQL)
+	if !ok {
+		return nil, fmt.Errorf("binlog archiving is only supported for mysql and mariadb (got %s)", eng.Name())
+	}
+	return m, nil
+}
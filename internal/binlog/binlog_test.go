@@ -0,0 +1,112 @@
+package binlog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/engine"
+	"github.com/viperadnan-git/dbstash/internal/retention"
+)
+
+func TestParseName(t *testing.T) {
+	tests := []struct {
+		name string
+		base string
+		seq  int
+		ok   bool
+	}{
+		{"mysql-bin.000042", "mysql-bin", 42, true},
+		{"binlog.1000000", "binlog", 1000000, true},
+		{"mysql-bin.index", "", 0, false},
+		{"mysql-bin.", "", 0, false},
+		{"000001", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, seq, ok := ParseName(tt.name)
+			if base != tt.base || seq != tt.seq || ok != tt.ok {
+				t.Errorf("ParseName() = %q, %d, %v; want %q, %d, %v", base, seq, ok, tt.base, tt.seq, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSelectPrunable(t *testing.T) {
+	entries := []retention.RemoteEntry{
+		{Name: "mysql-bin.000009", Path: "mysql-bin.000009"},
+		{Name: "mysql-bin.000010", Path: "mysql-bin.000010"},
+		{Name: "mysql-bin.000011", Path: "mysql-bin.000011"},
+		{Name: "old-bin.000001", Path: "old-bin.000001"},
+	}
+
+	got := SelectPrunable(entries, "mysql-bin.000010")
+	if len(got) != 1 || got[0].Name != "mysql-bin.000009" {
+		t.Errorf("expected only mysql-bin.000009, got %v", got)
+	}
+}
+
+func TestSelectReplay(t *testing.T) {
+	names := []string{"mysql-bin.000011", "mysql-bin.000009", "mysql-bin.000010", "mysql-bin.000012"}
+
+	got, err := SelectReplay(names, "mysql-bin.000010")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "mysql-bin.000010,mysql-bin.000011,mysql-bin.000012"; strings.Join(got, ",") != want {
+		t.Errorf("expected %s, got %v", want, got)
+	}
+
+	if _, err := SelectReplay([]string{"mysql-bin.000010", "mysql-bin.000012"}, "mysql-bin.000010"); err == nil {
+		t.Error("expected error for a gap in the archive")
+	}
+	if _, err := SelectReplay(names, "mysql-bin.000008"); err == nil {
+		t.Error("expected error when the start binlog is not archived")
+	}
+}
+
+func TestDumpPosition(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+		want map[string]string
+	}{
+		{
+			"mariadb",
+			"--\n-- Position to start replication or point-in-time recovery from\n--\n\n-- CHANGE MASTER TO MASTER_LOG_FILE='mysql-bin.000003', MASTER_LOG_POS=385;\n",
+			map[string]string{"binlog_file": "mysql-bin.000003", "binlog_position": "385"},
+		},
+		{
+			"mysql with gtid",
+			"SET @@GLOBAL.GTID_PURGED=/*!80000 '+'*/ '3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5';\n" +
+				"-- CHANGE REPLICATION SOURCE TO SOURCE_LOG_FILE='binlog.000002', SOURCE_LOG_POS=157;\n",
+			map[string]string{"binlog_file": "binlog.000002", "binlog_position": "157", "gtid_set": "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"},
+		},
+	}
+
+	eng, err := engine.New("mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := eng.(engine.MetadataParser)
+	cfg := &config.Config{Engine: "mysql", BackupBinlogPosition: true}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parser.ParseMetadata(cfg, tt.head, "")
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("%s = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+
+	if got := parser.ParseMetadata(&config.Config{Engine: "mysql"}, tests[0].head, ""); got != nil {
+		t.Errorf("expected no metadata without BACKUP_BINLOG_POSITION, got %v", got)
+	}
+}
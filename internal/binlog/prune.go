@@ -0,0 +1,85 @@
+package binlog
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/viperadnan-git/dbstash/internal/archive"
+	"github.com/viperadnan-git/dbstash/internal/catalog"
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/engine"
+	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/manifest"
+	"github.com/viperadnan-git/dbstash/internal/pipeline"
+	"github.com/viperadnan-git/dbstash/internal/restore"
+	"github.com/viperadnan-git/dbstash/internal/retention"
+)
+
+// Prune deletes the archived binlogs that no retained dump needs: every
+// binlog before the one the oldest dump with a binlog position started
+// in. It does nothing unless retention is configured, and deletes nothing
+// if a dump's manifest cannot be read. It returns the number of files
+// deleted.
+func Prune(ctx context.Context, cfg *config.Config, eng engine.Engine) (int, error) {
+	if cfg.RetentionMaxFiles <= 0 && cfg.RetentionMaxDays <= 0 {
+		return 0, nil
+	}
+
+	entries, err := archive.List(ctx, cfg, retention.BinlogDir)
+	if err != nil || len(entries) == 0 {
+		return 0, err
+	}
+
+	oldest, err := oldestDump(ctx, cfg, eng)
+	if err != nil || oldest == nil {
+		return 0, err
+	}
+
+	cutoff := oldest.Metadata["binlog_file"]
+	logger.Log.Debug().Str("backup", oldest.Name).Str("cutoff", cutoff).Msg("pruning binlogs before oldest dump")
+
+	return archive.Delete(ctx, cfg, retention.BinlogDir, selectPrunable(entries, cutoff)), nil
+}
+
+// SelectPrunable returns the binlogs that come before cutoff. Binlogs
+// with a different base name are kept. Exported for testing.
+func SelectPrunable(entries []retention.RemoteEntry, cutoff string) []retention.RemoteEntry {
+	return selectPrunable(entries, cutoff)
+}
+
+func selectPrunable(entries []retention.RemoteEntry, cutoff string) []retention.RemoteEntry {
+	cutoffBase, cutoffSeq, ok := ParseName(cutoff)
+	if !ok {
+		return nil
+	}
+	var result []retention.RemoteEntry
+	for _, entry := range entries {
+		base, seq, ok := ParseName(entry.Name)
+		if ok && base == cutoffBase && seq < cutoffSeq {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// oldestDump returns the manifest of the oldest dump on the remote that
+// records a binlog position, or nil if there is none. A backup whose
+// manifest cannot be read stops the search with an error, since its
+// binlogs may still be needed.
+func oldestDump(ctx context.Context, cfg *config.Config, eng engine.Engine) (*manifest.Manifest, error) {
+	entries, err := catalog.List(ctx, cfg, eng)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		remotePath := restore.RemotePath(cfg, entries[i].Name)
+		m, err := manifest.Fetch(ctx, remotePath, pipeline.RcloneConfigArgs(cfg))
+		if err != nil {
+			return nil, fmt.Errorf("reading manifest of %s, keeping all binlogs: %w", entries[i].Name, err)
+		}
+		if m.Metadata["binlog_file"] != "" {
+			return m, nil
+		}
+	}
+	return nil, nil
+}
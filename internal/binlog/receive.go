@@ -0,0 +1,240 @@
+package binlog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/viperadnan-git/dbstash/internal/archive"
+	"github.com/viperadnan-git/dbstash/internal/catalog"
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/engine"
+	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/manifest"
+	"github.com/viperadnan-git/dbstash/internal/notify"
+	"github.com/viperadnan-git/dbstash/internal/pipeline"
+	"github.com/viperadnan-git/dbstash/internal/restore"
+	"github.com/viperadnan-git/dbstash/internal/retention"
+)
+
+// pollInterval is how often the spool directory is checked for completed
+// binlogs.
+const pollInterval = 5 * time.Second
+
+// maxBackoff caps the delay before mysqlbinlog is restarted.
+const maxBackoff = time.Minute
+
+// ReceiveOptions controls a binlog receiver.
+type ReceiveOptions struct {
+	// SpoolDir is where mysqlbinlog writes binlogs before they are shipped.
+	// Keep it on a persistent volume so a restart resumes from the binlog
+	// being written.
+	SpoolDir string
+
+	// StartFile is the binlog to start from when the spool directory is
+	// empty. It defaults to the newest archived binlog, then to the binlog
+	// the newest dump started in.
+	StartFile string
+
+	// FlushInterval, if set, runs FLUSH BINARY LOGS on the server this
+	// often so the binlog being written is closed and archived even on a
+	// quiet server. It bounds how much history can be lost.
+	FlushInterval time.Duration
+}
+
+// Receive runs mysqlbinlog until ctx is cancelled, shipping every closed
+// binlog to the binlog directory on the remote. mysqlbinlog is restarted
+// with a growing delay whenever it exits; each failure is sent as a
+// notification per NOTIFY_ON.
+func Receive(ctx context.Context, cfg *config.Config, eng engine.Engine, opts ReceiveOptions) error {
+	my, err := mysqlEngine(eng)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(opts.SpoolDir, 0o700); err != nil {
+		return fmt.Errorf("creating spool dir: %w", err)
+	}
+
+	log := logger.Log.With().Str("spool_dir", opts.SpoolDir).Str("remote", RemoteDir(cfg)).Logger()
+	s := &shipper{cfg: cfg, dir: opts.SpoolDir}
+	backoff := pollInterval
+
+	var flush <-chan time.Time
+	if opts.FlushInterval > 0 {
+		ticker := time.NewTicker(opts.FlushInterval)
+		defer ticker.Stop()
+		flush = ticker.C
+	}
+
+	for {
+		start, err := startFile(ctx, cfg, eng, opts)
+		if err != nil {
+			return err
+		}
+		cmd, err := my.BinlogReceiveCommand(cfg, opts.SpoolDir, start)
+		if err != nil {
+			return err
+		}
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+
+		log.Info().Str("cmd", config.MaskCmdArgs(cmd.Args)).Msg("starting mysqlbinlog")
+		started := time.Now()
+		if err := cmd.Start(); err != nil {
+			engine.Cleanup(cmd)
+			return fmt.Errorf("starting mysqlbinlog: %w", err)
+		}
+		done := make(chan error, 1)
+		go func() {
+			err := cmd.Wait()
+			engine.Cleanup(cmd)
+			done <- err
+		}()
+
+		ticker := time.NewTicker(pollInterval)
+		var recvErr error
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				// The binlog being written stays in the spool directory
+				// and is fetched again on the next start
+				cmd.Process.Signal(os.Interrupt)
+				<-done
+				ticker.Stop()
+				s.ship(context.WithoutCancel(ctx))
+				return nil
+			case recvErr = <-done:
+				break wait
+			case <-ticker.C:
+				s.ship(ctx)
+			case <-flush:
+				flushBinlogs(ctx, cfg, my)
+			}
+		}
+		ticker.Stop()
+		s.ship(ctx)
+
+		err = fmt.Errorf("mysqlbinlog exited: %v (stderr: %s)", recvErr, strings.TrimSpace(stderr.String()))
+		log.Error().Err(err).Dur("restart_in", backoff).Msg("binlog receiver stopped")
+		notify.Send(ctx, cfg.NotifyWebhookURL, cfg.NotifyOn, notify.Result{
+			Operation:  "binlog",
+			Status:     "failure",
+			Engine:     eng.Name(),
+			Database:   cfg.DBNameOrDefault(),
+			RemotePath: RemoteDir(cfg),
+			Duration:   time.Since(started),
+			Error:      err.Error(),
+		})
+
+		// A receiver that ran for a while was healthy; start over
+		if time.Since(started) > maxBackoff {
+			backoff = pollInterval
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// startFile returns the binlog mysqlbinlog starts from: the newest file in
+// the spool directory, which may be incomplete, then opts.StartFile, the
+// newest archived binlog, and the binlog the newest dump started in.
+func startFile(ctx context.Context, cfg *config.Config, eng engine.Engine, opts ReceiveOptions) (string, error) {
+	if names := spooled(opts.SpoolDir); len(names) > 0 {
+		return names[len(names)-1], nil
+	}
+	if opts.StartFile != "" {
+		return opts.StartFile, nil
+	}
+
+	entries, err := archive.List(ctx, cfg, retention.BinlogDir)
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	if names = sortNames(names); len(names) > 0 {
+		return names[len(names)-1], nil
+	}
+
+	backups, err := catalog.List(ctx, cfg, eng)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range backups {
+		m, err := manifest.Fetch(ctx, restore.RemotePath(cfg, entry.Name), pipeline.RcloneConfigArgs(cfg))
+		if err != nil {
+			continue
+		}
+		if file := m.Metadata["binlog_file"]; file != "" {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("no binlog to start from: nothing archived and no dump with a binlog position; set --start-file")
+}
+
+// spooled returns the binlogs in dir, oldest first.
+func spooled(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			names = append(names, entry.Name())
+		}
+	}
+	return sortNames(names)
+}
+
+// flushBinlogs closes the binlog the server is writing. Failures are
+// logged; the binlog is then archived at the server's next rotation.
+func flushBinlogs(ctx context.Context, cfg *config.Config, my *engine.MySQL) {
+	cmd, err := my.FlushBinlogsCommand(cfg)
+	if err != nil {
+		logger.Log.Warn().Err(err).Msg("FLUSH BINARY LOGS failed")
+		return
+	}
+	defer engine.Cleanup(cmd)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		logger.Log.Warn().Err(err).Str("stderr", strings.TrimSpace(stderr.String())).Msg("FLUSH BINARY LOGS failed")
+	}
+}
+
+// shipper uploads closed binlogs from the spool directory.
+type shipper struct {
+	cfg *config.Config
+	dir string
+}
+
+// ship pushes every binlog in the spool directory except the newest, which
+// mysqlbinlog is still writing, oldest first. Shipped files are removed.
+// Failures are logged and retried on the next call.
+func (s *shipper) ship(ctx context.Context) {
+	names := spooled(s.dir)
+	if len(names) < 2 {
+		return
+	}
+	for _, name := range names[:len(names)-1] {
+		path := filepath.Join(s.dir, name)
+		if err := archive.Push(ctx, s.cfg, retention.BinlogDir, path); err != nil {
+			logger.Log.Warn().Err(err).Str("binlog_file", name).Msg("failed to ship binlog")
+			return
+		}
+		logger.Log.Info().Str("binlog_file", name).Msg("shipped binlog")
+		os.Remove(path)
+	}
+}
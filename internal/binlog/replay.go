@@ -0,0 +1,161 @@
+package binlog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/viperadnan-git/dbstash/internal/archive"
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/engine"
+	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/manifest"
+	"github.com/viperadnan-git/dbstash/internal/pipeline"
+	"github.com/viperadnan-git/dbstash/internal/restore"
+	"github.com/viperadnan-git/dbstash/internal/retention"
+)
+
+// Plan is a checked binlog replay: the binlogs that follow a dump, from
+// the position recorded in its manifest.
+type Plan struct {
+	// From is the dump the binlogs are replayed on top of.
+	From string
+
+	// StartPosition is the position in the first file replay starts at.
+	StartPosition string
+
+	// Files are the archived binlogs to replay, in order.
+	Files []string
+
+	// Until is when replay stops; zero replays every archived binlog.
+	Until time.Time
+}
+
+// NewPlan checks that the dump from can be rolled forward to until with
+// the archived binlogs and returns what to replay. Run it before
+// restoring the dump so a replay that cannot work fails early.
+func NewPlan(ctx context.Context, cfg *config.Config, from string, until time.Time) (*Plan, error) {
+	m, err := manifest.Fetch(ctx, restore.RemotePath(cfg, from), pipeline.RcloneConfigArgs(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest of %s: %w", from, err)
+	}
+	startFile, startPos := m.Metadata["binlog_file"], m.Metadata["binlog_position"]
+	if startFile == "" || startPos == "" {
+		return nil, fmt.Errorf("%s has no binlog position; take dumps with BACKUP_BINLOG_POSITION=true", from)
+	}
+	if !until.IsZero() && until.Before(m.StartedAt) {
+		return nil, fmt.Errorf("%s was taken at %s, after %s", from, m.StartedAt.Format(time.RFC3339), until.Format(time.RFC3339))
+	}
+
+	entries, err := archive.List(ctx, cfg, retention.BinlogDir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	files, err := selectReplay(names, startFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Plan{From: from, StartPosition: startPos, Files: files, Until: until}, nil
+}
+
+// Replay applies the binlogs of plan to the restored dump. Single-database
+// dumps only replay that database's events, into targetDB if it is set.
+func Replay(ctx context.Context, cfg *config.Config, eng engine.Engine, plan *Plan, targetDB string) error {
+	my, err := mysqlEngine(eng)
+	if err != nil {
+		return err
+	}
+
+	os.MkdirAll(cfg.BackupTempDir, 0o755)
+	dir, err := os.MkdirTemp(cfg.BackupTempDir, "dbstash-binlog-")
+	if err != nil {
+		return fmt.Errorf("creating temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var paths []string
+	for _, name := range plan.Files {
+		path := filepath.Join(dir, name)
+		if err := archive.Fetch(ctx, cfg, retention.BinlogDir, name, path); err != nil {
+			return err
+		}
+		paths = append(paths, path)
+	}
+
+	dbName := ""
+	if !cfg.BackupAllDatabases {
+		dbName = cfg.DBNameOrDefault()
+	}
+	decodeCmd := my.BinlogReplayCommand(paths, plan.StartPosition, plan.Until, dbName, targetDB)
+	loadCmd, err := eng.RestoreCommand(cfg, engine.RestoreOptions{Mode: "stream", TargetDB: targetDB})
+	if err != nil {
+		return err
+	}
+	defer engine.Cleanup(loadCmd)
+
+	// mysqlbinlog decodes the binlogs into SQL → mysql client
+	loadCmd.Stdin, err = decodeCmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("creating pipe: %w", err)
+	}
+	var decodeStderr, loadStderr bytes.Buffer
+	decodeCmd.Stderr = &decodeStderr
+	loadCmd.Stderr = &loadStderr
+
+	logger.Log.Debug().Str("decode_cmd", config.MaskCmdArgs(decodeCmd.Args)).Str("load_cmd", config.MaskCmdArgs(loadCmd.Args)).Msg("replaying binlogs")
+	if err := decodeCmd.Start(); err != nil {
+		return fmt.Errorf("starting mysqlbinlog: %w", err)
+	}
+	if err := loadCmd.Run(); err != nil {
+		decodeCmd.Process.Kill()
+		decodeCmd.Wait()
+		return fmt.Errorf("binlog replay failed: %w (stderr: %s)", err, loadStderr.String())
+	}
+	if err := decodeCmd.Wait(); err != nil {
+		return fmt.Errorf("mysqlbinlog failed: %w (stderr: %s)", err, decodeStderr.String())
+	}
+	return nil
+}
+
+// SelectReplay returns the binlogs to replay from startFile on, in order.
+// Exported for testing.
+func SelectReplay(names []string, startFile string) ([]string, error) {
+	return selectReplay(names, startFile)
+}
+
+// selectReplay picks the archived binlogs from startFile on and checks
+// that none is missing, since replay cannot skip over a gap.
+func selectReplay(names []string, startFile string) ([]string, error) {
+	startBase, startSeq, ok := ParseName(startFile)
+	if !ok {
+		return nil, fmt.Errorf("invalid binlog file name %q", startFile)
+	}
+
+	var files []string
+	next := startSeq
+	for _, name := range sortNames(names) {
+		base, seq, _ := ParseName(name)
+		if base != startBase || seq < startSeq {
+			continue
+		}
+		if seq != next && len(files) == 0 {
+			return nil, fmt.Errorf("%s is not archived", startFile)
+		}
+		if seq != next {
+			return nil, fmt.Errorf("binlog archive has a gap: %s follows %s", name, files[len(files)-1])
+		}
+		files = append(files, name)
+		next++
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s is not archived", startFile)
+	}
+	return files, nil
+}
@@ -0,0 +1,255 @@
+// Package catalog lists the backups a dbstash job has written to the
+// remote, recognizing them by the name template and engine extensions.
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/viperadnan-git/dbstash/internal/compress"
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/engine"
+	"github.com/viperadnan-git/dbstash/internal/manifest"
+	"github.com/viperadnan-git/dbstash/internal/retention"
+)
+
+// Entry is a single backup found on the remote.
+type Entry struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"modtime"`
+	Engine     string    `json:"engine"`
+	Database   string    `json:"database"`
+	Mode       string    `json:"mode"`
+	Compressed bool      `json:"compressed"`
+
+	// Compression is the BACKUP_COMPRESSION algorithm named by the
+	// extension, if any. Compressed reports native compression only.
+	Compression string `json:"compression,omitempty"`
+}
+
+// Filter narrows a listing. Zero values match everything.
+type Filter struct {
+	Since    time.Time
+	Until    time.Time
+	Database string
+}
+
+// List returns the backups on the configured remote that belong to this
+// job, newest first. Objects that don't match the name template and an
+// extension the engine produces are skipped. Backups in the template's
+// subdirectories are listed by their path relative to the remote.
+func List(ctx context.Context, cfg *config.Config, eng engine.Engine) ([]Entry, error) {
+	remote, err := retention.ListBackups(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	matcher, err := NewMatcher(cfg, eng)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, re := range remote {
+		if manifest.IsManifest(re.Path) || retention.IsArchiveDir(re) || retention.InArchiveDir(re.Path) {
+			continue
+		}
+		if entry, ok := matcher.Match(re); ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	Sort(entries, "time", false)
+	return entries, nil
+}
+
+// Matcher recognizes dbstash backups by name.
+type Matcher struct {
+	cfg     *config.Config
+	eng     engine.Engine
+	pattern *regexp.Regexp
+}
+
+// tokenPatterns maps name template tokens to the regular expressions their
+// expansions match. {db} and {engine} are captured.
+var tokenPatterns = map[string]string{
+	"{db}":        `(?P<db>.+?)`,
+	"{engine}":    `(?P<engine>[a-z]+)`,
+	"{date}":      `\d{4}-\d{2}-\d{2}`,
+	"{time}":      `\d{6}`,
+	"{timestamp}": `\d{8}T\d{6}(?:Z|[+-]\d{4})`,
+	"{ts}":        `\d+`,
+	"{uuid}":      `[0-9a-f]{8}`,
+}
+
+var tokenRe = regexp.MustCompile(`\{[a-z]+\}`)
+
+// NewMatcher compiles the BACKUP_NAME_TEMPLATE of cfg into a Matcher.
+func NewMatcher(cfg *config.Config, eng engine.Engine) (*Matcher, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	seen := map[string]bool{}
+	last := 0
+	for _, loc := range tokenRe.FindAllStringIndex(cfg.BackupNameTemplate, -1) {
+		b.WriteString(regexp.QuoteMeta(cfg.BackupNameTemplate[last:loc[0]]))
+		token := cfg.BackupNameTemplate[loc[0]:loc[1]]
+		pattern, ok := tokenPatterns[token]
+		if !ok {
+			pattern = regexp.QuoteMeta(token)
+		} else if seen[token] {
+			// A capture group name may only be used once
+			pattern = strings.Replace(pattern, "?P<"+strings.Trim(token, "{}")+">", "?:", 1)
+		}
+		seen[token] = true
+		b.WriteString(pattern)
+		last = loc[1]
+	}
+	b.WriteString(regexp.QuoteMeta(cfg.BackupNameTemplate[last:]))
+	b.WriteString("$")
+
+	pattern, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("compiling BACKUP_NAME_TEMPLATE %q: %w", cfg.BackupNameTemplate, err)
+	}
+	return &Matcher{cfg: cfg, eng: eng, pattern: pattern}, nil
+}
+
+// Match classifies a remote entry, reporting false if it is not a backup
+// written by this job. The template is matched against the entry's full
+// path, since it may name directories.
+func (m *Matcher) Match(re retention.RemoteEntry) (Entry, bool) {
+	entry := Entry{
+		Name:    re.Path,
+		Size:    re.Size,
+		ModTime: re.ModTime,
+		Engine:  m.eng.Name(),
+	}
+
+	stem := re.Path
+	switch {
+	case re.IsDir:
+		// Compression of a directory's contents can't be seen from its
+		// name; report the job's setting
+		entry.Mode = "directory"
+		entry.Compressed = m.cfg.BackupCompress
+		entry.Size = -1
+	default:
+		ext, mode, compressed, ok := m.extension(stem)
+		if !ok {
+			// The compression extension follows the one the format has
+			var alg string
+			if stem, alg = compress.FromName(stem); alg == "" {
+				return Entry{}, false
+			}
+			if ext, mode, compressed, ok = m.extension(stem); !ok {
+				return Entry{}, false
+			}
+			entry.Compression = alg
+		}
+		entry.Mode = mode
+		entry.Compressed = compressed
+		stem = strings.TrimSuffix(stem, ext)
+	}
+
+	groups := m.pattern.FindStringSubmatch(stem)
+	if groups == nil {
+		return Entry{}, false
+	}
+	entry.Database = m.cfg.DBNameOrDefault()
+	for i, name := range m.pattern.SubexpNames() {
+		switch name {
+		case "db":
+			entry.Database = groups[i]
+		case "engine":
+			entry.Engine = groups[i]
+		}
+	}
+	if entry.Engine != m.eng.Name() {
+		return Entry{}, false
+	}
+
+	return entry, true
+}
+
+// extension returns the engine extension the name ends with, the mode that
+// produces it, and whether it denotes a compressed dump. When stream and
+// file mode share an extension, the job's BACKUP_MODE wins. Tar archives
+// are recognized after the engine extensions, which may be tars themselves
+// (physical pg backups).
+func (m *Matcher) extension(name string) (string, string, bool, bool) {
+	modes := []string{"stream", "file"}
+	if m.cfg.BackupMode == "file" {
+		modes = []string{"file", "stream"}
+	}
+
+	if m.cfg.BackupExtension != "" {
+		ext := m.cfg.BackupExtension
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if strings.HasSuffix(name, ext) {
+			return ext, modes[0], m.cfg.BackupCompress, true
+		}
+	}
+	for _, mode := range modes {
+		for _, compressed := range []bool{false, true} {
+			if ext := m.eng.DefaultExtension(m.cfg, mode, compressed); strings.HasSuffix(name, ext) {
+				return ext, mode, compressed, true
+			}
+		}
+	}
+	switch {
+	case strings.HasSuffix(name, ".tar"):
+		return ".tar", "tar", false, true
+	case strings.HasSuffix(name, ".tar.gz"):
+		return ".tar.gz", "tar", true, true
+	}
+	return "", "", false, false
+}
+
+// Apply returns the entries that pass the filter.
+func Apply(entries []Entry, f Filter) []Entry {
+	var result []Entry
+	for _, e := range entries {
+		if !f.Since.IsZero() && e.ModTime.Before(f.Since) {
+			continue
+		}
+		if !f.Until.IsZero() && e.ModTime.After(f.Until) {
+			continue
+		}
+		if f.Database != "" && e.Database != f.Database {
+			continue
+		}
+		result = append(result, e)
+	}
+	return result
+}
+
+// Sort orders entries by "time" (newest first), "name", or "size" (largest
+// first). reverse inverts the order.
+func Sort(entries []Entry, by string, reverse bool) error {
+	var less func(a, b Entry) bool
+	switch by {
+	case "time", "":
+		less = func(a, b Entry) bool { return a.ModTime.After(b.ModTime) }
+	case "name":
+		less = func(a, b Entry) bool { return a.Name < b.Name }
+	case "size":
+		less = func(a, b Entry) bool { return a.Size > b.Size }
+	default:
+		return fmt.Errorf("invalid sort key %q (valid: time, name, size)", by)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if reverse {
+			return less(entries[j], entries[i])
+		}
+		return less(entries[i], entries[j])
+	})
+	return nil
+}
@@ -0,0 +1,179 @@
+package catalog
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/engine"
+	"github.com/viperadnan-git/dbstash/internal/retention"
+)
+
+func newMatcher(t *testing.T, engineKey, template string) *Matcher {
+	t.Helper()
+	eng, err := engine.New(engineKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := &config.Config{Engine: engineKey, DBName: "app", BackupNameTemplate: template, BackupMode: "stream"}
+	m, err := NewMatcher(cfg, eng)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return m
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		engine     string
+		template   string
+		name       string
+		isDir      bool
+		match      bool
+		database   string
+		mode       string
+		compressed bool
+	}{
+		{"pg", "{db}-{timestamp}", "app-20260207T020000Z.sql", false, true, "app", "stream", false},
+		{"pg", "{db}-{timestamp}", "app-20260207T073000+0530.dump", false, true, "app", "stream", true},
+		{"pg", "{db}-{timestamp}", "my-app-20260207T020000Z.tar.gz", false, true, "my-app", "tar", true},
+		{"pg", "{db}-{timestamp}", "app-20260207T020000Z", true, true, "app", "directory", false},
+		{"pg", "{db}-{timestamp}", "notes.txt", false, false, "", "", false},
+		{"pg", "{db}-{timestamp}", "app-latest.sql", false, false, "", "", false},
+		{"mongo", "{engine}/{db}_{date}_{time}", "mongo/shop_2026-02-07_020000.archive.gz", false, true, "shop", "stream", true},
+		{"mongo", "{engine}-{db}-{ts}", "pg-shop-1770508800.archive", false, false, "", "", false},
+		{"mongo", "{engine}/{db}_{date}_{time}", "shop_2026-02-07_020000.archive.gz", false, false, "", "", false},
+		{"pg", "{db}/{timestamp}", "app/20260207T020000Z", true, true, "app", "directory", false},
+		{"redis", "backup-{uuid}", "backup-019c38fb.rdb", false, true, "app", "stream", false},
+		{"sqlite", "{db}-{timestamp}", "app-20260207T020000Z.sqlite", false, true, "app", "file", false},
+		{"sqlite", "{db}-{timestamp}", "app-20260207T020000Z.sql", false, true, "app", "stream", false},
+		{"mysql", "{db}-{timestamp}", "app-20260207T020000Z.sql.zst", false, true, "app", "stream", false},
+		{"pg", "{db}-{timestamp}", "app-20260207T020000Z.tar.xz", false, true, "app", "tar", false},
+		{"redis", "{db}-{timestamp}", "app-20260207T020000Z.rdb.bz2", false, false, "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMatcher(t, tt.engine, tt.template)
+			entry, ok := m.Match(retention.RemoteEntry{Path: tt.name, Name: path.Base(tt.name), IsDir: tt.isDir})
+			if ok != tt.match {
+				t.Fatalf("Match(%q) matched = %v, want %v", tt.name, ok, tt.match)
+			}
+			if !ok {
+				return
+			}
+			if entry.Database != tt.database {
+				t.Errorf("expected database %q, got %q", tt.database, entry.Database)
+			}
+			if entry.Mode != tt.mode {
+				t.Errorf("expected mode %q, got %q", tt.mode, entry.Mode)
+			}
+			if entry.Compressed != tt.compressed {
+				t.Errorf("expected compressed %v, got %v", tt.compressed, entry.Compressed)
+			}
+		})
+	}
+}
+
+func TestMatch_Physical(t *testing.T) {
+	m := newMatcher(t, "pg", "{db}-{timestamp}")
+	m.cfg.BackupMethod = "physical"
+
+	entry, ok := m.Match(retention.RemoteEntry{Path: "cluster-20260207T020000Z.tar.gz", Name: "cluster-20260207T020000Z.tar.gz"})
+	if !ok {
+		t.Fatal("expected physical backup to match")
+	}
+	if entry.Mode != "stream" || !entry.Compressed {
+		t.Errorf("expected compressed stream backup, got mode %q compressed %v", entry.Mode, entry.Compressed)
+	}
+	if entry.Database != "cluster" {
+		t.Errorf("expected database 'cluster', got %q", entry.Database)
+	}
+}
+
+func TestMatch_Compression(t *testing.T) {
+	m := newMatcher(t, "mongo", "{db}-{timestamp}")
+
+	entry, ok := m.Match(retention.RemoteEntry{Path: "app-20260207T020000Z.archive.zst", Name: "app-20260207T020000Z.archive.zst"})
+	if !ok {
+		t.Fatal("expected zstd backup to match")
+	}
+	if entry.Compression != "zstd" || entry.Compressed || entry.Database != "app" {
+		t.Errorf("expected uncompressed archive in zstd for app, got compression %q compressed %v database %q", entry.Compression, entry.Compressed, entry.Database)
+	}
+
+	// A native .archive.gz is not mistaken for a gzipped .archive
+	entry, ok = m.Match(retention.RemoteEntry{Path: "app-20260207T020000Z.archive.gz", Name: "app-20260207T020000Z.archive.gz"})
+	if !ok || entry.Compression != "" || !entry.Compressed {
+		t.Errorf("expected natively compressed archive, got match %v compression %q compressed %v", ok, entry.Compression, entry.Compressed)
+	}
+}
+
+func TestApply(t *testing.T) {
+	now := time.Now()
+	entries := []Entry{
+		{Name: "a", Database: "app", ModTime: now.Add(-72 * time.Hour)},
+		{Name: "b", Database: "app", ModTime: now.Add(-24 * time.Hour)},
+		{Name: "c", Database: "billing", ModTime: now},
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		expect int
+	}{
+		{"no filter", Filter{}, 3},
+		{"since", Filter{Since: now.Add(-48 * time.Hour)}, 2},
+		{"until", Filter{Until: now.Add(-48 * time.Hour)}, 1},
+		{"database", Filter{Database: "app"}, 2},
+		{"combined", Filter{Since: now.Add(-48 * time.Hour), Database: "app"}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Apply(entries, tt.filter); len(got) != tt.expect {
+				t.Errorf("expected %d entries, got %d", tt.expect, len(got))
+			}
+		})
+	}
+}
+
+func TestSort(t *testing.T) {
+	now := time.Now()
+	entries := []Entry{
+		{Name: "b", Size: 10, ModTime: now.Add(-time.Hour)},
+		{Name: "a", Size: 30, ModTime: now.Add(-2 * time.Hour)},
+		{Name: "c", Size: 20, ModTime: now},
+	}
+
+	tests := []struct {
+		by      string
+		reverse bool
+		expect  string
+	}{
+		{"time", false, "cba"},
+		{"time", true, "abc"},
+		{"name", false, "abc"},
+		{"size", false, "acb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.by, func(t *testing.T) {
+			if err := Sort(entries, tt.by, tt.reverse); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got string
+			for _, e := range entries {
+				got += e.Name
+			}
+			if got != tt.expect {
+				t.Errorf("expected order %q, got %q", tt.expect, got)
+			}
+		})
+	}
+
+	if err := Sort(entries, "bogus", false); err == nil {
+		t.Error("expected error for invalid sort key")
+	}
+}
@@ -0,0 +1,183 @@
+// Package compress implements the compression stage the backup pipelines
+// wrap around dump output (BACKUP_COMPRESSION), independently of any
+// compression the engine's dump tool does itself.
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Supported algorithms.
+const (
+	Gzip = "gzip"
+	Zstd = "zstd"
+	XZ   = "xz"
+)
+
+// algorithm describes one codec: the extension appended to backup names,
+// the magic bytes its streams start with, and its level range.
+type algorithm struct {
+	ext      string
+	magic    []byte
+	min, max int
+}
+
+var algorithms = map[string]algorithm{
+	Gzip: {ext: ".gz", magic: []byte{0x1f, 0x8b}, min: 1, max: 9},
+	Zstd: {ext: ".zst", magic: []byte{0x28, 0xb5, 0x2f, 0xfd}, min: 1, max: 22},
+	XZ:   {ext: ".xz", magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, min: 1, max: 9},
+}
+
+// xzDictCaps are the dictionary sizes of the xz command's presets 1-9.
+var xzDictCaps = [10]int{0, 1 << 20, 2 << 20, 4 << 20, 4 << 20, 8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20}
+
+// Parse splits an "algorithm[:level]" spec such as "zstd:6". An empty spec
+// or "none" disables compression. Level 0 selects the algorithm's default.
+func Parse(spec string) (string, int, error) {
+	name, levelStr, hasLevel := strings.Cut(strings.ToLower(strings.TrimSpace(spec)), ":")
+	if name == "" || name == "none" {
+		if hasLevel {
+			return "", 0, fmt.Errorf("compression level given without an algorithm")
+		}
+		return "", 0, nil
+	}
+	alg, ok := algorithms[name]
+	if !ok {
+		return "", 0, fmt.Errorf("unsupported algorithm %q (valid: gzip, zstd, xz)", name)
+	}
+	if !hasLevel {
+		return name, 0, nil
+	}
+	level, err := strconv.Atoi(levelStr)
+	if err != nil || level < alg.min || level > alg.max {
+		return "", 0, fmt.Errorf("invalid %s level %q (valid: %d-%d)", name, levelStr, alg.min, alg.max)
+	}
+	return name, level, nil
+}
+
+// Extension returns the extension appended to names compressed with alg,
+// or an empty string for no compression.
+func Extension(alg string) string {
+	return algorithms[alg].ext
+}
+
+// FromName returns name without its compression extension and the
+// algorithm the extension denotes, or name unchanged and an empty string
+// if it has none.
+func FromName(name string) (string, string) {
+	for n, alg := range algorithms {
+		if strings.HasSuffix(name, alg.ext) {
+			return strings.TrimSuffix(name, alg.ext), n
+		}
+	}
+	return name, ""
+}
+
+// Detect returns the algorithm whose magic bytes head starts with, or an
+// empty string if none does.
+func Detect(head []byte) string {
+	for n, alg := range algorithms {
+		if bytes.HasPrefix(head, alg.magic) {
+			return n
+		}
+	}
+	return ""
+}
+
+// MagicSize is the number of bytes Detect needs to recognize every
+// algorithm.
+const MagicSize = 6
+
+// NewWriter returns a writer that compresses to w with alg at level, as
+// returned by Parse. Nothing is written to w before the first Write or
+// Close. Close flushes the compressed stream but does not close w.
+func NewWriter(w io.Writer, alg string, level int) (io.WriteCloser, error) {
+	switch alg {
+	case Gzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	case Zstd:
+		var opts []zstd.EOption
+		if level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		return zstd.NewWriter(w, opts...)
+	case XZ:
+		// Level 0 leaves DictCap unset, which selects the default 8 MiB
+		wc := xz.WriterConfig{DictCap: xzDictCaps[level]}
+		if err := wc.Verify(); err != nil {
+			return nil, err
+		}
+		return &xzWriter{w: w, config: wc}, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression algorithm %q", alg)
+	}
+}
+
+// xzWriter defers writing the xz stream header to the first Write or
+// Close, as gzip and zstd do, so a writer can be set up in front of a pipe
+// before anything reads from it.
+type xzWriter struct {
+	w      io.Writer
+	config xz.WriterConfig
+	xw     *xz.Writer
+}
+
+func (x *xzWriter) start() error {
+	if x.xw != nil {
+		return nil
+	}
+	xw, err := x.config.NewWriter(x.w)
+	if err != nil {
+		return err
+	}
+	x.xw = xw
+	return nil
+}
+
+func (x *xzWriter) Write(p []byte) (int, error) {
+	if err := x.start(); err != nil {
+		return 0, err
+	}
+	return x.xw.Write(p)
+}
+
+func (x *xzWriter) Close() error {
+	if err := x.start(); err != nil {
+		return err
+	}
+	return x.xw.Close()
+}
+
+// NewReader returns a reader that decompresses the alg stream read from r.
+// It reads the stream header before returning.
+func NewReader(r io.Reader, alg string) (io.ReadCloser, error) {
+	switch alg {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case XZ:
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xr), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression algorithm %q", alg)
+	}
+}
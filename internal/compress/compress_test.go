@@ -0,0 +1,98 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		alg     string
+		level   int
+		wantErr bool
+	}{
+		{"", "", 0, false},
+		{"none", "", 0, false},
+		{"gzip", Gzip, 0, false},
+		{"zstd:6", Zstd, 6, false},
+		{" XZ:9 ", XZ, 9, false},
+		{"zstd:22", Zstd, 22, false},
+		{"gzip:0", "", 0, true},
+		{"xz:10", "", 0, true},
+		{"zstd:", "", 0, true},
+		{"none:3", "", 0, true},
+		{"lz4", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			alg, level, err := Parse(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if alg != tt.alg || level != tt.level {
+				t.Errorf("Parse(%q) = %q, %d; want %q, %d", tt.spec, alg, level, tt.alg, tt.level)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	content := []byte(strings.Repeat("INSERT INTO t VALUES (1, 'row');\n", 1000))
+
+	for _, alg := range []string{Gzip, Zstd, XZ} {
+		for _, level := range []int{0, 1, 9} {
+			var buf bytes.Buffer
+			zw, err := NewWriter(&buf, alg, level)
+			if err != nil {
+				t.Fatalf("%s:%d: %v", alg, level, err)
+			}
+			zw.Write(content)
+			if err := zw.Close(); err != nil {
+				t.Fatalf("%s:%d: closing: %v", alg, level, err)
+			}
+			if buf.Len() >= len(content) {
+				t.Errorf("%s:%d: expected output smaller than %d bytes, got %d", alg, level, len(content), buf.Len())
+			}
+			if got := Detect(buf.Bytes()[:MagicSize]); got != alg {
+				t.Errorf("%s:%d: Detect returned %q", alg, level, got)
+			}
+
+			zr, err := NewReader(&buf, alg)
+			if err != nil {
+				t.Fatalf("%s:%d: %v", alg, level, err)
+			}
+			got, err := io.ReadAll(zr)
+			zr.Close()
+			if err != nil {
+				t.Fatalf("%s:%d: reading: %v", alg, level, err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("%s:%d: round trip changed the content", alg, level)
+			}
+		}
+	}
+}
+
+func TestFromName(t *testing.T) {
+	tests := []struct {
+		name string
+		stem string
+		alg  string
+	}{
+		{"app.sql.zst", "app.sql", Zstd},
+		{"app.tar.xz", "app.tar", XZ},
+		{"app.rdb.gz", "app.rdb", Gzip},
+		{"app.sql", "app.sql", ""},
+	}
+
+	for _, tt := range tests {
+		stem, alg := FromName(tt.name)
+		if stem != tt.stem || alg != tt.alg {
+			t.Errorf("FromName(%q) = %q, %q; want %q, %q", tt.name, stem, alg, tt.stem, tt.alg)
+		}
+	}
+}
@@ -5,17 +5,21 @@ package config
 import (
 	"encoding/base64"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/robfig/cron/v3"
+
+	"github.com/viperadnan-git/dbstash/internal/compress"
 )
 
 // Config holds all parsed and validated configuration for a dbstash run.
 type Config struct {
-	// Engine is the database engine key (pg, mongo, mysql, mariadb, redis).
+	// Engine is the database engine key (pg, mongo, mysql, mariadb, redis,
+	// sqlite).
 	Engine string
 
 	// Connection
@@ -26,6 +30,21 @@ type Config struct {
 	DBUser       string
 	DBPassword   string
 	DBAuthSource string
+	DBPath       string // SQLite database file
+
+	// TLS: the mode (disable, prefer, require, verify-ca, verify-full), the
+	// CA that signs the server certificate, and the client certificate and key
+	DBTLSMode     string
+	DBTLSCAFile   string
+	DBTLSCertFile string
+	DBTLSKeyFile  string
+
+	// SSH tunnel: the bastion (host[:port]), the user, the private key
+	// content, and the known_hosts file that verifies the bastion
+	DBSSHHost           string
+	DBSSHUser           string
+	DBSSHKey            string
+	DBSSHKnownHostsFile string
 
 	// Rclone
 	RcloneRemote     string
@@ -35,6 +54,7 @@ type Config struct {
 	// Schedule & Naming
 	BackupSchedule     string
 	BackupMode         string
+	BackupMethod       string // logical (dump tool) or physical (pg_basebackup, xtrabackup)
 	BackupNameTemplate string
 	BackupCompress     bool
 	BackupExtension    string
@@ -43,10 +63,67 @@ type Config struct {
 	DumpExtraArgs      string
 	Timezone           string
 
+	// BackupCompression is the pipeline compression as given
+	// (algorithm[:level]); PrepareCatalog parses it into
+	// CompressionAlgorithm (gzip, zstd, xz, or empty for none) and
+	// CompressionLevel (0 for the algorithm's default)
+	BackupCompression    string
+	CompressionAlgorithm string
+	CompressionLevel     int
+
+	// DumpTool selects the mysql/mariadb dump tool: mysqldump,
+	// mariadb-dump, mysqlpump, or mydumper (default: mysqldump under the
+	// name the engine's client tools are installed as)
+	DumpTool string
+
+	// BackupSplitDatabases turns an all-databases backup into one backup
+	// per database, plus the server-wide globals for pg
+	BackupSplitDatabases bool
+
+	// BackupInclude and BackupExclude are comma-separated glob patterns
+	// selecting the tables or collections to dump; in all-databases mode
+	// their first dot-separated part selects databases
+	BackupInclude string
+	BackupExclude string
+
+	// BackupParallelism is the number of parallel dump jobs, mapped to
+	// the dump tool's own option (0 = the tool's default)
+	BackupParallelism int
+
+	// BackupBinlogPosition records the binlog coordinates of each
+	// mysql/mariadb dump, the starting point for binlog replay
+	BackupBinlogPosition bool
+
+	// BackupOplog captures the oplog during mongo dumps of the whole
+	// deployment and records where oplog replay starts
+	BackupOplog bool
+
+	// RedisSentinelMaster is the service name of the master to look up
+	// through the Sentinel at DB_URI/DB_HOST; RedisSentinelRole picks the
+	// master or one of its replicas to back up
+	RedisSentinelMaster string
+	RedisSentinelRole   string
+
+	// RedisCluster backs up every master shard of a Redis Cluster as its
+	// own object. RedisNode is the host:port of the one shard a config
+	// returned by ForShard backs up
+	RedisCluster bool
+	RedisNode    string
+
 	// Retention
 	RetentionMaxFiles int
 	RetentionMaxDays  int
 
+	// Verification: cron expression for verifying the newest backup
+	// (empty = disabled)
+	VerifySchedule string
+
+	// Restore drills: cron expression (empty = disabled), the scratch
+	// database restored into, and sanity queries run against it
+	DrillSchedule string
+	DrillTargetDB string
+	DrillQueries  string
+
 	// Notifications
 	NotifyWebhookURL string
 	NotifyOn         string
@@ -64,6 +141,13 @@ type Config struct {
 	BackupLock    bool
 	DryRun        bool
 
+	// Pre-flight check: ping the database before each backup, retrying
+	// PreflightRetries times with a delay that starts at PreflightBackoff
+	// and doubles after each attempt
+	PreflightCheck   bool
+	PreflightRetries int
+	PreflightBackoff time.Duration
+
 	// Backup temp directory for directory/tar modes
 	BackupTempDir string
 
@@ -76,14 +160,8 @@ type Config struct {
 // or any value is invalid. Both Load() and CLI mode call this after
 // populating the Config struct.
 func (c *Config) Prepare() error {
-	// Engine
-	c.Engine = strings.ToLower(c.Engine)
-	if c.Engine == "" {
-		return fmt.Errorf("ENGINE is required")
-	}
-	validEngines := map[string]bool{"pg": true, "mongo": true, "mysql": true, "mariadb": true, "redis": true}
-	if !validEngines[c.Engine] {
-		return fmt.Errorf("unsupported ENGINE: %q (valid: pg, mongo, mysql, mariadb, redis)", c.Engine)
+	if err := c.PrepareCatalog(); err != nil {
+		return err
 	}
 
 	// All-databases vs DB_NAME mutual exclusion
@@ -91,14 +169,181 @@ func (c *Config) Prepare() error {
 		return fmt.Errorf("DB_NAME and BACKUP_ALL_DATABASES are mutually exclusive")
 	}
 
+	// Physical backups always copy the whole cluster
+	if c.BackupMethod == "physical" && c.BackupAllDatabases {
+		return fmt.Errorf("BACKUP_ALL_DATABASES does not apply to physical backups, which always copy the whole cluster")
+	}
+
+	// Dump tool
+	c.DumpTool = strings.ToLower(c.DumpTool)
+	if c.DumpTool != "" {
+		if c.Engine != "mysql" && c.Engine != "mariadb" {
+			return fmt.Errorf("DUMP_TOOL is only supported for mysql and mariadb")
+		}
+		if c.BackupMethod == "physical" {
+			return fmt.Errorf("DUMP_TOOL does not apply to physical backups, which use xtrabackup or mariabackup")
+		}
+		switch c.DumpTool {
+		case "mysqldump", "mariadb-dump":
+		case "mysqlpump":
+			if c.BackupMode != "stream" && c.BackupMode != "file" {
+				return fmt.Errorf("DUMP_TOOL=mysqlpump requires BACKUP_MODE=stream or file (got %q)", c.BackupMode)
+			}
+		case "mydumper":
+			// mydumper writes one file per table
+			if c.BackupMode != "directory" && c.BackupMode != "tar" {
+				return fmt.Errorf("DUMP_TOOL=mydumper requires BACKUP_MODE=directory or tar (got %q)", c.BackupMode)
+			}
+		default:
+			return fmt.Errorf("invalid DUMP_TOOL %q (valid: mysqldump, mariadb-dump, mysqlpump, mydumper)", c.DumpTool)
+		}
+	}
+
+	// Binlog coordinates are read from the head of a single SQL dump
+	if c.BackupBinlogPosition {
+		if c.Engine != "mysql" && c.Engine != "mariadb" {
+			return fmt.Errorf("BACKUP_BINLOG_POSITION is only supported for mysql and mariadb")
+		}
+		if c.BackupMode != "stream" && c.BackupMode != "file" {
+			return fmt.Errorf("BACKUP_BINLOG_POSITION requires BACKUP_MODE=stream or file (got %q)", c.BackupMode)
+		}
+		if c.DumpTool == "mysqlpump" {
+			return fmt.Errorf("BACKUP_BINLOG_POSITION is not supported with DUMP_TOOL=mysqlpump")
+		}
+		if c.BackupMethod == "physical" {
+			return fmt.Errorf("BACKUP_BINLOG_POSITION does not apply to physical backups")
+		}
+	}
+
+	// Each database of a split backup is named through {db}
+	if c.BackupSplitDatabases {
+		if c.Engine != "pg" && c.Engine != "mongo" && c.Engine != "mysql" && c.Engine != "mariadb" {
+			return fmt.Errorf("BACKUP_SPLIT_DATABASES is only supported for pg, mongo, mysql, and mariadb")
+		}
+		if !c.BackupAllDatabases {
+			return fmt.Errorf("BACKUP_SPLIT_DATABASES requires BACKUP_ALL_DATABASES=true")
+		}
+		if !strings.Contains(c.BackupNameTemplate, "{db}") {
+			return fmt.Errorf("BACKUP_SPLIT_DATABASES requires {db} in BACKUP_NAME_TEMPLATE so each database gets its own name")
+		}
+		if c.BackupOplog {
+			return fmt.Errorf("BACKUP_SPLIT_DATABASES cannot be combined with BACKUP_OPLOG, which captures the whole deployment")
+		}
+	}
+
+	// Include/exclude filters are translated per dump tool
+	if c.HasFilters() {
+		if err := validatePatterns("BACKUP_INCLUDE", c.BackupInclude); err != nil {
+			return err
+		}
+		if err := validatePatterns("BACKUP_EXCLUDE", c.BackupExclude); err != nil {
+			return err
+		}
+		if c.Engine != "pg" && c.Engine != "mongo" && c.Engine != "mysql" && c.Engine != "mariadb" {
+			return fmt.Errorf("BACKUP_INCLUDE and BACKUP_EXCLUDE are only supported for pg, mongo, mysql, and mariadb")
+		}
+		if c.BackupMethod == "physical" {
+			return fmt.Errorf("BACKUP_INCLUDE and BACKUP_EXCLUDE do not apply to physical backups, which always copy the whole cluster")
+		}
+		if c.BackupAllDatabases && !c.BackupSplitDatabases {
+			return fmt.Errorf("BACKUP_INCLUDE and BACKUP_EXCLUDE with BACKUP_ALL_DATABASES require BACKUP_SPLIT_DATABASES=true")
+		}
+	}
+
+	// Parallel dumps use the dump tool's own workers
+	if c.BackupParallelism < 0 {
+		return fmt.Errorf("BACKUP_PARALLELISM must not be negative (got %d)", c.BackupParallelism)
+	}
+	if c.BackupParallelism > 0 {
+		if c.BackupMethod == "physical" && c.Engine == "pg" {
+			return fmt.Errorf("BACKUP_PARALLELISM does not apply to physical pg backups")
+		}
+		switch c.Engine {
+		case "pg":
+			// pg_dump can only run parallel jobs into a directory format dump
+			if c.BackupMode != "directory" && c.BackupMode != "tar" {
+				return fmt.Errorf("BACKUP_PARALLELISM for pg requires BACKUP_MODE=directory or tar (got %q)", c.BackupMode)
+			}
+			if c.BackupAllDatabases && !c.BackupSplitDatabases {
+				return fmt.Errorf("BACKUP_PARALLELISM with BACKUP_ALL_DATABASES requires BACKUP_SPLIT_DATABASES=true (pg_dumpall has no parallel mode)")
+			}
+		case "mongo":
+		case "mysql", "mariadb":
+			// mysqldump is single-threaded
+			if c.BackupMethod != "physical" && c.DumpTool != "mydumper" && c.DumpTool != "mysqlpump" {
+				return fmt.Errorf("BACKUP_PARALLELISM for %s requires DUMP_TOOL=mydumper or mysqlpump, or BACKUP_METHOD=physical", c.Engine)
+			}
+		default:
+			return fmt.Errorf("BACKUP_PARALLELISM is only supported for pg, mongo, mysql, and mariadb")
+		}
+	}
+
+	// Redis topologies: the server to dump is discovered at backup time
+	c.RedisSentinelRole = strings.ToLower(c.RedisSentinelRole)
+	switch c.RedisSentinelRole {
+	case "":
+		c.RedisSentinelRole = "master"
+	case "master", "replica":
+	default:
+		return fmt.Errorf("invalid REDIS_SENTINEL_ROLE %q (valid: master, replica)", c.RedisSentinelRole)
+	}
+	if c.RedisSentinelMaster != "" || c.RedisCluster {
+		if c.Engine != "redis" {
+			return fmt.Errorf("REDIS_SENTINEL_MASTER and REDIS_CLUSTER are only supported for redis")
+		}
+		if c.RedisSentinelMaster != "" && c.RedisCluster {
+			return fmt.Errorf("REDIS_SENTINEL_MASTER and REDIS_CLUSTER are mutually exclusive")
+		}
+		if c.RedisCluster && !strings.Contains(c.BackupNameTemplate, "{db}") {
+			return fmt.Errorf("REDIS_CLUSTER requires {db} in BACKUP_NAME_TEMPLATE so each shard gets its own name")
+		}
+	}
+
+	// mongodump --oplog only works on the whole deployment
+	if c.BackupOplog {
+		if c.Engine != "mongo" {
+			return fmt.Errorf("BACKUP_OPLOG is only supported for mongo")
+		}
+		if !c.BackupAllDatabases {
+			return fmt.Errorf("BACKUP_OPLOG requires BACKUP_ALL_DATABASES=true")
+		}
+	}
+
 	// Connection
-	if c.DBURI == "" && (c.DBHost == "" || (c.DBName == "" && !c.BackupAllDatabases)) {
+	if c.Engine == "sqlite" {
+		if c.DBPath == "" {
+			return fmt.Errorf("DB_PATH is required for sqlite")
+		}
+		if c.BackupAllDatabases {
+			return fmt.Errorf("BACKUP_ALL_DATABASES is not supported for sqlite")
+		}
+	} else if c.BackupMethod == "physical" {
+		if c.DBURI == "" && c.DBHost == "" {
+			return fmt.Errorf("either DB_URI (or DB_URI_FILE) or DB_HOST must be set")
+		}
+	} else if c.DBURI == "" && (c.DBHost == "" || (c.DBName == "" && !c.BackupAllDatabases)) {
 		return fmt.Errorf("either DB_URI (or DB_URI_FILE) or DB_HOST + DB_NAME (or BACKUP_ALL_DATABASES=true) must be set")
 	}
 
-	// Rclone remote
-	if c.RcloneRemote == "" {
-		return fmt.Errorf("RCLONE_REMOTE is required")
+	// TLS
+	c.DBTLSMode = strings.ToLower(c.DBTLSMode)
+	switch c.DBTLSMode {
+	case "", "disable", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		return fmt.Errorf("DB_TLS_MODE must be one of disable, prefer, require, verify-ca, or verify-full (got %q)", c.DBTLSMode)
+	}
+	if c.DBTLSMode != "" || c.HasTLSFiles() {
+		if err := c.validateTLS(); err != nil {
+			return err
+		}
+	}
+
+	// Pre-flight check
+	if c.PreflightRetries < 0 {
+		return fmt.Errorf("PREFLIGHT_RETRIES must not be negative (got %d)", c.PreflightRetries)
+	}
+	if c.PreflightBackoff < 0 {
+		return fmt.Errorf("PREFLIGHT_BACKOFF must not be negative (got %s)", c.PreflightBackoff)
 	}
 
 	// Schedule
@@ -112,11 +357,23 @@ func (c *Config) Prepare() error {
 		}
 	}
 
-	// Backup mode
-	c.BackupMode = strings.ToLower(c.BackupMode)
-	validModes := map[string]bool{"stream": true, "directory": true, "tar": true, "file": true}
-	if !validModes[c.BackupMode] {
-		return fmt.Errorf("invalid BACKUP_MODE %q (valid: stream, directory, tar, file)", c.BackupMode)
+	// Verification
+	if c.VerifySchedule != "" {
+		parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+		if _, err := parser.Parse(c.VerifySchedule); err != nil {
+			return fmt.Errorf("invalid VERIFY_SCHEDULE %q: %w", c.VerifySchedule, err)
+		}
+	}
+
+	// Restore drills
+	if c.DrillSchedule != "" {
+		parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+		if _, err := parser.Parse(c.DrillSchedule); err != nil {
+			return fmt.Errorf("invalid DRILL_SCHEDULE %q: %w", c.DrillSchedule, err)
+		}
+		if err := c.ValidateDrill(); err != nil {
+			return err
+		}
 	}
 
 	// Notifications
@@ -129,6 +386,199 @@ func (c *Config) Prepare() error {
 	return nil
 }
 
+// ValidateDrill checks that a restore drill can run with this config. The
+// scratch target must be set and must not be the backed-up database.
+func (c *Config) ValidateDrill() error {
+	if c.Engine == "redis" {
+		return fmt.Errorf("restore drills are not supported for redis")
+	}
+	if c.BackupAllDatabases && !c.BackupSplitDatabases {
+		return fmt.Errorf("restore drills need a single-database backup; BACKUP_ALL_DATABASES is set without BACKUP_SPLIT_DATABASES")
+	}
+	if c.BackupMethod == "physical" {
+		return fmt.Errorf("restore drills are not supported for physical backups")
+	}
+	if c.DrillTargetDB == "" {
+		return fmt.Errorf("DRILL_TARGET_DB is required for restore drills")
+	}
+	if c.DrillTargetDB == c.DBNameOrDefault() || (c.Engine == "sqlite" && filepath.Clean(c.DrillTargetDB) == filepath.Clean(c.DBPath)) {
+		return fmt.Errorf("DRILL_TARGET_DB must differ from the backed-up database %q", c.DrillTargetDB)
+	}
+	return nil
+}
+
+// PrepareCatalog validates only the fields needed to work with backups
+// already on the remote (engine, RCLONE_REMOTE, BACKUP_MODE,
+// BACKUP_METHOD, BACKUP_COMPRESSION) and the SSH tunnel settings, so
+// commands such as list can run without database connection settings.
+func (c *Config) PrepareCatalog() error {
+	// Engine
+	c.Engine = strings.ToLower(c.Engine)
+	if c.Engine == "" {
+		return fmt.Errorf("ENGINE is required")
+	}
+	validEngines := map[string]bool{"pg": true, "mongo": true, "mysql": true, "mariadb": true, "redis": true, "sqlite": true}
+	if !validEngines[c.Engine] {
+		return fmt.Errorf("unsupported ENGINE: %q (valid: pg, mongo, mysql, mariadb, redis, sqlite)", c.Engine)
+	}
+
+	// Rclone remote
+	if c.RcloneRemote == "" {
+		return fmt.Errorf("RCLONE_REMOTE is required")
+	}
+
+	// Backup mode
+	c.BackupMode = strings.ToLower(c.BackupMode)
+	validModes := map[string]bool{"stream": true, "directory": true, "tar": true, "file": true}
+	if !validModes[c.BackupMode] {
+		return fmt.Errorf("invalid BACKUP_MODE %q (valid: stream, directory, tar, file)", c.BackupMode)
+	}
+
+	// Backup method
+	c.BackupMethod = strings.ToLower(c.BackupMethod)
+	switch c.BackupMethod {
+	case "":
+		c.BackupMethod = "logical"
+	case "logical":
+	case "physical":
+		if c.Engine != "pg" && c.Engine != "mysql" && c.Engine != "mariadb" {
+			return fmt.Errorf("BACKUP_METHOD=physical is only supported for pg, mysql, and mariadb")
+		}
+		if c.BackupMode != "stream" {
+			return fmt.Errorf("BACKUP_METHOD=physical requires BACKUP_MODE=stream (got %q)", c.BackupMode)
+		}
+	default:
+		return fmt.Errorf("invalid BACKUP_METHOD %q (valid: logical, physical)", c.BackupMethod)
+	}
+
+	// SSH tunnel
+	if c.DBSSHHost != "" || c.DBSSHUser != "" || c.DBSSHKey != "" {
+		if err := c.validateSSH(); err != nil {
+			return err
+		}
+	}
+
+	// Pipeline compression
+	alg, level, err := compress.Parse(c.BackupCompression)
+	if err != nil {
+		return fmt.Errorf("invalid BACKUP_COMPRESSION %q: %w", c.BackupCompression, err)
+	}
+	if alg != "" && c.BackupMode == "directory" {
+		return fmt.Errorf("BACKUP_COMPRESSION requires BACKUP_MODE=stream, file, or tar (got %q)", c.BackupMode)
+	}
+	c.CompressionAlgorithm, c.CompressionLevel = alg, level
+
+	return nil
+}
+
+// HasTLSFiles reports whether a TLS CA or client certificate is set.
+func (c *Config) HasTLSFiles() bool {
+	return c.DBTLSCAFile != "" || c.DBTLSCertFile != "" || c.DBTLSKeyFile != ""
+}
+
+// validateTLS checks the TLS settings against what the engine's tools can
+// do. The files are read by the tools, so they are only checked to exist.
+func (c *Config) validateTLS() error {
+	switch c.Engine {
+	case "sqlite":
+		return fmt.Errorf("DB_TLS_* settings do not apply to sqlite")
+	case "mongo", "redis":
+		if c.DBTLSMode == "prefer" {
+			return fmt.Errorf("DB_TLS_MODE=prefer is not supported for %s; use disable or require", c.Engine)
+		}
+	}
+	if c.DBTLSMode == "disable" && (c.HasTLSFiles() || strings.HasPrefix(c.DBURI, "rediss://")) {
+		return fmt.Errorf("DB_TLS_MODE=disable conflicts with the other TLS settings")
+	}
+
+	// The database tools read the client key from the certificate file
+	if c.Engine == "mongo" {
+		if c.DBTLSKeyFile != "" {
+			return fmt.Errorf("mongo reads the client key from DB_TLS_CERT_FILE; put the certificate and key in one PEM file and leave DB_TLS_KEY_FILE unset")
+		}
+	} else if (c.DBTLSCertFile == "") != (c.DBTLSKeyFile == "") {
+		return fmt.Errorf("DB_TLS_CERT_FILE and DB_TLS_KEY_FILE must be set together")
+	}
+
+	for _, file := range []struct{ name, path string }{
+		{"DB_TLS_CA_FILE", c.DBTLSCAFile},
+		{"DB_TLS_CERT_FILE", c.DBTLSCertFile},
+		{"DB_TLS_KEY_FILE", c.DBTLSKeyFile},
+	} {
+		if file.path == "" {
+			continue
+		}
+		if _, err := os.Stat(file.path); err != nil {
+			return fmt.Errorf("%s: %w", file.name, err)
+		}
+	}
+	return nil
+}
+
+// validateSSH checks that the tunnel has a bastion, user, and key, and that
+// the engine connects over TCP to a single host. A MongoDB replica set is
+// rejected because the driver would connect to the members it discovers
+// directly, bypassing the tunnel.
+func (c *Config) validateSSH() error {
+	if c.DBSSHHost == "" {
+		return fmt.Errorf("DB_SSH_USER and DB_SSH_KEY_FILE require DB_SSH_HOST")
+	}
+	if c.DBSSHUser == "" || c.DBSSHKey == "" {
+		return fmt.Errorf("DB_SSH_HOST requires DB_SSH_USER and DB_SSH_KEY (or DB_SSH_KEY_FILE)")
+	}
+	if c.Engine == "sqlite" {
+		return fmt.Errorf("DB_SSH_HOST does not apply to sqlite")
+	}
+	if c.RedisSentinelMaster != "" || c.RedisCluster {
+		return fmt.Errorf("DB_SSH_HOST cannot be combined with REDIS_SENTINEL_MASTER or REDIS_CLUSTER")
+	}
+	if c.Engine == "mongo" && c.DBURI != "" {
+		u, err := url.Parse(c.DBURI)
+		if err != nil {
+			return fmt.Errorf("parsing DB_URI: %w", err)
+		}
+		if u.Query().Has("replicaSet") {
+			return fmt.Errorf("DB_SSH_HOST cannot tunnel a replica set connection; remove replicaSet from DB_URI")
+		}
+	}
+	if c.verifiesHostname() {
+		return fmt.Errorf("DB_SSH_HOST cannot be combined with TLS hostname verification: the tools connect to 127.0.0.1, which the server certificate does not name; use DB_TLS_MODE=verify-ca")
+	}
+	if c.DBSSHKnownHostsFile != "" {
+		if _, err := os.Stat(c.DBSSHKnownHostsFile); err != nil {
+			return fmt.Errorf("DB_SSH_KNOWN_HOSTS_FILE: %w", err)
+		}
+	}
+	return nil
+}
+
+// verifiesHostname reports whether the tools check that the server
+// certificate names the host they connect to: DB_TLS_MODE=verify-full,
+// or the equivalent option in DB_URI. MongoDB's tools also check it
+// whenever TLS is on without DB_TLS_MODE.
+func (c *Config) verifiesHostname() bool {
+	if strings.EqualFold(c.DBTLSMode, "verify-full") && c.Engine != "redis" {
+		return true
+	}
+	var query url.Values
+	if _, rawQuery, ok := strings.Cut(c.DBURI, "?"); ok {
+		query, _ = url.ParseQuery(rawQuery)
+	}
+	switch c.Engine {
+	case "pg":
+		return query.Get("sslmode") == "verify-full"
+	case "mysql", "mariadb":
+		return strings.EqualFold(query.Get("ssl-mode"), "VERIFY_IDENTITY")
+	case "mongo":
+		if c.DBTLSMode != "" {
+			return false
+		}
+		tlsOn := c.HasTLSFiles() || query.Get("tls") == "true" || query.Get("ssl") == "true"
+		return tlsOn && query.Get("tlsInsecure") != "true" && query.Get("tlsAllowInvalidHostnames") != "true"
+	}
+	return false
+}
+
 // Load reads environment variables, resolves _FILE variants, and returns
 // a validated Config. It returns an error if required variables are missing
 // or values are invalid.
@@ -144,6 +594,15 @@ func Load() (*Config, error) {
 	cfg.DBUser = envOrDefault("DB_USER", "")
 	cfg.DBPassword = resolveFileVar("DB_PASSWORD", "DB_PASSWORD_FILE")
 	cfg.DBAuthSource = envOrDefault("DB_AUTH_SOURCE", "admin")
+	cfg.DBPath = envOrDefault("DB_PATH", "")
+	cfg.DBTLSMode = envOrDefault("DB_TLS_MODE", "")
+	cfg.DBTLSCAFile = envOrDefault("DB_TLS_CA_FILE", "")
+	cfg.DBTLSCertFile = envOrDefault("DB_TLS_CERT_FILE", "")
+	cfg.DBTLSKeyFile = envOrDefault("DB_TLS_KEY_FILE", "")
+	cfg.DBSSHHost = envOrDefault("DB_SSH_HOST", "")
+	cfg.DBSSHUser = envOrDefault("DB_SSH_USER", "")
+	cfg.DBSSHKey = resolveFileVar("DB_SSH_KEY", "DB_SSH_KEY_FILE")
+	cfg.DBSSHKnownHostsFile = envOrDefault("DB_SSH_KNOWN_HOSTS_FILE", "")
 
 	// Rclone
 	cfg.RcloneRemote = envOrDefault("RCLONE_REMOTE", "")
@@ -160,12 +619,24 @@ func Load() (*Config, error) {
 	// Schedule & Naming
 	cfg.BackupSchedule = envOrDefault("BACKUP_SCHEDULE", "0 2 * * *")
 	cfg.BackupMode = envOrDefault("BACKUP_MODE", "stream")
+	cfg.BackupMethod = envOrDefault("BACKUP_METHOD", "logical")
 	cfg.BackupNameTemplate = envOrDefault("BACKUP_NAME_TEMPLATE", "{db}-{timestamp}")
 	cfg.BackupCompress = strings.EqualFold(envOrDefault("BACKUP_COMPRESS", "false"), "true")
 	cfg.BackupExtension = envOrDefault("BACKUP_EXTENSION", "")
+	cfg.BackupCompression = envOrDefault("BACKUP_COMPRESSION", "")
 	cfg.BackupOnStart = strings.EqualFold(envOrDefault("BACKUP_ON_START", "false"), "true")
 	cfg.BackupAllDatabases = strings.EqualFold(envOrDefault("BACKUP_ALL_DATABASES", "false"), "true")
 	cfg.DumpExtraArgs = envOrDefault("DUMP_EXTRA_ARGS", "")
+	cfg.DumpTool = envOrDefault("DUMP_TOOL", "")
+	cfg.RedisSentinelMaster = envOrDefault("REDIS_SENTINEL_MASTER", "")
+	cfg.RedisSentinelRole = envOrDefault("REDIS_SENTINEL_ROLE", "master")
+	cfg.RedisCluster = strings.EqualFold(envOrDefault("REDIS_CLUSTER", "false"), "true")
+	cfg.BackupSplitDatabases = strings.EqualFold(envOrDefault("BACKUP_SPLIT_DATABASES", "false"), "true")
+	cfg.BackupInclude = envOrDefault("BACKUP_INCLUDE", "")
+	cfg.BackupExclude = envOrDefault("BACKUP_EXCLUDE", "")
+	cfg.BackupParallelism = envOrDefaultInt("BACKUP_PARALLELISM", 0)
+	cfg.BackupBinlogPosition = strings.EqualFold(envOrDefault("BACKUP_BINLOG_POSITION", "false"), "true")
+	cfg.BackupOplog = strings.EqualFold(envOrDefault("BACKUP_OPLOG", "false"), "true")
 	cfg.Timezone = envOrDefault("TZ", "UTC")
 	cfg.BackupTempDir = envOrDefault("BACKUP_TEMP_DIR", "/tmp/dbstash-work")
 
@@ -173,6 +644,14 @@ func Load() (*Config, error) {
 	cfg.RetentionMaxFiles = envOrDefaultInt("RETENTION_MAX_FILES", 0)
 	cfg.RetentionMaxDays = envOrDefaultInt("RETENTION_MAX_DAYS", 0)
 
+	// Verification
+	cfg.VerifySchedule = envOrDefault("VERIFY_SCHEDULE", "")
+
+	// Restore drills
+	cfg.DrillSchedule = envOrDefault("DRILL_SCHEDULE", "")
+	cfg.DrillTargetDB = envOrDefault("DRILL_TARGET_DB", "")
+	cfg.DrillQueries = resolveFileVar("DRILL_QUERIES", "DRILL_QUERIES_FILE")
+
 	// Notifications
 	cfg.NotifyWebhookURL = envOrDefault("NOTIFY_WEBHOOK_URL", "")
 	cfg.NotifyOn = envOrDefault("NOTIFY_ON", "failure")
@@ -196,6 +675,14 @@ func Load() (*Config, error) {
 	}
 	cfg.BackupLock = !strings.EqualFold(envOrDefault("BACKUP_LOCK", "true"), "false")
 	cfg.DryRun = strings.EqualFold(envOrDefault("DRY_RUN", "false"), "true")
+	cfg.PreflightCheck = !strings.EqualFold(envOrDefault("PREFLIGHT_CHECK", "true"), "false")
+	cfg.PreflightRetries = envOrDefaultInt("PREFLIGHT_RETRIES", 3)
+	backoffStr := envOrDefault("PREFLIGHT_BACKOFF", "5s")
+	d, err := time.ParseDuration(backoffStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PREFLIGHT_BACKOFF %q: %w", backoffStr, err)
+	}
+	cfg.PreflightBackoff = d
 
 	// Validate
 	if err := cfg.Prepare(); err != nil {
@@ -253,15 +740,61 @@ func ResolveFileValue(filePath string) string {
 	return strings.TrimSpace(string(data))
 }
 
+// ForDatabase returns a copy of c that backs up only the database name,
+// as each database of a split backup is, keeping the include and exclude
+// patterns for objects in that database. The database in DB_URI is
+// replaced; mongo URIs keep authenticating against admin, as they do for
+// all-databases backups.
+func (c *Config) ForDatabase(name string) *Config {
+	db := *c
+	db.BackupAllDatabases = false
+	db.BackupSplitDatabases = false
+	db.BackupInclude = scopePatterns(c.BackupInclude, name)
+	db.BackupExclude = scopePatterns(c.BackupExclude, name)
+	db.DBName = name
+	if db.DBURI != "" {
+		if u, err := url.Parse(db.DBURI); err == nil {
+			u.Path = "/" + name
+			if db.Engine == "mongo" {
+				q := u.Query()
+				if q.Get("authSource") == "" {
+					q.Set("authSource", "admin")
+					u.RawQuery = q.Encode()
+				}
+			}
+			db.DBURI = u.String()
+		}
+	}
+	return &db
+}
+
+// ForShard returns a copy of the config that backs up one shard of a
+// Redis Cluster: the server at addr (host:port), named name.
+func (c *Config) ForShard(name, addr string) *Config {
+	shard := *c
+	shard.RedisCluster = false
+	shard.RedisNode = addr
+	shard.DBName = name
+	return &shard
+}
+
 // DBNameOrDefault returns the database name. If DB_NAME is not set,
-// it attempts to extract the database name from DB_URI.
+// it attempts to extract the database name from DB_URI. Physical backups
+// and Redis Cluster runs are named "cluster".
 func (c *Config) DBNameOrDefault() string {
 	if c.BackupAllDatabases {
 		return "all"
 	}
+	if c.BackupMethod == "physical" || c.RedisCluster {
+		return "cluster"
+	}
 	if c.DBName != "" {
 		return c.DBName
 	}
+	if c.Engine == "sqlite" && c.DBPath != "" {
+		base := filepath.Base(c.DBPath)
+		return strings.TrimSuffix(base, filepath.Ext(base))
+	}
 	if c.DBURI != "" {
 		return dbNameFromURI(c.DBURI)
 	}
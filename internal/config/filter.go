@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// IncludePatterns returns the BACKUP_INCLUDE glob patterns.
+func (c *Config) IncludePatterns() []string { return splitPatterns(c.BackupInclude) }
+
+// ExcludePatterns returns the BACKUP_EXCLUDE glob patterns.
+func (c *Config) ExcludePatterns() []string { return splitPatterns(c.BackupExclude) }
+
+// HasFilters reports whether BACKUP_INCLUDE or BACKUP_EXCLUDE is set.
+func (c *Config) HasFilters() bool {
+	return len(c.IncludePatterns()) > 0 || len(c.ExcludePatterns()) > 0
+}
+
+// IncludesDatabase reports whether a split backup dumps the database
+// name. In all-databases mode the first dot-separated part of a pattern
+// matches the database: a database is dumped if any include pattern
+// selects it and no exclude pattern without a dot names it. Patterns with
+// a dot only exclude objects within the database.
+func (c *Config) IncludesDatabase(name string) bool {
+	if include := c.IncludePatterns(); len(include) > 0 {
+		var dbs []string
+		for _, p := range include {
+			db, _, _ := strings.Cut(p, ".")
+			dbs = append(dbs, db)
+		}
+		if !MatchAny(dbs, name) {
+			return false
+		}
+	}
+	for _, p := range c.ExcludePatterns() {
+		if !strings.Contains(p, ".") && MatchAny([]string{p}, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchAny reports whether name matches one of the glob patterns.
+func MatchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// IsGlob reports whether pattern has wildcards.
+func IsGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+// scopePatterns returns the object patterns of the database name from a
+// list of all-databases patterns: the part after the first dot of each
+// pattern whose database part matches name.
+func scopePatterns(s, name string) string {
+	var scoped []string
+	for _, p := range splitPatterns(s) {
+		db, rest, ok := strings.Cut(p, ".")
+		if ok && MatchAny([]string{db}, name) {
+			scoped = append(scoped, rest)
+		}
+	}
+	return strings.Join(scoped, ",")
+}
+
+// validatePatterns checks the syntax of a comma-separated pattern list.
+func validatePatterns(key, s string) error {
+	for _, p := range splitPatterns(s) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid %s pattern %q: %w", key, p, err)
+		}
+	}
+	return nil
+}
+
+// splitPatterns splits a comma-separated pattern list, dropping blanks.
+func splitPatterns(s string) []string {
+	var patterns []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
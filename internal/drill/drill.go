@@ -0,0 +1,106 @@
+// Package drill proves that backups restore: it loads the newest backup
+// into a scratch database and runs sanity queries against it.
+package drill
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/viperadnan-git/dbstash/internal/catalog"
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/engine"
+	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/restore"
+)
+
+// Result describes a completed drill.
+type Result struct {
+	RemotePath string // backup that was restored
+	Size       int64  // backup size in bytes (-1 for directories)
+	Queries    bool   // whether sanity queries were run
+}
+
+// Run restores the newest backup on RCLONE_REMOTE into DRILL_TARGET_DB,
+// which is dropped and recreated first, then runs DRILL_QUERIES against
+// it. The returned Result is non-nil once a backup has been picked.
+func Run(ctx context.Context, cfg *config.Config, eng engine.Engine) (*Result, error) {
+	if err := cfg.ValidateDrill(); err != nil {
+		return nil, err
+	}
+	driller, ok := eng.(engine.Driller)
+	if !ok {
+		return nil, fmt.Errorf("restore drills are not supported for %s", eng.Name())
+	}
+
+	entries, err := catalog.List(ctx, cfg, eng)
+	if err != nil {
+		return nil, err
+	}
+	// The globals of a split backup hold no database to load
+	if cfg.BackupSplitDatabases {
+		var databases []catalog.Entry
+		for _, e := range entries {
+			if e.Database != engine.GlobalsDatabase {
+				databases = append(databases, e)
+			}
+		}
+		entries = databases
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no backups found on %s", cfg.RcloneRemote)
+	}
+	newest := entries[0]
+	if newest.Database == cfg.DrillTargetDB {
+		return nil, fmt.Errorf("DRILL_TARGET_DB must differ from the backed-up database %q", cfg.DrillTargetDB)
+	}
+	res := &Result{RemotePath: restore.RemotePath(cfg, newest.Name), Size: newest.Size}
+
+	log := logger.Log.With().Str("drill_target", cfg.DrillTargetDB).Str("restore_from", res.RemotePath).Logger()
+
+	// Reset the scratch database
+	resetCmd, err := driller.ResetCommand(cfg, cfg.DrillTargetDB)
+	if err != nil {
+		return res, fmt.Errorf("building reset command: %w", err)
+	}
+	defer engine.Cleanup(resetCmd)
+	if resetCmd != nil {
+		var stderr bytes.Buffer
+		resetCmd.Stderr = &stderr
+		log.Debug().Str("reset_cmd", config.MaskCmdArgs(resetCmd.Args)).Msg("resetting scratch database")
+		if err := resetCmd.Run(); err != nil {
+			return res, fmt.Errorf("resetting %s: %w (stderr: %s)", cfg.DrillTargetDB, err, stderr.String())
+		}
+	}
+
+	// Restore; engines without a reset clean on restore instead
+	log.Debug().Msg("restoring newest backup")
+	err = restore.Run(ctx, cfg, eng, restore.Options{
+		From:     newest.Name,
+		TargetDB: cfg.DrillTargetDB,
+		Clean:    resetCmd == nil,
+	})
+	if err != nil {
+		return res, err
+	}
+
+	// Sanity queries
+	if strings.TrimSpace(cfg.DrillQueries) == "" {
+		return res, nil
+	}
+	queryCmd, err := driller.QueryCommand(cfg, cfg.DrillTargetDB, cfg.DrillQueries)
+	if err != nil {
+		return res, fmt.Errorf("building query command: %w", err)
+	}
+	defer engine.Cleanup(queryCmd)
+	var output bytes.Buffer
+	queryCmd.Stdout = &output
+	queryCmd.Stderr = &output
+	log.Debug().Str("query_cmd", config.MaskCmdArgs(queryCmd.Args)).Msg("running sanity queries")
+	if err := queryCmd.Run(); err != nil {
+		return res, fmt.Errorf("sanity queries failed: %w (output: %s)", err, strings.TrimSpace(output.String()))
+	}
+	res.Queries = true
+	return res, nil
+}
@@ -3,10 +3,18 @@
 package engine
 
 import (
+	"bytes"
+	"cmp"
+	"context"
 	"fmt"
 	"net/url"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/viperadnan-git/dbstash/internal/config"
 )
@@ -21,14 +29,178 @@ type Engine interface {
 	// For directory mode, it writes to the provided outputDir.
 	DumpCommand(cfg *config.Config, mode string, outputDir string) (*exec.Cmd, error)
 
-	// DefaultExtension returns the file extension based on compression setting.
-	DefaultExtension(compressed bool) string
+	// DefaultExtension returns the file extension for the given mode and
+	// compression setting.
+	DefaultExtension(cfg *config.Config, mode string, compressed bool) string
 
 	// SupportsCompression returns whether BACKUP_COMPRESS is meaningful.
 	SupportsCompression() bool
 
 	// ConflictingFlags returns flag prefixes incompatible with the given mode.
 	ConflictingFlags(mode string) []string
+
+	// RestoreCommand returns the exec.Cmd that loads a backup taken in
+	// opts.Mode. For stream and file mode, the command reads the dump from
+	// stdin. For directory and tar mode, it reads the extracted dump from
+	// opts.Dir.
+	RestoreCommand(cfg *config.Config, opts RestoreOptions) (*exec.Cmd, error)
+}
+
+// Driller is implemented by engines that support restore drills: the
+// scratch database is reset, the newest backup is restored into it, and
+// the sanity queries are run against it.
+type Driller interface {
+	// ResetCommand returns the exec.Cmd that drops and recreates dbName.
+	// It returns nil if the engine's restore replaces existing data when
+	// RestoreOptions.Clean is set.
+	ResetCommand(cfg *config.Config, dbName string) (*exec.Cmd, error)
+
+	// QueryCommand returns the exec.Cmd that runs script against dbName
+	// and exits non-zero if any statement fails.
+	QueryCommand(cfg *config.Config, dbName, script string) (*exec.Cmd, error)
+}
+
+// MetadataParser is implemented by engines whose dump tool reports facts
+// about the backup, such as WAL or binlog positions, that are kept in the
+// backup's manifest.
+type MetadataParser interface {
+	// ParseMetadata extracts key/value facts from the start of the dump
+	// output (head) and the dump tool's stderr. It returns nil if there is
+	// nothing to record.
+	ParseMetadata(cfg *config.Config, head, stderr string) map[string]string
+}
+
+// DatabaseLister is implemented by engines that can split an
+// all-databases backup into one backup per database
+// (BACKUP_SPLIT_DATABASES).
+type DatabaseLister interface {
+	// ListDatabasesCommand returns the exec.Cmd that prints the databases
+	// an all-databases dump would include, one per line.
+	ListDatabasesCommand(cfg *config.Config) (*exec.Cmd, error)
+
+	// GlobalsCommand returns the exec.Cmd that writes the server-wide
+	// objects no single database includes, such as roles, to stdout as
+	// plain SQL. It returns nil if there are none.
+	GlobalsCommand(cfg *config.Config) (*exec.Cmd, error)
+}
+
+// ShardLister is implemented by engines whose deployments spread their
+// data over several servers, each backed up as its own object
+// (REDIS_CLUSTER).
+type ShardLister interface {
+	// ListShards returns the shards of the deployment, each with a name
+	// that is stable across failovers and the server to dump it from.
+	ListShards(cfg *config.Config) ([]Shard, error)
+}
+
+// Pinger is implemented by engines that can check the server is reachable
+// before a backup starts, so a server that is down fails the run with a
+// clear error instead of the dump tool's.
+type Pinger interface {
+	// Ping returns nil once the server answers. It does not need to check
+	// the credentials. It gives up when ctx is done.
+	Ping(ctx context.Context, cfg *config.Config) error
+}
+
+// VersionChecker is implemented by engines whose dump tools only work
+// with some server versions.
+type VersionChecker interface {
+	// ServerVersion returns the version the server reports, or an empty
+	// string if the engine's tools cannot read it.
+	ServerVersion(ctx context.Context, cfg *config.Config) (string, error)
+
+	// CheckVersion compares the server version with the version of the
+	// tool that backs it up. It returns an error if the tool cannot back
+	// up the server, and a warning if it may not do so fully.
+	CheckVersion(cfg *config.Config, server string) (warning string, err error)
+}
+
+// Shard is one part of a sharded deployment.
+type Shard struct {
+	// Name identifies the shard in backup names ({db}).
+	Name string
+
+	// Addr is the host:port of the server holding the shard.
+	Addr string
+}
+
+// RestoreOptions describes the backup being restored and how to load it.
+type RestoreOptions struct {
+	// Mode is the backup mode the dump was taken in: stream, file,
+	// directory, or tar.
+	Mode string
+
+	// Compressed reports whether the dump used native compression
+	// (BACKUP_COMPRESS=true at backup time).
+	Compressed bool
+
+	// Dir is the local directory holding the dump for directory and tar mode.
+	Dir string
+
+	// DumpTool is the program that took the dump, as recorded in the
+	// manifest. Engines with several dump tools pick the matching loader;
+	// if it is empty they fall back to the configured tool.
+	DumpTool string
+
+	// Physical reports a physical backup (BACKUP_METHOD=physical), which
+	// is extracted into DataDir instead of being loaded through a client.
+	Physical bool
+
+	// DataDir is the empty data directory a physical backup is extracted
+	// into.
+	DataDir string
+
+	// OplogReplay replays the oplog captured with the dump (mongo
+	// BACKUP_OPLOG=true), up to OplogLimit ("<seconds>:<increment>") if
+	// set.
+	OplogReplay bool
+	OplogLimit  string
+
+	// RDBPath is the destination of the staged RDB file (redis only).
+	RDBPath string
+
+	// Database is the database the backup holds, as recorded in its
+	// manifest. A BACKUP_SPLIT_DATABASES job has no single configured
+	// database, so its backups are restored into this one.
+	Database string
+
+	// TargetDB restores into this database instead of the one configured
+	// for the backup. The database must already exist. For sqlite it is a
+	// file path.
+	TargetDB string
+
+	// Clean drops existing objects before recreating them.
+	Clean bool
+
+	// Jobs is the number of parallel restore workers (0 = tool default).
+	Jobs int
+}
+
+// GlobalsDatabase is the database recorded for the backup of the
+// server-wide objects (roles, tablespaces) a split backup starts with.
+const GlobalsDatabase = "globals"
+
+// restoresAllDatabases reports whether the backup being restored recreates
+// its own databases: an all-databases dump, or the globals of a split one.
+// The other backups of a split job hold a single database each.
+func restoresAllDatabases(cfg *config.Config, opts RestoreOptions) bool {
+	if cfg.BackupSplitDatabases {
+		return opts.Database == GlobalsDatabase
+	}
+	return cfg.BackupAllDatabases
+}
+
+// restoreDatabase returns the database a single-database backup is loaded
+// into: TargetDB, else the backup's own database for a split job, else an
+// empty string for the configured one.
+func restoreDatabase(cfg *config.Config, opts RestoreOptions) (string, error) {
+	if opts.TargetDB != "" || !cfg.BackupSplitDatabases {
+		return opts.TargetDB, nil
+	}
+	if opts.Database == "" {
+		return "", fmt.Errorf("the database of this split backup is unknown (no manifest); set --target-db")
+	}
+	return opts.Database, nil
 }
 
 // New returns the Engine implementation for the given engine key.
@@ -42,6 +214,8 @@ func New(engineKey string) (Engine, error) {
 		return &MySQL{engineKey: engineKey}, nil
 	case "redis":
 		return &Redis{}, nil
+	case "sqlite":
+		return &SQLite{}, nil
 	default:
 		return nil, fmt.Errorf("unsupported engine: %s", engineKey)
 	}
@@ -67,6 +241,17 @@ func stripDBFromURI(uri string) string {
 	return u.String()
 }
 
+// withDBInURI replaces the database name in a URI, keeping the scheme,
+// credentials, host, and query parameters intact.
+func withDBInURI(uri, dbName string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	u.Path = "/" + dbName
+	return u.String()
+}
+
 // shellSplit performs basic splitting of a string into arguments, respecting
 // single and double quotes. This is used to split DUMP_EXTRA_ARGS.
 func shellSplit(s string) []string {
@@ -96,3 +281,120 @@ func shellSplit(s string) []string {
 	}
 	return args
 }
+
+// toolVersions caches ToolVersion results by tool name.
+var toolVersions sync.Map
+
+// ToolVersion returns the first line of "<tool> --version", or an empty
+// string if the tool cannot be run. Results are cached for the process.
+func ToolVersion(tool string) string {
+	if v, ok := toolVersions.Load(tool); ok {
+		return v.(string)
+	}
+	output, err := exec.Command(tool, "--version").Output()
+	if err != nil {
+		return ""
+	}
+	version := strings.TrimSpace(strings.SplitN(string(output), "\n", 2)[0])
+	toolVersions.Store(tool, version)
+	return version
+}
+
+// run runs cmd, killing it if ctx is done first, and returns its output.
+// The error includes the tool's output if it exits non-zero.
+func run(ctx context.Context, cmd *exec.Cmd) (string, error) {
+	defer Cleanup(cmd)
+	tool := filepath.Base(cmd.Args[0])
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("%s: %w", tool, err)
+	}
+	stop := context.AfterFunc(ctx, func() { cmd.Process.Kill() })
+	defer stop()
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("%s: no answer: %w", tool, ctx.Err())
+		}
+		output := strings.TrimSpace(stderr.String() + stdout.String())
+		return "", fmt.Errorf("%s: %w (output: %s)", tool, err, output)
+	}
+	return stdout.String(), nil
+}
+
+// versionPattern matches a dotted version number such as 16.2 or 8.0.36.
+var versionPattern = regexp.MustCompile(`\d+(\.\d+)*`)
+
+// parseVersion returns the numeric parts of the first version number in
+// s, or nil if there is none.
+func parseVersion(s string) []int {
+	match := versionPattern.FindString(s)
+	if match == "" {
+		return nil
+	}
+	var parts []int
+	for _, part := range strings.Split(match, ".") {
+		n, _ := strconv.Atoi(part)
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// compareVersions compares the first n parts of versions a and b, with
+// missing parts as 0. It returns -1, 0, or 1.
+func compareVersions(a, b []int, n int) int {
+	for i := range n {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			return cmp.Compare(x, y)
+		}
+	}
+	return 0
+}
+
+// secretFiles maps each command to the credential file written for it.
+var secretFiles sync.Map
+
+// scratchDirs maps each command to the temporary directory created for it.
+var scratchDirs sync.Map
+
+// writeSecretFile writes content to a new file in dir that only the owner
+// can read, for handing credentials to a tool without putting them in its
+// arguments, where any process on the host can see them.
+func writeSecretFile(dir, pattern, content string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("creating %s for credentials: %w", dir, err)
+	}
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", fmt.Errorf("creating credentials file: %w", err)
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", fmt.Errorf("writing credentials file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("writing credentials file: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// Cleanup removes the credential file and temporary directory created for
+// cmd, if any. Call it once cmd has exited, or when it will not be run.
+func Cleanup(cmd *exec.Cmd) {
+	if path, ok := secretFiles.LoadAndDelete(cmd); ok {
+		os.Remove(path.(string))
+	}
+	if dir, ok := scratchDirs.LoadAndDelete(cmd); ok {
+		os.RemoveAll(dir.(string))
+	}
+}
@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/viperadnan-git/dbstash/internal/config"
+)
+
+func TestRestoreCommand_Split(t *testing.T) {
+	tests := []struct {
+		name    string
+		engine  string
+		opts    RestoreOptions
+		want    []string
+		absent  []string
+		wantErr bool
+	}{
+		{"pg plain", "pg", RestoreOptions{Mode: "stream", Database: "app"}, []string{"psql", "--dbname=app"}, nil, false},
+		{"pg custom", "pg", RestoreOptions{Mode: "stream", Compressed: true, Database: "app"}, []string{"pg_restore", "--dbname=app"}, nil, false},
+		{"pg target", "pg", RestoreOptions{Mode: "stream", Database: "app", TargetDB: "scratch"}, []string{"--dbname=scratch"}, nil, false},
+		{"pg globals", "pg", RestoreOptions{Mode: "stream", Database: GlobalsDatabase}, []string{"--dbname=postgres"}, nil, false},
+		{"pg globals target", "pg", RestoreOptions{Mode: "stream", Database: GlobalsDatabase, TargetDB: "scratch"}, nil, nil, true},
+		{"pg unknown database", "pg", RestoreOptions{Mode: "stream"}, nil, nil, true},
+		{"mysql", "mysql", RestoreOptions{Mode: "stream", Database: "app"}, []string{"mysql", "app"}, nil, false},
+		{"mysql target", "mysql", RestoreOptions{Mode: "stream", Database: "app", TargetDB: "scratch"}, []string{"scratch"}, []string{"app"}, false},
+		{"mysql globals", "mysql", RestoreOptions{Mode: "stream", Database: GlobalsDatabase}, nil, []string{GlobalsDatabase}, false},
+		{"mysql unknown database", "mysql", RestoreOptions{Mode: "stream"}, nil, nil, true},
+		{"myloader", "mysql", RestoreOptions{Mode: "directory", Dir: "/tmp/dump", DumpTool: "mydumper", Database: "app"}, []string{"myloader", "--directory=/tmp/dump"}, []string{"--database=app"}, false},
+		{"myloader target", "mysql", RestoreOptions{Mode: "directory", Dir: "/tmp/dump", DumpTool: "mydumper", Database: "app", TargetDB: "scratch"}, []string{"--database=scratch"}, nil, false},
+		{"mongo", "mongo", RestoreOptions{Mode: "stream", Database: "app"}, []string{"mongorestore", "--archive"}, []string{"--nsFrom=app.*"}, false},
+		{"mongo target", "mongo", RestoreOptions{Mode: "stream", Database: "app", TargetDB: "scratch"}, []string{"--nsFrom=app.*", "--nsTo=scratch.*"}, nil, false},
+		{"mongo target unknown database", "mongo", RestoreOptions{Mode: "stream", TargetDB: "scratch"}, nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eng, err := New(tt.engine)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			cfg := &config.Config{
+				Engine:               tt.engine,
+				DBHost:               "db.internal",
+				BackupAllDatabases:   true,
+				BackupSplitDatabases: true,
+			}
+
+			cmd, err := eng.RestoreCommand(cfg, tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", cmd.Args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer Cleanup(cmd)
+			for _, arg := range tt.want {
+				if !slices.Contains(cmd.Args, arg) {
+					t.Errorf("expected %q in %v", arg, cmd.Args)
+				}
+			}
+			for _, arg := range tt.absent {
+				if slices.Contains(cmd.Args, arg) {
+					t.Errorf("unexpected %q in %v", arg, cmd.Args)
+				}
+			}
+		})
+	}
+}
+
+// fakeMongo serves one connection on a loopback port with handle and
+// returns its address.
+func fakeMongo(t *testing.T, handle func(net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handle(conn)
+	}()
+	return ln.Addr().String()
+}
+
+func TestMongoPing(t *testing.T) {
+	answer := func(conn net.Conn) {
+		header := make([]byte, 16)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		body := make([]byte, binary.LittleEndian.Uint32(header)-16)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+		// Flag bits, then a body section whose document fills the rest
+		if binary.LittleEndian.Uint32(header[12:]) != opMsg || body[4] != 0 ||
+			int(binary.LittleEndian.Uint32(body[5:])) != len(body)-5 || !bytes.Contains(body, []byte("hello\x00")) {
+			return
+		}
+		reply := binary.LittleEndian.AppendUint32(nil, 16)
+		reply = binary.LittleEndian.AppendUint32(reply, 7)
+		reply = binary.LittleEndian.AppendUint32(reply, binary.LittleEndian.Uint32(header[4:]))
+		reply = binary.LittleEndian.AppendUint32(reply, opMsg)
+		conn.Write(reply)
+	}
+
+	tests := []struct {
+		name    string
+		handle  func(net.Conn)
+		wantErr bool
+	}{
+		{"answers hello", answer, false},
+		// The local end of an SSH tunnel whose database is down
+		{"closes at once", func(net.Conn) {}, true},
+		{"never answers", func(conn net.Conn) { io.Copy(io.Discard, conn) }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := fakeMongo(t, tt.handle)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			err := (&Mongo{}).Ping(ctx, &config.Config{Engine: "mongo", DBURI: "mongodb://" + addr + "/app"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Ping() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
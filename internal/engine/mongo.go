@@ -1,9 +1,21 @@
 package engine
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
 	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/viperadnan-git/dbstash/internal/config"
 )
@@ -38,18 +50,158 @@ func (m *Mongo) DumpCommand(cfg *config.Config, mode string, outputDir string) (
 		return nil, fmt.Errorf("unsupported mode for mongo: %s", mode)
 	}
 
+	if cfg.BackupParallelism > 0 {
+		args = append(args, fmt.Sprintf("--numParallelCollections=%d", cfg.BackupParallelism))
+	}
+
+	// Capture the writes made during the dump so the restore is
+	// consistent; only possible when dumping the whole deployment
+	if cfg.BackupOplog {
+		args = append(args, "--oplog")
+	}
+
 	// Connection
+	connArgs, conf, err := m.connectionArgs(cfg, true)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, connArgs...)
+
+	// Filters
+	if !cfg.BackupAllDatabases {
+		filterArgs, err := m.collectionArgs(cfg)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, filterArgs...)
+	}
+
+	// Extra args
+	if cfg.DumpExtraArgs != "" {
+		args = append(args, shellSplit(cfg.DumpExtraArgs)...)
+	}
+
+	cmd, err := m.command(cfg, "mongodump", args, conf)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// collectionArgs translates BACKUP_INCLUDE and BACKUP_EXCLUDE into
+// mongodump flags. mongodump can select a single collection and exclude
+// exact names or prefixes; other patterns are expanded against the
+// collections of the database, listed with mongosh, into the collections
+// to exclude.
+func (m *Mongo) collectionArgs(cfg *config.Config) ([]string, error) {
+	include, exclude := cfg.IncludePatterns(), cfg.ExcludePatterns()
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+
+	// A single exact include is a --collection, which cannot be combined
+	// with exclusions
+	if len(include) == 1 && !config.IsGlob(include[0]) && !config.MatchAny(exclude, include[0]) {
+		return []string{fmt.Sprintf("--collection=%s", include[0])}, nil
+	}
+
+	if len(include) == 0 {
+		if args, ok := excludeArgs(exclude); ok {
+			return args, nil
+		}
+	}
+
+	names, err := m.listCollections(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	kept := 0
+	for _, name := range names {
+		if (len(include) > 0 && !config.MatchAny(include, name)) || config.MatchAny(exclude, name) {
+			args = append(args, fmt.Sprintf("--excludeCollection=%s", name))
+		} else {
+			kept++
+		}
+	}
+	if len(include) > 0 && kept == 0 {
+		return nil, fmt.Errorf("BACKUP_INCLUDE matches no collections in %s", m.dbName(cfg))
+	}
+	return args, nil
+}
+
+// excludeArgs translates the exclude patterns mongodump matches itself:
+// exact names and prefixes. ok is false if any pattern needs the
+// collections listed.
+func excludeArgs(exclude []string) ([]string, bool) {
+	var args []string
+	for _, p := range exclude {
+		prefix, star := strings.CutSuffix(p, "*")
+		switch {
+		case !config.IsGlob(p):
+			args = append(args, fmt.Sprintf("--excludeCollection=%s", p))
+		case star && !config.IsGlob(prefix):
+			args = append(args, fmt.Sprintf("--excludeCollectionsWithPrefix=%s", prefix))
+		default:
+			return nil, false
+		}
+	}
+	return args, true
+}
+
+// listCollections returns the collections of the configured database.
+func (m *Mongo) listCollections(cfg *config.Config) ([]string, error) {
+	dbName := m.dbName(cfg)
+	cmd, err := m.QueryCommand(cfg, dbName, `db.getCollectionNames().forEach(c => print(c))`)
+	if err != nil {
+		return nil, err
+	}
+	defer Cleanup(cmd)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing collections of %s for BACKUP_INCLUDE/BACKUP_EXCLUDE: %w (stderr: %s)", dbName, err, stderr.String())
+	}
+	var names []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			names = append(names, line)
+		}
+	}
+	return names, nil
+}
+
+// dbName returns the configured database name.
+func (m *Mongo) dbName(cfg *config.Config) string {
+	if cfg.DBURI != "" {
+		return dbNameFromURI(cfg.DBURI)
+	}
+	return cfg.DBName
+}
+
+// connectionArgs returns the mongodump/mongorestore flags that select the
+// deployment, and the --config YAML that holds the URI and password. When
+// selectDB is set and all databases are not being dumped, --db is added to
+// scope the command to the configured database.
+func (m *Mongo) connectionArgs(cfg *config.Config, selectDB bool) ([]string, string, error) {
+	var args []string
+	var conf strings.Builder
+
 	if cfg.DBURI != "" {
 		if cfg.BackupAllDatabases {
 			// Strip database name from URI so mongodump dumps all databases
-			args = append(args, fmt.Sprintf("--uri=%s", stripDBFromURI(cfg.DBURI)))
+			fmt.Fprintf(&conf, "uri: %s\n", strconv.Quote(stripDBFromURI(cfg.DBURI)))
 		} else {
-			args = append(args, fmt.Sprintf("--uri=%s", cfg.DBURI))
+			fmt.Fprintf(&conf, "uri: %s\n", strconv.Quote(cfg.DBURI))
 			dbName := dbNameFromURI(cfg.DBURI)
 			if dbName == "" {
-				return nil, fmt.Errorf("mongo URI has no database name; set DB_NAME, add a database to the URI, or use --all-databases")
+				return nil, "", fmt.Errorf("mongo URI has no database name; set DB_NAME, add a database to the URI, or use --all-databases")
+			}
+			if selectDB {
+				args = append(args, fmt.Sprintf("--db=%s", dbName))
 			}
-			args = append(args, fmt.Sprintf("--db=%s", dbName))
 		}
 	} else {
 		if cfg.DBHost != "" {
@@ -58,32 +210,515 @@ func (m *Mongo) DumpCommand(cfg *config.Config, mode string, outputDir string) (
 		if cfg.DBPort != "" {
 			args = append(args, fmt.Sprintf("--port=%s", cfg.DBPort))
 		}
-		if cfg.DBName != "" && !cfg.BackupAllDatabases {
+		if selectDB && cfg.DBName != "" && !cfg.BackupAllDatabases {
 			args = append(args, fmt.Sprintf("--db=%s", cfg.DBName))
 		}
 		if cfg.DBUser != "" {
 			args = append(args, fmt.Sprintf("--username=%s", cfg.DBUser))
 		}
 		if cfg.DBPassword != "" {
-			args = append(args, fmt.Sprintf("--password=%s", cfg.DBPassword))
+			fmt.Fprintf(&conf, "password: %s\n", strconv.Quote(cfg.DBPassword))
 		}
 		if cfg.DBAuthSource != "" {
 			args = append(args, fmt.Sprintf("--authenticationDatabase=%s", cfg.DBAuthSource))
 		}
 	}
+	args = append(args, m.tlsArgs(cfg)...)
 
-	// Extra args
-	if cfg.DumpExtraArgs != "" {
-		args = append(args, shellSplit(cfg.DumpExtraArgs)...)
+	return args, conf.String(), nil
+}
+
+// command builds the exec.Cmd for a database tool. The URI and password
+// in conf are written to a YAML file passed with --config instead of the
+// arguments, where any process on the host could read them. Cleanup
+// removes the file.
+func (m *Mongo) command(cfg *config.Config, name string, args []string, conf string) (*exec.Cmd, error) {
+	if conf == "" {
+		return exec.Command(name, args...), nil
+	}
+	path, err := writeSecretFile(cfg.BackupTempDir, "mongo-*.yaml", conf)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(name, append(args, "--config="+path)...)
+	secretFiles.Store(cmd, path)
+	return cmd, nil
+}
+
+// tlsArgs returns the TLS flags for the database tools, which take the
+// --ssl spellings. TLS is turned on by any DB_TLS_MODE but disable, or by
+// a TLS file.
+func (m *Mongo) tlsArgs(cfg *config.Config) []string {
+	if !m.useTLS(cfg) {
+		return nil
+	}
+	args := []string{"--ssl"}
+	switch cfg.DBTLSMode {
+	case "require":
+		args = append(args, "--tlsInsecure")
+	case "verify-ca":
+		args = append(args, "--sslAllowInvalidHostnames")
 	}
+	if cfg.DBTLSCAFile != "" {
+		args = append(args, "--sslCAFile="+cfg.DBTLSCAFile)
+	}
+	if cfg.DBTLSCertFile != "" {
+		args = append(args, "--sslPEMKeyFile="+cfg.DBTLSCertFile)
+	}
+	return args
+}
+
+// tlsOptions returns the TLS settings as connection string options, for
+// mongosh.
+func (m *Mongo) tlsOptions(cfg *config.Config) url.Values {
+	opts := url.Values{}
+	if !m.useTLS(cfg) {
+		return opts
+	}
+	opts.Set("tls", "true")
+	switch cfg.DBTLSMode {
+	case "require":
+		opts.Set("tlsInsecure", "true")
+	case "verify-ca":
+		opts.Set("tlsAllowInvalidHostnames", "true")
+	}
+	if cfg.DBTLSCAFile != "" {
+		opts.Set("tlsCAFile", cfg.DBTLSCAFile)
+	}
+	if cfg.DBTLSCertFile != "" {
+		opts.Set("tlsCertificateKeyFile", cfg.DBTLSCertFile)
+	}
+	return opts
+}
+
+// useTLS reports whether the TLS settings turn TLS on.
+func (m *Mongo) useTLS(cfg *config.Config) bool {
+	return cfg.DBTLSMode != "disable" && (cfg.DBTLSMode != "" || cfg.HasTLSFiles())
+}
+
+// RestoreCommand builds a mongorestore command for the given mode. Archives
+// are read from stdin; directory dumps from opts.Dir.
+func (m *Mongo) RestoreCommand(cfg *config.Config, opts RestoreOptions) (*exec.Cmd, error) {
+	var args []string
+
+	switch opts.Mode {
+	case "stream", "file":
+		args = append(args, "--archive")
+	case "directory", "tar":
+		args = append(args, fmt.Sprintf("--dir=%s", opts.Dir))
+	default:
+		return nil, fmt.Errorf("unsupported mode for mongo: %s", opts.Mode)
+	}
+	if opts.Compressed {
+		args = append(args, "--gzip")
+	}
+
+	if opts.Clean {
+		args = append(args, "--drop")
+	}
+	if opts.Jobs > 0 {
+		args = append(args, fmt.Sprintf("--numParallelCollections=%d", opts.Jobs))
+	}
+	if opts.OplogReplay {
+		args = append(args, "--oplogReplay")
+		if opts.OplogLimit != "" {
+			args = append(args, "--oplogLimit="+opts.OplogLimit)
+		}
+	}
+
+	// Namespaces are restored as they were dumped, so --db is not passed;
+	// a target database is applied as a namespace rename instead
+	if opts.TargetDB != "" {
+		if restoresAllDatabases(cfg, opts) {
+			return nil, fmt.Errorf("a target database cannot be set when restoring all databases")
+		}
+		source := cfg.DBName
+		switch {
+		case cfg.BackupSplitDatabases:
+			if opts.Database == "" {
+				return nil, fmt.Errorf("the database of this split backup is unknown (no manifest); it cannot be renamed to --target-db")
+			}
+			source = opts.Database
+		case cfg.DBURI != "":
+			source = dbNameFromURI(cfg.DBURI)
+		}
+		args = append(args,
+			fmt.Sprintf("--nsFrom=%s.*", source),
+			fmt.Sprintf("--nsTo=%s.*", opts.TargetDB),
+		)
+	}
+
+	connArgs, conf, err := m.connectionArgs(cfg, false)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, connArgs...)
+
+	cmd, err := m.command(cfg, "mongorestore", args, conf)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// oplogEntriesRe matches mongodump's count of the oplog entries it
+// captured with --oplog.
+var oplogEntriesRe = regexp.MustCompile(`dumped (\d+) oplog entr`)
 
-	cmd := exec.Command("mongodump", args...)
+// ParseMetadata records that a dump captured the oplog, which mongorestore
+// must then replay.
+func (m *Mongo) ParseMetadata(cfg *config.Config, _, stderr string) map[string]string {
+	if !cfg.BackupOplog {
+		return nil
+	}
+	meta := map[string]string{"oplog": "true"}
+	if n := oplogEntriesRe.FindStringSubmatch(stderr); n != nil {
+		meta["oplog_entries"] = n[1]
+	}
+	return meta
+}
+
+// OplogDumpCommand builds the mongodump command that writes the entries of
+// local.oplog.rs matching query (extended JSON) to outDir as
+// local/oplog.rs.bson.
+func (m *Mongo) OplogDumpCommand(cfg *config.Config, query, outDir string) (*exec.Cmd, error) {
+	args := []string{
+		"--db=local",
+		"--collection=oplog.rs",
+		"--query=" + query,
+		fmt.Sprintf("--out=%s", outDir),
+	}
+	connArgs, conf, err := m.deploymentArgs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, connArgs...)
+	return m.command(cfg, "mongodump", args, conf)
+}
+
+// LatestOplogCommand builds the mongoexport command that prints the ts of
+// the newest oplog entry as extended JSON.
+func (m *Mongo) LatestOplogCommand(cfg *config.Config) (*exec.Cmd, error) {
+	args := []string{
+		"--db=local",
+		"--collection=oplog.rs",
+		`--sort={"$natural":-1}`,
+		"--limit=1",
+		"--fields=ts",
+		"--quiet",
+	}
+	connArgs, conf, err := m.deploymentArgs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, connArgs...)
+	return m.command(cfg, "mongoexport", args, conf)
+}
+
+// deploymentArgs returns the connection flags for commands that work on
+// the whole deployment rather than the configured database.
+func (m *Mongo) deploymentArgs(cfg *config.Config) ([]string, string, error) {
+	all := *cfg
+	all.BackupAllDatabases = true
+	return m.connectionArgs(&all, false)
+}
+
+// ListDatabasesCommand lists the databases mongodump would dump without
+// --db: all but local and config. It needs mongosh.
+func (m *Mongo) ListDatabasesCommand(cfg *config.Config) (*exec.Cmd, error) {
+	if _, err := exec.LookPath("mongosh"); err != nil {
+		return nil, fmt.Errorf("mongosh is required to list databases for BACKUP_SPLIT_DATABASES: %w", err)
+	}
+	return m.QueryCommand(cfg, "admin", `db.adminCommand({listDatabases: 1, nameOnly: true}).databases.forEach(d => { if (d.name !== "local" && d.name !== "config") print(d.name) })`)
+}
+
+// GlobalsCommand returns nil: users and roles live in the admin
+// database, which is backed up like any other.
+func (m *Mongo) GlobalsCommand(_ *config.Config) (*exec.Cmd, error) {
+	return nil, nil
+}
+
+// ResetCommand returns nil: mongorestore --drop replaces the restored
+// collections.
+func (m *Mongo) ResetCommand(_ *config.Config, _ string) (*exec.Cmd, error) {
+	return nil, nil
+}
+
+// Ping checks that a server of the deployment answers. The database tools
+// have no ping of their own and mongosh may not be installed, so a hello
+// command is sent to the hosts in DB_URI or DB_HOST directly; the servers
+// of a mongodb+srv URI are looked up first. Accepting the connection is not
+// enough: the local end of an SSH tunnel does so even when the database
+// behind it is down.
+func (m *Mongo) Ping(ctx context.Context, cfg *config.Config) error {
+	hosts, err := m.hosts(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := m.pingTLSConfig(cfg)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, host := range hosts {
+		err := hello(ctx, host, tlsConfig)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", host, err))
+	}
+	return errors.Join(errs...)
+}
+
+// pingTLSConfig returns the TLS settings for Ping, or nil for a plain
+// connection. The server's certificate is not verified: Ping only checks
+// that the server answers, and the tools verify it when they connect.
+func (m *Mongo) pingTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	enabled := m.useTLS(cfg)
+	if cfg.DBURI != "" && !enabled {
+		enabled = strings.HasPrefix(cfg.DBURI, "mongodb+srv://")
+		if _, query, ok := strings.Cut(cfg.DBURI, "?"); ok {
+			if values, err := url.ParseQuery(query); err == nil {
+				enabled = enabled || values.Get("tls") == "true" || values.Get("ssl") == "true"
+			}
+		}
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+	if cfg.DBTLSCertFile != "" {
+		// The tools take the key in the same PEM file unless one is set
+		keyFile := cfg.DBTLSKeyFile
+		if keyFile == "" {
+			keyFile = cfg.DBTLSCertFile
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.DBTLSCertFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading DB_TLS_CERT_FILE: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// helloRequestID identifies the hello command Ping sends.
+const helloRequestID = 1
+
+// opMsg is the opcode of MongoDB's OP_MSG wire protocol message.
+const opMsg = 2013
+
+// helloMessage is an OP_MSG holding {hello: 1, $db: "admin"}, which every
+// server answers without authentication.
+var helloMessage = func() []byte {
+	var doc []byte
+	doc = append(doc, 0x10)
+	doc = append(doc, "hello\x00"...)
+	doc = binary.LittleEndian.AppendUint32(doc, 1)
+	doc = append(doc, 0x02)
+	doc = append(doc, "$db\x00"...)
+	doc = binary.LittleEndian.AppendUint32(doc, uint32(len("admin")+1))
+	doc = append(doc, "admin\x00"...)
+	doc = append(doc, 0x00)
+	doc = append(binary.LittleEndian.AppendUint32(nil, uint32(len(doc)+4)), doc...)
+
+	// Header, flag bits, and a single body section
+	msg := binary.LittleEndian.AppendUint32(nil, uint32(16+4+1+len(doc)))
+	msg = binary.LittleEndian.AppendUint32(msg, helloRequestID)
+	msg = binary.LittleEndian.AppendUint32(msg, 0)
+	msg = binary.LittleEndian.AppendUint32(msg, opMsg)
+	msg = binary.LittleEndian.AppendUint32(msg, 0)
+	msg = append(msg, 0x00)
+	return append(msg, doc...)
+}()
+
+// hello sends helloMessage to the server at addr and waits for its reply.
+// Any reply counts; servers too old to know hello still answer with an
+// error document.
+func hello(ctx context.Context, addr string, tlsConfig *tls.Config) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if tlsConfig != nil {
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return fmt.Errorf("TLS handshake: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	if _, err := conn.Write(helloMessage); err != nil {
+		return fmt.Errorf("sending hello: %w", err)
+	}
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return fmt.Errorf("reading hello reply: %w", err)
+	}
+	responseTo := binary.LittleEndian.Uint32(header[8:12])
+	opCode := binary.LittleEndian.Uint32(header[12:16])
+	if responseTo != helloRequestID || opCode != opMsg {
+		return fmt.Errorf("unexpected reply to hello (opcode %d)", opCode)
+	}
+	return nil
+}
+
+// ServerVersion returns db.version() through mongosh. The database tools
+// cannot read it, so it is empty if mongosh is not installed.
+func (m *Mongo) ServerVersion(ctx context.Context, cfg *config.Config) (string, error) {
+	if _, err := exec.LookPath("mongosh"); err != nil {
+		return "", nil
+	}
+	cmd, err := m.QueryCommand(cfg, "admin", "print(db.version())")
+	if err != nil {
+		return "", err
+	}
+	output, err := run(ctx, cmd)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// mongoToolsSupport maps each server release to the first MongoDB
+// Database Tools release that supports it.
+var mongoToolsSupport = []struct {
+	server, tools []int
+}{
+	{[]int{8, 0}, []int{100, 10, 0}},
+	{[]int{7, 0}, []int{100, 8, 0}},
+	{[]int{6, 0}, []int{100, 6, 0}},
+	{[]int{5, 0}, []int{100, 5, 0}},
+}
+
+// CheckVersion warns if mongodump is older than the first Database Tools
+// release that supports the server, or, for the legacy tools versioned
+// with the server (r4.x), older than the server.
+func (m *Mongo) CheckVersion(_ *config.Config, server string) (string, error) {
+	line := ToolVersion("mongodump")
+	installed := versionPattern.FindString(line)
+	toolVersion, serverVersion := parseVersion(installed), parseVersion(server)
+	if toolVersion == nil || serverVersion == nil {
+		return "", nil
+	}
+	if toolVersion[0] < 100 {
+		if compareVersions(toolVersion, serverVersion, 2) < 0 {
+			return fmt.Sprintf("mongodump %s is older than the MongoDB %s server and may not dump it correctly; use MongoDB Database Tools 100.x", installed, server), nil
+		}
+		return "", nil
+	}
+	for _, support := range mongoToolsSupport {
+		if compareVersions(serverVersion, support.server, 2) < 0 {
+			continue
+		}
+		if compareVersions(toolVersion, support.tools, 3) < 0 {
+			return fmt.Sprintf("mongodump %s predates support for MongoDB %d.%d (server %s); use MongoDB Database Tools %d.%d.%d or later",
+				installed, support.server[0], support.server[1], server, support.tools[0], support.tools[1], support.tools[2]), nil
+		}
+		break
+	}
+	return "", nil
+}
+
+// hosts returns the host:port of each server named in DB_URI or DB_HOST.
+func (m *Mongo) hosts(ctx context.Context, cfg *config.Config) ([]string, error) {
+	withPort := func(host string) string {
+		if _, _, err := net.SplitHostPort(host); err == nil {
+			return host
+		}
+		return net.JoinHostPort(strings.Trim(host, "[]"), "27017")
+	}
+	if cfg.DBURI == "" {
+		if cfg.DBPort != "" {
+			return []string{net.JoinHostPort(cfg.DBHost, cfg.DBPort)}, nil
+		}
+		return []string{withPort(cfg.DBHost)}, nil
+	}
+
+	// The URI may list several hosts, which url.Parse rejects
+	scheme, rest, ok := strings.Cut(cfg.DBURI, "://")
+	if !ok {
+		return nil, fmt.Errorf("invalid mongo URI: missing scheme")
+	}
+	hostList, _, _ := strings.Cut(rest, "/")
+	hostList, _, _ = strings.Cut(hostList, "?")
+	if i := strings.LastIndex(hostList, "@"); i >= 0 {
+		hostList = hostList[i+1:]
+	}
+
+	var hosts []string
+	if scheme == "mongodb+srv" {
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, "mongodb", "tcp", hostList)
+		if err != nil {
+			return nil, fmt.Errorf("looking up the servers of %s: %w", hostList, err)
+		}
+		for _, record := range records {
+			hosts = append(hosts, net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port))))
+		}
+		return hosts, nil
+	}
+	for _, host := range strings.Split(hostList, ",") {
+		hosts = append(hosts, withPort(host))
+	}
+	return hosts, nil
+}
+
+// QueryCommand evaluates script with mongosh against dbName. mongosh exits
+// non-zero on an uncaught exception, so checks should throw on failure.
+// The script connects itself, so the connection string and its
+// credentials are written to the script file rather than given as
+// arguments. Cleanup removes the file.
+func (m *Mongo) QueryCommand(cfg *config.Config, dbName, script string) (*exec.Cmd, error) {
+	if _, err := exec.LookPath("mongosh"); err != nil {
+		return nil, fmt.Errorf("mongosh is required to run queries: %w", err)
+	}
+
+	var uri string
+	if cfg.DBURI != "" {
+		uri = withDBInURI(cfg.DBURI, dbName)
+	} else {
+		host := cfg.DBHost
+		if cfg.DBPort != "" {
+			host += ":" + cfg.DBPort
+		}
+		u := &url.URL{Scheme: "mongodb", Host: host, Path: "/" + dbName}
+		if cfg.DBUser != "" {
+			u.User = url.UserPassword(cfg.DBUser, cfg.DBPassword)
+		}
+		if cfg.DBAuthSource != "" {
+			u.RawQuery = url.Values{"authSource": {cfg.DBAuthSource}}.Encode()
+		}
+		uri = u.String()
+	}
+	if tls := m.tlsOptions(cfg).Encode(); tls != "" {
+		if strings.Contains(uri, "?") {
+			uri += "&" + tls
+		} else {
+			uri += "?" + tls
+		}
+	}
+
+	// A JSON string is a valid JavaScript string literal
+	literal, _ := json.Marshal(uri)
+	path, err := writeSecretFile(cfg.BackupTempDir, "mongosh-*.js", fmt.Sprintf("db = connect(%s);\n%s\n", literal, script))
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("mongosh", "--quiet", "--norc", "--nodb", path)
+	secretFiles.Store(cmd, path)
 	cmd.Stderr = os.Stderr
 	return cmd, nil
 }
 
 // DefaultExtension returns the file extension based on compression.
-func (m *Mongo) DefaultExtension(compressed bool) string {
+func (m *Mongo) DefaultExtension(_ *config.Config, _ string, compressed bool) string {
 	if compressed {
 		return ".archive.gz"
 	}
@@ -1,17 +1,22 @@
 package engine
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"os"
 	"os/exec"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/viperadnan-git/dbstash/internal/config"
 	"github.com/viperadnan-git/dbstash/internal/logger"
 )
 
-// MySQL implements the Engine interface for MySQL and MariaDB using mysqldump.
+// MySQL implements the Engine interface for MySQL and MariaDB using
+// mysqldump, mariadb-dump, mysqlpump, or mydumper.
 type MySQL struct {
 	engineKey string
 }
@@ -19,30 +24,28 @@ type MySQL struct {
 // Name returns the engine key ("mysql" or "mariadb").
 func (m *MySQL) Name() string { return m.engineKey }
 
-// DumpCommand builds the mysqldump command for the given mode.
+// DumpCommand builds the dump command for the given mode: mysqldump (or
+// mariadb-dump, or mysqlpump) writing SQL, mydumper writing one file per
+// table, or xtrabackup (mariabackup) for physical backups.
 func (m *MySQL) DumpCommand(cfg *config.Config, mode string, outputDir string) (*exec.Cmd, error) {
-	var args []string
-
-	// Resolve connection params — mysqldump doesn't accept URIs directly
-	host, port, user, password, dbName := m.resolveConnection(cfg)
-
-	if host != "" {
-		args = append(args, fmt.Sprintf("--host=%s", host))
-	}
-	if port != "" {
-		args = append(args, fmt.Sprintf("--port=%s", port))
+	if cfg.BackupMethod == "physical" {
+		return m.physicalBackupCommand(cfg, mode)
 	}
-	if user != "" {
-		args = append(args, fmt.Sprintf("--user=%s", user))
-	}
-	if password != "" {
-		args = append(args, fmt.Sprintf("-p%s", password))
+	tool := m.dumpTool(cfg)
+	if tool == "mydumper" {
+		return m.mydumperCommand(cfg, mode, outputDir)
 	}
 
+	// mysqldump doesn't accept URIs directly
+	args, dbName := m.clientArgs(cfg)
+
 	switch mode {
 	case "stream", "file":
 		// writes to stdout; file pipeline redirects stdout to temp file
 	case "directory":
+		if tool == "mysqlpump" {
+			return nil, fmt.Errorf("mysqlpump cannot write directory mode dumps; use mydumper")
+		}
 		if cfg.BackupAllDatabases {
 			return nil, fmt.Errorf("mysqldump --all-databases is incompatible with directory mode (--tab)")
 		}
@@ -52,7 +55,17 @@ func (m *MySQL) DumpCommand(cfg *config.Config, mode string, outputDir string) (
 	}
 
 	if cfg.BackupCompress {
-		logger.Log.Warn().Str("engine", m.engineKey).Msg("mysqldump has no native compression; BACKUP_COMPRESS=true is a no-op")
+		logger.Log.Warn().Str("engine", m.engineKey).Msgf("%s has no native compression; BACKUP_COMPRESS=true is a no-op", tool)
+	}
+
+	// The binlog coordinates are written as a comment in the dump header,
+	// taken under a brief global read lock so they match the snapshot
+	if cfg.BackupBinlogPosition {
+		args = append(args, "--single-transaction", binlogPositionFlag(ToolVersion(tool)))
+	}
+
+	if tool == "mysqlpump" && cfg.BackupParallelism > 0 {
+		args = append(args, fmt.Sprintf("--default-parallelism=%d", cfg.BackupParallelism))
 	}
 
 	// Extra args
@@ -64,16 +77,728 @@ func (m *MySQL) DumpCommand(cfg *config.Config, mode string, outputDir string) (
 	if cfg.BackupAllDatabases {
 		args = append(args, "--all-databases")
 	} else if dbName != "" {
+		excluded, tables, err := m.tableArgs(cfg, dbName)
+		if err != nil {
+			return nil, err
+		}
+		if tool == "mysqlpump" {
+			if len(excluded) > 0 {
+				args = append(args, "--exclude-tables="+qualify(dbName, excluded))
+			}
+		} else {
+			for _, name := range excluded {
+				args = append(args, fmt.Sprintf("--ignore-table=%s.%s", dbName, name))
+			}
+		}
 		args = append(args, dbName)
+		args = append(args, tables...)
 	} else {
 		return nil, fmt.Errorf("no database name found; set DB_NAME, add a database to the URI, or use --all-databases")
 	}
 
-	cmd := exec.Command("mysqldump", args...)
+	cmd, err := m.command(cfg, tool, args)
+	if err != nil {
+		return nil, err
+	}
 	cmd.Stderr = os.Stderr
 	return cmd, nil
 }
 
+// mydumperCommand builds the mydumper command, which dumps the tables
+// into outputDir in parallel, one file per table.
+func (m *MySQL) mydumperCommand(cfg *config.Config, mode, outputDir string) (*exec.Cmd, error) {
+	if mode != "directory" {
+		return nil, fmt.Errorf("mydumper requires BACKUP_MODE=directory or tar (got %q)", cfg.BackupMode)
+	}
+
+	args, dbName := m.loaderArgs(cfg)
+	args = append(args, "--outputdir="+outputDir)
+
+	// A tar backup is gzipped as a whole; a directory backup is
+	// compressed file by file
+	if cfg.BackupCompress && cfg.BackupMode == "directory" {
+		args = append(args, "--compress")
+	}
+	if cfg.BackupParallelism > 0 {
+		args = append(args, fmt.Sprintf("--threads=%d", cfg.BackupParallelism))
+	}
+
+	// Extra args
+	if cfg.DumpExtraArgs != "" {
+		args = append(args, shellSplit(cfg.DumpExtraArgs)...)
+	}
+
+	// Database selection: mydumper dumps every database unless one is set
+	if !cfg.BackupAllDatabases {
+		if dbName == "" {
+			return nil, fmt.Errorf("no database name found; set DB_NAME, add a database to the URI, or use --all-databases")
+		}
+		args = append(args, "--database="+dbName)
+
+		excluded, tables, err := m.tableArgs(cfg, dbName)
+		if err != nil {
+			return nil, err
+		}
+		if len(tables) > 0 {
+			args = append(args, "--tables-list="+qualify(dbName, tables))
+		} else if len(excluded) > 0 {
+			// Without a list of tables to keep, skip the excluded ones
+			// with a negative lookahead on db.table
+			var quoted []string
+			for _, name := range excluded {
+				quoted = append(quoted, regexp.QuoteMeta(name))
+			}
+			args = append(args, fmt.Sprintf("--regex=^(?!%s\\.(%s)$)", regexp.QuoteMeta(dbName), strings.Join(quoted, "|")))
+		}
+	}
+
+	cmd, err := m.command(cfg, "mydumper", args)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// physicalBackupCommand builds the xtrabackup (mariabackup for mariadb)
+// command that copies the data directory as an xbstream to stdout. It
+// reads the data files directly, so it must run on the database host or
+// share its data directory. --target-dir only holds temporary files; each
+// run gets its own directory under BACKUP_TEMP_DIR, which Cleanup removes.
+func (m *MySQL) physicalBackupCommand(cfg *config.Config, mode string) (*exec.Cmd, error) {
+	if mode != "stream" {
+		return nil, fmt.Errorf("%s only supports stream mode (got %q)", m.backupTool(), mode)
+	}
+
+	targetDir, err := os.MkdirTemp(cfg.BackupTempDir, "dbstash-xtrabackup-")
+	if err != nil {
+		os.MkdirAll(cfg.BackupTempDir, 0o755)
+		targetDir, err = os.MkdirTemp(cfg.BackupTempDir, "dbstash-xtrabackup-")
+		if err != nil {
+			return nil, fmt.Errorf("creating target directory: %w", err)
+		}
+	}
+
+	args, _ := m.clientArgs(cfg)
+	args = append(args, "--backup", "--stream=xbstream", "--target-dir="+targetDir)
+	if cfg.BackupParallelism > 0 {
+		args = append(args, fmt.Sprintf("--parallel=%d", cfg.BackupParallelism))
+	}
+	if cfg.BackupCompress {
+		logger.Log.Warn().Str("engine", m.engineKey).Msg("physical mysql backups are not compressed; BACKUP_COMPRESS=true is a no-op")
+	}
+
+	// Extra args, such as --incremental-lsn or --datadir
+	if cfg.DumpExtraArgs != "" {
+		args = append(args, shellSplit(cfg.DumpExtraArgs)...)
+	}
+
+	cmd, err := m.command(cfg, m.backupTool(), args)
+	if err != nil {
+		os.RemoveAll(targetDir)
+		return nil, err
+	}
+	scratchDirs.Store(cmd, targetDir)
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// backupTool returns the physical backup tool: xtrabackup for mysql,
+// mariabackup (or mariadb-backup) for mariadb.
+func (m *MySQL) backupTool() string {
+	if m.engineKey == "mariadb" {
+		return m.program("mariabackup")
+	}
+	return "xtrabackup"
+}
+
+// qualify joins table names as a comma-separated list of db.table.
+func qualify(dbName string, tables []string) string {
+	qualified := make([]string, len(tables))
+	for i, name := range tables {
+		qualified[i] = dbName + "." + name
+	}
+	return strings.Join(qualified, ",")
+}
+
+// dumpTool returns the configured DUMP_TOOL, or mysqldump under the name
+// the engine's client tools are installed as.
+func (m *MySQL) dumpTool(cfg *config.Config) string {
+	if cfg.DumpTool != "" {
+		return cfg.DumpTool
+	}
+	return m.program("mysqldump")
+}
+
+// mariadbNames maps the MySQL client tools to the names MariaDB ships
+// them under. Recent MariaDB releases no longer install the MySQL names.
+var mariadbNames = map[string]string{
+	"mysql":       "mariadb",
+	"mysqldump":   "mariadb-dump",
+	"mysqlbinlog": "mariadb-binlog",
+	"mysqladmin":  "mariadb-admin",
+	"mariabackup": "mariadb-backup",
+}
+
+// program returns the name to run a MySQL client tool as: the MariaDB
+// name for the mariadb engine when it is installed.
+func (m *MySQL) program(tool string) string {
+	if native, ok := mariadbNames[tool]; ok && m.engineKey == "mariadb" {
+		if _, err := exec.LookPath(native); err == nil {
+			return native
+		}
+	}
+	return tool
+}
+
+// tableArgs translates BACKUP_INCLUDE and BACKUP_EXCLUDE into the tables
+// to leave out and the tables to dump (all if none). The dump tools only
+// take exact names, so wildcard patterns are expanded against the tables
+// of dbName, which are listed with the mysql client.
+func (m *MySQL) tableArgs(cfg *config.Config, dbName string) ([]string, []string, error) {
+	include, exclude := cfg.IncludePatterns(), cfg.ExcludePatterns()
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil, nil
+	}
+
+	// Without wildcards the patterns are the names
+	names := append(append([]string{}, include...), exclude...)
+	for _, p := range names {
+		if config.IsGlob(p) {
+			var err error
+			if names, err = m.listTables(cfg, dbName); err != nil {
+				return nil, nil, err
+			}
+			break
+		}
+	}
+
+	var excluded, tables []string
+	for _, name := range names {
+		switch {
+		case config.MatchAny(exclude, name):
+			excluded = append(excluded, name)
+		case config.MatchAny(include, name):
+			tables = append(tables, name)
+		}
+	}
+	if len(include) > 0 && len(tables) == 0 {
+		return nil, nil, fmt.Errorf("BACKUP_INCLUDE matches no tables in %s", dbName)
+	}
+	return excluded, tables, nil
+}
+
+// listTables returns the tables and views of dbName.
+func (m *MySQL) listTables(cfg *config.Config, dbName string) ([]string, error) {
+	args, _ := m.clientArgs(cfg)
+	args = append(args, "--batch", "--skip-column-names", "--execute=SHOW TABLES", dbName)
+	cmd, err := m.command(cfg, m.program("mysql"), args)
+	if err != nil {
+		return nil, err
+	}
+	defer Cleanup(cmd)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing tables of %s for BACKUP_INCLUDE/BACKUP_EXCLUDE: %w (stderr: %s)", dbName, err, stderr.String())
+	}
+	var tables []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if line != "" {
+			tables = append(tables, line)
+		}
+	}
+	return tables, nil
+}
+
+// binlogPositionFlag returns the mysqldump flag that writes the binlog
+// coordinates as a comment. MySQL renamed --master-data to --source-data
+// in 8.0.26; MariaDB only knows the old name.
+func binlogPositionFlag(version string) string {
+	if strings.Contains(version, "MariaDB") {
+		return "--master-data=2"
+	}
+	if m := mysqlVersionRe.FindStringSubmatch(version); m != nil {
+		major, _ := strconv.Atoi(m[1])
+		minor, _ := strconv.Atoi(m[2])
+		patch, _ := strconv.Atoi(m[3])
+		if major > 8 || (major == 8 && (minor > 0 || patch >= 26)) {
+			return "--source-data=2"
+		}
+	}
+	return "--master-data=2"
+}
+
+var mysqlVersionRe = regexp.MustCompile(`Ver (\d+)\.(\d+)\.(\d+)`)
+
+// Binlog coordinates in the mysqldump header: the file and position
+// (CHANGE MASTER TO on MariaDB and older MySQL, CHANGE REPLICATION SOURCE
+// TO since 8.0.23) and the GTID set (GTID_PURGED on MySQL, gtid_slave_pos
+// on MariaDB with --gtid).
+var (
+	binlogPosRe = regexp.MustCompile(`(?:MASTER|SOURCE)_LOG_FILE='([^']+)',\s*(?:MASTER|SOURCE)_LOG_POS=(\d+)`)
+	gtidSetRe   = regexp.MustCompile(`(?:GTID_PURGED=(?:/\*!80000 '\+'\*/ )?|gtid_slave_pos=)'([^']*)'`)
+)
+
+// Checkpoint and redo log positions xtrabackup and mariabackup report on
+// stderr. Older mariabackup releases word the redo line like xtrabackup.
+var (
+	checkpointLSNRe = regexp.MustCompile(`The latest check point \(for incremental\): '(\d+)'`)
+	lastLSNRe       = regexp.MustCompile(`(?:Transaction log of lsn \(\d+\) to \((\d+)\)|Redo log \(from LSN \d+ to (\d+)\)) was copied`)
+)
+
+// ParseMetadata records the binlog file, position, and GTID set a dump
+// taken with BACKUP_BINLOG_POSITION=true starts from. For physical
+// backups it records the checkpoint LSN (to_lsn, the --incremental-lsn of
+// a following incremental backup) and the last copied LSN (last_lsn).
+func (m *MySQL) ParseMetadata(cfg *config.Config, head, stderr string) map[string]string {
+	if cfg.BackupMethod == "physical" {
+		meta := map[string]string{}
+		if lsn := checkpointLSNRe.FindStringSubmatch(stderr); lsn != nil {
+			meta["to_lsn"] = lsn[1]
+		}
+		if lsn := lastLSNRe.FindStringSubmatch(stderr); lsn != nil {
+			// Only one of the two wordings matched
+			meta["last_lsn"] = lsn[1]
+			if lsn[1] == "" {
+				meta["last_lsn"] = lsn[2]
+			}
+		}
+		if len(meta) == 0 {
+			return nil
+		}
+		return meta
+	}
+	if !cfg.BackupBinlogPosition {
+		return nil
+	}
+	meta := map[string]string{}
+	if pos := binlogPosRe.FindStringSubmatch(head); pos != nil {
+		meta["binlog_file"] = pos[1]
+		meta["binlog_position"] = pos[2]
+	}
+	if gtid := gtidSetRe.FindStringSubmatch(head); gtid != nil && gtid[1] != "" {
+		meta["gtid_set"] = gtid[1]
+	}
+	if len(meta) == 0 {
+		return nil
+	}
+	return meta
+}
+
+// BinlogReceiveCommand builds the mysqlbinlog command that copies binlogs
+// from the server into dir, starting at startFile, and keeps following
+// the server as it writes new ones. Files keep their server-side names.
+func (m *MySQL) BinlogReceiveCommand(cfg *config.Config, dir, startFile string) (*exec.Cmd, error) {
+	args, _ := m.clientArgs(cfg)
+	args = append(args,
+		"--read-from-remote-server",
+		"--raw",
+		"--stop-never",
+		"--result-file="+strings.TrimRight(dir, "/")+"/",
+		startFile,
+	)
+	return m.command(cfg, m.program("mysqlbinlog"), args)
+}
+
+// FlushBinlogsCommand builds the mysql command that closes the current
+// binlog and starts a new one, so the closed file can be archived.
+func (m *MySQL) FlushBinlogsCommand(cfg *config.Config) (*exec.Cmd, error) {
+	args, _ := m.clientArgs(cfg)
+	args = append(args, "--execute=FLUSH BINARY LOGS")
+	return m.command(cfg, m.program("mysql"), args)
+}
+
+// BinlogReplayCommand builds the mysqlbinlog command that decodes files
+// as SQL for the mysql client, starting at startPos in the first file and
+// stopping before the first event after until. When dbName is set only
+// its events are kept, renamed to targetDB if that is set.
+func (m *MySQL) BinlogReplayCommand(files []string, startPos string, until time.Time, dbName, targetDB string) *exec.Cmd {
+	args := []string{"--start-position=" + startPos}
+	if !until.IsZero() {
+		args = append(args, "--stop-datetime="+until.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if dbName != "" {
+		if targetDB != "" && targetDB != dbName {
+			args = append(args, fmt.Sprintf("--rewrite-db=%s->%s", dbName, targetDB))
+			dbName = targetDB
+		}
+		args = append(args, "--database="+dbName)
+	}
+	args = append(args, files...)
+
+	// --stop-datetime is read in the local time zone
+	cmd := exec.Command(m.program("mysqlbinlog"), args...)
+	cmd.Env = append(os.Environ(), "TZ=UTC")
+	return cmd
+}
+
+// RestoreCommand builds the loader for the tool that took the dump:
+// xbstream extraction for physical backups, myloader for mydumper
+// directories, otherwise a mysql (or mariadb)
+// client command that replays a SQL dump from stdin. All-databases dumps
+// carry their own USE statements. mysqldump output drops each table
+// before recreating it, so Clean needs no flag.
+func (m *MySQL) RestoreCommand(cfg *config.Config, opts RestoreOptions) (*exec.Cmd, error) {
+	if opts.Physical {
+		return m.physicalRestoreCommand(opts)
+	}
+	tool := opts.DumpTool
+	if tool == "" {
+		tool = m.dumpTool(cfg)
+	}
+	if tool == "mydumper" {
+		return m.myloaderCommand(cfg, opts)
+	}
+
+	if opts.Mode != "stream" && opts.Mode != "file" {
+		return nil, fmt.Errorf("mysql restore only supports stream/file backups, or directory/tar backups taken with DUMP_TOOL=mydumper (got %q)", opts.Mode)
+	}
+	if opts.Jobs > 1 {
+		return nil, fmt.Errorf("parallel restore is not supported for %s backups", tool)
+	}
+	allDatabases := restoresAllDatabases(cfg, opts)
+	if allDatabases && opts.TargetDB != "" {
+		return nil, fmt.Errorf("a target database cannot be set when restoring all databases")
+	}
+
+	args, dbName := m.clientArgs(cfg)
+
+	if !allDatabases {
+		target, err := restoreDatabase(cfg, opts)
+		if err != nil {
+			return nil, err
+		}
+		if target != "" {
+			dbName = target
+		}
+		if dbName == "" {
+			return nil, fmt.Errorf("no database name found; set DB_NAME, add a database to the URI, or use --all-databases")
+		}
+		args = append(args, dbName)
+	}
+
+	loader := m.program("mysql")
+	if tool == "mariadb-dump" {
+		loader = "mariadb"
+	}
+	cmd, err := m.command(cfg, loader, args)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// myloaderCommand builds the myloader command that loads a mydumper
+// directory from opts.Dir. A target database is created if missing.
+func (m *MySQL) myloaderCommand(cfg *config.Config, opts RestoreOptions) (*exec.Cmd, error) {
+	if opts.Mode != "directory" && opts.Mode != "tar" {
+		return nil, fmt.Errorf("mydumper backups are restored from directory or tar mode (got %q)", opts.Mode)
+	}
+
+	args, _ := m.loaderArgs(cfg)
+	args = append(args, "--directory="+opts.Dir)
+	if opts.Clean {
+		args = append(args, "--overwrite-tables")
+	}
+	if opts.Jobs > 0 {
+		args = append(args, fmt.Sprintf("--threads=%d", opts.Jobs))
+	}
+	if opts.TargetDB != "" {
+		if restoresAllDatabases(cfg, opts) {
+			return nil, fmt.Errorf("a target database cannot be set when restoring all databases")
+		}
+		args = append(args, "--database="+opts.TargetDB)
+	}
+
+	cmd, err := m.command(cfg, "myloader", args)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// physicalRestoreCommand extracts an xbstream from stdin into
+// opts.DataDir, which must be empty or missing, and prepares it so the
+// server can start on it. The server must be stopped, and the files must
+// be owned by its user before it is started.
+func (m *MySQL) physicalRestoreCommand(opts RestoreOptions) (*exec.Cmd, error) {
+	if opts.DataDir == "" {
+		return nil, fmt.Errorf("physical backups are restored into a data directory; set --data-dir")
+	}
+	if opts.TargetDB != "" || opts.Clean || opts.Jobs > 1 {
+		return nil, fmt.Errorf("--target-db, --clean, and --jobs do not apply to physical backups")
+	}
+
+	extract, prepare := "xbstream", "xtrabackup"
+	if m.engineKey == "mariadb" {
+		extract, prepare = "mbstream", m.program("mariabackup")
+	}
+	script := `if [ -n "$(ls -A "$1" 2>/dev/null)" ]; then echo "data directory $1 is not empty" >&2; exit 1; fi && ` +
+		`mkdir -p "$1" && ` + extract + ` -x -C "$1" && ` + prepare + ` --prepare --target-dir="$1"`
+	cmd := exec.Command("sh", "-c", script, "sh", opts.DataDir)
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// ListDatabasesCommand lists the databases mysqldump --all-databases
+// would dump, which leaves out the schemas the server generates.
+func (m *MySQL) ListDatabasesCommand(cfg *config.Config) (*exec.Cmd, error) {
+	args, _ := m.clientArgs(cfg)
+	args = append(args, "--batch", "--skip-column-names",
+		"--execute=SELECT schema_name FROM information_schema.schemata "+
+			"WHERE schema_name NOT IN ('information_schema', 'performance_schema', 'sys') ORDER BY schema_name")
+	cmd, err := m.command(cfg, m.program("mysql"), args)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// GlobalsCommand returns nil: accounts and grants live in the mysql
+// database, which is backed up like any other.
+func (m *MySQL) GlobalsCommand(_ *config.Config) (*exec.Cmd, error) {
+	return nil, nil
+}
+
+// ResetCommand drops and recreates dbName.
+func (m *MySQL) ResetCommand(cfg *config.Config, dbName string) (*exec.Cmd, error) {
+	args, _ := m.clientArgs(cfg)
+	ident := "`" + strings.ReplaceAll(dbName, "`", "``") + "`"
+	args = append(args, fmt.Sprintf("--execute=DROP DATABASE IF EXISTS %s; CREATE DATABASE %s", ident, ident))
+	cmd, err := m.command(cfg, m.program("mysql"), args)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// Ping checks that the server answers with mysqladmin ping, which
+// succeeds even if the credentials are refused.
+func (m *MySQL) Ping(ctx context.Context, cfg *config.Config) error {
+	args, _ := m.clientArgs(cfg)
+	cmd, err := m.command(cfg, m.program("mysqladmin"), append(args, "ping"))
+	if err != nil {
+		return err
+	}
+	_, err = run(ctx, cmd)
+	return err
+}
+
+// ServerVersion returns the server's VERSION(), e.g. 8.0.36 or
+// 10.11.6-MariaDB.
+func (m *MySQL) ServerVersion(ctx context.Context, cfg *config.Config) (string, error) {
+	args, _ := m.clientArgs(cfg)
+	args = append(args, "--batch", "--skip-column-names", "--execute=SELECT VERSION()")
+	cmd, err := m.command(cfg, m.program("mysql"), args)
+	if err != nil {
+		return "", err
+	}
+	output, err := run(ctx, cmd)
+	if err != nil {
+		return "", err
+	}
+	// Drop the distribution suffix MariaDB packages add after the flavor
+	version := strings.TrimSpace(output)
+	if i := strings.Index(version, "-MariaDB"); i >= 0 {
+		version = version[:i+len("-MariaDB")]
+	}
+	return version, nil
+}
+
+// CheckVersion compares the server with the tool that backs it up. The
+// physical backup tools refuse servers of another release series, so they
+// must match it and be at least as new. A logical dump from an older
+// client may miss newer features, so that is only a warning; the MySQL
+// and MariaDB releases are numbered apart and are not compared. mydumper
+// is versioned on its own and is not checked.
+func (m *MySQL) CheckVersion(cfg *config.Config, server string) (string, error) {
+	tool := m.dumpTool(cfg)
+	if cfg.BackupMethod == "physical" {
+		tool = m.backupTool()
+	} else if tool == "mydumper" {
+		return "", nil
+	}
+	installed, toolMariaDB := mysqlToolVersion(ToolVersion(tool))
+	toolVersion, serverVersion := parseVersion(installed), parseVersion(server)
+	if toolVersion == nil || serverVersion == nil {
+		return "", nil
+	}
+	flavor, serverMariaDB := "MySQL", strings.Contains(server, "MariaDB")
+	if serverMariaDB {
+		flavor = "MariaDB"
+	}
+
+	if cfg.BackupMethod == "physical" {
+		if compareVersions(toolVersion, serverVersion, 2) != 0 || compareVersions(toolVersion, serverVersion, 3) < 0 {
+			return "", fmt.Errorf("%s %s cannot back up the %s %s server; use the %s release for %d.%d, %s or later",
+				tool, installed, flavor, server, tool, serverVersion[0], serverVersion[1], versionPattern.FindString(server))
+		}
+		return "", nil
+	}
+	if toolMariaDB == serverMariaDB && compareVersions(toolVersion, serverVersion, 2) < 0 {
+		return fmt.Sprintf("%s %s is older than the %s %s server and may not dump its newer features; use %s %d.%d or later",
+			tool, installed, flavor, server, tool, serverVersion[0], serverVersion[1]), nil
+	}
+	return "", nil
+}
+
+// mysqlToolVersion returns the server release a MySQL or MariaDB tool
+// belongs to from its --version line, and whether it is a MariaDB tool.
+// MariaDB's tools report their own version first and the release after
+// "Distrib", "from", or "based on MariaDB server".
+func mysqlToolVersion(line string) (string, bool) {
+	mariadb := strings.Contains(line, "MariaDB")
+	for _, marker := range []string{"Distrib ", " from ", "based on MariaDB server ", "based on MySQL server "} {
+		if _, rest, ok := strings.Cut(line, marker); ok {
+			return versionPattern.FindString(rest), mariadb
+		}
+	}
+	// mysqldump  Ver 8.0.36 for Linux on x86_64 (MySQL Community Server - GPL)
+	if _, rest, ok := strings.Cut(line, "Ver "); ok {
+		return versionPattern.FindString(rest), mariadb
+	}
+	return versionPattern.FindString(line), mariadb
+}
+
+// QueryCommand runs script through the mysql client, which stops at the
+// first error in batch mode.
+func (m *MySQL) QueryCommand(cfg *config.Config, dbName, script string) (*exec.Cmd, error) {
+	args, _ := m.clientArgs(cfg)
+	args = append(args, dbName)
+	cmd, err := m.command(cfg, m.program("mysql"), args)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin = strings.NewReader(script)
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// clientArgs returns the mysql client connection flags and the configured
+// database name. The password is passed by command.
+func (m *MySQL) clientArgs(cfg *config.Config) ([]string, string) {
+	var args []string
+	host, port, user, _, dbName := m.resolveConnection(cfg)
+
+	if host != "" {
+		args = append(args, fmt.Sprintf("--host=%s", host))
+	}
+	if port != "" {
+		args = append(args, fmt.Sprintf("--port=%s", port))
+	}
+	if user != "" {
+		args = append(args, fmt.Sprintf("--user=%s", user))
+	}
+	args = append(args, m.tlsArgs(cfg, false)...)
+	return args, dbName
+}
+
+// loaderArgs returns the mydumper/myloader connection flags and the
+// configured database name. The password is passed by command.
+func (m *MySQL) loaderArgs(cfg *config.Config) ([]string, string) {
+	var args []string
+	host, port, user, _, dbName := m.resolveConnection(cfg)
+
+	if host != "" {
+		args = append(args, fmt.Sprintf("--host=%s", host))
+	}
+	if port != "" {
+		args = append(args, fmt.Sprintf("--port=%s", port))
+	}
+	if user != "" {
+		args = append(args, fmt.Sprintf("--user=%s", user))
+	}
+	args = append(args, m.tlsArgs(cfg, true)...)
+	return args, dbName
+}
+
+// command builds the exec.Cmd for a MySQL tool. The password is written
+// to an option file passed with --defaults-extra-file, which must be the
+// first argument, instead of -p, where any process on the host could read
+// it. The physical backup tools also read it from their own group.
+// Cleanup removes the file.
+func (m *MySQL) command(cfg *config.Config, name string, args []string) (*exec.Cmd, error) {
+	_, _, _, password, _ := m.resolveConnection(cfg)
+	if password == "" {
+		return exec.Command(name, args...), nil
+	}
+
+	groups := []string{"client"}
+	if name == m.backupTool() {
+		groups = append(groups, "xtrabackup")
+	}
+	value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(password)
+	var file strings.Builder
+	for _, group := range groups {
+		fmt.Fprintf(&file, "[%s]\npassword=\"%s\"\n", group, value)
+	}
+	path, err := writeSecretFile(cfg.BackupTempDir, "mysql-*.cnf", file.String())
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(name, append([]string{"--defaults-extra-file=" + path}, args...)...)
+	secretFiles.Store(cmd, path)
+	return cmd, nil
+}
+
+// mysqlSSLModes maps DB_TLS_MODE to the --ssl-mode values of the MySQL
+// client tools.
+var mysqlSSLModes = map[string]string{
+	"disable":     "DISABLED",
+	"prefer":      "PREFERRED",
+	"require":     "REQUIRED",
+	"verify-ca":   "VERIFY_CA",
+	"verify-full": "VERIFY_IDENTITY",
+}
+
+// tlsArgs returns the TLS flags for the client tools, or for
+// mydumper/myloader when loader is set. MariaDB's tools have no
+// --ssl-mode: TLS is turned on with --ssl, and the client tools verify
+// the server certificate and host name with --ssl-verify-server-cert.
+func (m *MySQL) tlsArgs(cfg *config.Config, loader bool) []string {
+	var args []string
+	if m.engineKey != "mariadb" {
+		if cfg.DBTLSMode != "" {
+			args = append(args, "--ssl-mode="+mysqlSSLModes[cfg.DBTLSMode])
+		}
+	} else {
+		switch cfg.DBTLSMode {
+		case "disable":
+			if !loader {
+				args = append(args, "--skip-ssl")
+			}
+		case "require":
+			args = append(args, "--ssl")
+		case "verify-ca", "verify-full":
+			args = append(args, "--ssl")
+			if !loader {
+				args = append(args, "--ssl-verify-server-cert")
+			}
+		}
+	}
+
+	prefix := "--ssl-"
+	if loader {
+		prefix = "--"
+	}
+	if cfg.DBTLSCAFile != "" {
+		args = append(args, prefix+"ca="+cfg.DBTLSCAFile)
+	}
+	if cfg.DBTLSCertFile != "" {
+		args = append(args, prefix+"cert="+cfg.DBTLSCertFile)
+	}
+	if cfg.DBTLSKeyFile != "" {
+		args = append(args, prefix+"key="+cfg.DBTLSKeyFile)
+	}
+	return args
+}
+
 // resolveConnection parses DB_URI into components or uses individual vars.
 func (m *MySQL) resolveConnection(cfg *config.Config) (host, port, user, password, dbName string) {
 	if cfg.DBURI != "" {
@@ -92,7 +817,13 @@ func (m *MySQL) resolveConnection(cfg *config.Config) (host, port, user, passwor
 }
 
 // DefaultExtension returns ".sql" — mysqldump always outputs SQL.
-func (m *MySQL) DefaultExtension(_ bool) string { return ".sql" }
+// Physical backups are xbstream archives.
+func (m *MySQL) DefaultExtension(cfg *config.Config, _ string, _ bool) string {
+	if cfg.BackupMethod == "physical" {
+		return ".xbstream"
+	}
+	return ".sql"
+}
 
 // SupportsCompression returns false — mysqldump has no native compression.
 func (m *MySQL) SupportsCompression() bool { return false }
@@ -1,9 +1,14 @@
 package engine
 
 import (
+	"context"
 	"fmt"
+	"net/url"
 	"os"
 	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/viperadnan-git/dbstash/internal/config"
 	"github.com/viperadnan-git/dbstash/internal/logger"
@@ -15,8 +20,12 @@ type Postgres struct{}
 // Name returns "pg".
 func (p *Postgres) Name() string { return "pg" }
 
-// DumpCommand builds the pg_dump (or pg_dumpall) command for the given mode.
+// DumpCommand builds the pg_dump (or pg_dumpall, or pg_basebackup) command
+// for the given mode.
 func (p *Postgres) DumpCommand(cfg *config.Config, mode string, outputDir string) (*exec.Cmd, error) {
+	if cfg.BackupMethod == "physical" {
+		return p.baseBackupCommand(cfg, mode)
+	}
 	if cfg.BackupAllDatabases {
 		return p.dumpAllCommand(cfg, mode, outputDir)
 	}
@@ -38,42 +47,40 @@ func (p *Postgres) DumpCommand(cfg *config.Config, mode string, outputDir string
 		}
 	case "directory":
 		args = append(args, "--format=directory", fmt.Sprintf("--file=%s", outputDir))
+		if cfg.BackupParallelism > 0 {
+			args = append(args, fmt.Sprintf("--jobs=%d", cfg.BackupParallelism))
+		}
 	default:
 		return nil, fmt.Errorf("unsupported mode for postgres: %s", mode)
 	}
 
+	// Filters: pg_dump matches the patterns itself. Excluded tables keep
+	// their definitions so views and foreign keys still restore
+	for _, p := range cfg.IncludePatterns() {
+		args = append(args, fmt.Sprintf("--table=%s", p))
+	}
+	for _, p := range cfg.ExcludePatterns() {
+		args = append(args, fmt.Sprintf("--exclude-table-data=%s", p))
+	}
+
 	// Extra args
 	if cfg.DumpExtraArgs != "" {
 		args = append(args, shellSplit(cfg.DumpExtraArgs)...)
 	}
 
-	// Connection: prefer URI, otherwise set env vars for pg_dump
-	if cfg.DBURI != "" {
-		if dbNameFromURI(cfg.DBURI) == "" {
+	// Connection: prefer URI, otherwise pg_dump reads PGHOST, PGPORT, etc.
+	uri, env := p.connection(cfg)
+	if uri != "" {
+		if dbNameFromURI(uri) == "" {
 			return nil, fmt.Errorf("postgres URI has no database name; set DB_NAME, add a database to the URI, or use --all-databases")
 		}
-		args = append(args, cfg.DBURI)
+		args = append(args, uri)
 	} else {
-		// pg_dump reads PGHOST, PGPORT, etc. from environment
-		if cfg.DBHost != "" {
-			os.Setenv("PGHOST", cfg.DBHost)
-		}
-		if cfg.DBPort != "" {
-			os.Setenv("PGPORT", cfg.DBPort)
-		}
-		if cfg.DBName != "" {
-			os.Setenv("PGDATABASE", cfg.DBName)
-		}
-		if cfg.DBUser != "" {
-			os.Setenv("PGUSER", cfg.DBUser)
-		}
-		if cfg.DBPassword != "" {
-			os.Setenv("PGPASSWORD", cfg.DBPassword)
-		}
 		args = append(args, cfg.DBName)
 	}
 
 	cmd := exec.Command("pg_dump", args...)
+	cmd.Env = env
 	cmd.Stderr = os.Stderr
 	return cmd, nil
 }
@@ -94,37 +101,421 @@ func (p *Postgres) dumpAllCommand(cfg *config.Config, mode string, outputFile st
 	if cfg.DumpExtraArgs != "" {
 		args = append(args, shellSplit(cfg.DumpExtraArgs)...)
 	}
+	connArgs, env := p.dumpAllConnArgs(cfg)
+	args = append(args, connArgs...)
+
+	if mode == "file" && outputFile != "" {
+		args = append(args, fmt.Sprintf("--file=%s", outputFile))
+	}
 
-	// Connection: prefer URI via -d, otherwise env vars
+	cmd := exec.Command("pg_dumpall", args...)
+	cmd.Env = env
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// dumpAllConnArgs returns the pg_dumpall connection flags and environment.
+// Without a URI, the connection is passed through PG* environment variables.
+func (p *Postgres) dumpAllConnArgs(cfg *config.Config) ([]string, []string) {
+	uri, env := p.connection(cfg)
 	// Strip database name from URI — pg_dumpall uses it only for connection
-	if cfg.DBURI != "" {
-		args = append(args, "-d", stripDBFromURI(cfg.DBURI))
+	if uri != "" {
+		return []string{"-d", stripDBFromURI(uri)}, env
+	}
+	return nil, env
+}
+
+// ListDatabasesCommand lists the databases pg_dumpall would dump: every
+// database that accepts connections, except the templates.
+func (p *Postgres) ListDatabasesCommand(cfg *config.Config) (*exec.Cmd, error) {
+	dbnameArg, env := p.dbnameArg(cfg, "postgres")
+	args := []string{
+		"--set=ON_ERROR_STOP=1", "--quiet", "--no-psqlrc", "--tuples-only", "--no-align",
+		"--command=SELECT datname FROM pg_database WHERE datallowconn AND NOT datistemplate ORDER BY datname",
+		dbnameArg,
+	}
+	cmd := exec.Command("psql", args...)
+	cmd.Env = env
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// GlobalsCommand builds the pg_dumpall --globals-only command that dumps
+// the roles and tablespaces, which pg_dump leaves out of each database.
+func (p *Postgres) GlobalsCommand(cfg *config.Config) (*exec.Cmd, error) {
+	connArgs, env := p.dumpAllConnArgs(cfg)
+	args := append([]string{"--globals-only"}, connArgs...)
+	cmd := exec.Command("pg_dumpall", args...)
+	cmd.Env = env
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// baseBackupCommand builds a pg_basebackup command that writes the whole
+// cluster as a single tar stream to stdout. WAL is fetched into the same
+// stream at the end of the backup (streaming WAL cannot be combined with
+// stdout output), so the backup is self-contained. The server must allow
+// replication connections for the configured user.
+func (p *Postgres) baseBackupCommand(cfg *config.Config, mode string) (*exec.Cmd, error) {
+	if mode != "stream" {
+		return nil, fmt.Errorf("pg_basebackup only supports stream mode (got %q)", mode)
+	}
+
+	// --verbose reports the WAL start and end points parsed by ParseMetadata
+	args := []string{"--pgdata=-", "--format=tar", "--wal-method=fetch", "--verbose"}
+	if cfg.BackupCompress {
+		args = append(args, "--gzip")
+	}
+
+	// Extra args
+	if cfg.DumpExtraArgs != "" {
+		args = append(args, shellSplit(cfg.DumpExtraArgs)...)
+	}
+
+	// Connection: prefer URI via --dbname, otherwise env vars
+	uri, env := p.connection(cfg)
+	if uri != "" {
+		args = append(args, fmt.Sprintf("--dbname=%s", uri))
+	}
+
+	cmd := exec.Command("pg_basebackup", args...)
+	cmd.Env = env
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// ReceiveWALCommand builds a pg_receivewal command that streams WAL into
+// dir until it fails; it does not retry on its own. With create set, it
+// creates the replication slot (if missing) and exits instead.
+func (p *Postgres) ReceiveWALCommand(cfg *config.Config, dir, slot string, create bool) *exec.Cmd {
+	var args []string
+	if create {
+		args = append(args, "--create-slot", "--if-not-exists", fmt.Sprintf("--slot=%s", slot))
+	} else {
+		args = append(args, fmt.Sprintf("--directory=%s", dir), "--no-loop", "--verbose")
+		if slot != "" {
+			args = append(args, fmt.Sprintf("--slot=%s", slot))
+		}
+	}
+
+	// Connection: prefer URI via --dbname, otherwise env vars
+	uri, env := p.connection(cfg)
+	if uri != "" {
+		args = append(args, fmt.Sprintf("--dbname=%s", uri))
+	}
+
+	cmd := exec.Command("pg_receivewal", args...)
+	cmd.Env = env
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// WAL positions pg_basebackup --verbose reports. Servers before
+// PostgreSQL 10 call the WAL the "transaction log".
+var (
+	walStartRe = regexp.MustCompile(`(?:write-ahead|transaction) log start point: (\S+) on timeline (\d+)`)
+	walEndRe   = regexp.MustCompile(`(?:write-ahead|transaction) log end point: (\S+)`)
+)
+
+// ParseMetadata records the WAL start and stop LSN and the timeline of a
+// physical backup. Logical dumps report nothing worth keeping.
+func (p *Postgres) ParseMetadata(cfg *config.Config, _, stderr string) map[string]string {
+	if cfg.BackupMethod != "physical" {
+		return nil
+	}
+	meta := map[string]string{}
+	if m := walStartRe.FindStringSubmatch(stderr); m != nil {
+		meta["start_lsn"] = m[1]
+		meta["timeline"] = m[2]
+	}
+	if m := walEndRe.FindStringSubmatch(stderr); m != nil {
+		meta["stop_lsn"] = m[1]
+	}
+	if len(meta) == 0 {
+		return nil
+	}
+	return meta
+}
+
+// RestoreCommand builds the loader for a pg backup: pg_restore for custom
+// (compressed) and directory format dumps, psql for plain SQL, and tar
+// for physical backups.
+func (p *Postgres) RestoreCommand(cfg *config.Config, opts RestoreOptions) (*exec.Cmd, error) {
+	if opts.Physical {
+		return p.physicalRestoreCommand(opts)
+	}
+
+	var args []string
+	tool := "pg_restore"
+
+	switch opts.Mode {
+	case "stream", "file":
+		if !opts.Compressed {
+			tool = "psql"
+		}
+	case "directory", "tar":
+		args = append(args, "--format=directory")
+	default:
+		return nil, fmt.Errorf("unsupported mode for postgres: %s", opts.Mode)
+	}
+
+	allDatabases := restoresAllDatabases(cfg, opts)
+	if allDatabases && opts.TargetDB != "" {
+		return nil, fmt.Errorf("pg_dumpall backups recreate their own databases; a target database cannot be set")
+	}
+
+	if tool == "psql" {
+		if opts.Clean {
+			return nil, fmt.Errorf("plain SQL dumps cannot be cleaned before restore; drop the database first or use BACKUP_COMPRESS=true")
+		}
+		if opts.Jobs > 1 {
+			return nil, fmt.Errorf("parallel restore is not supported for plain SQL dumps")
+		}
+		args = append(args, "--set=ON_ERROR_STOP=1", "--quiet")
 	} else {
-		if cfg.DBHost != "" {
-			os.Setenv("PGHOST", cfg.DBHost)
+		args = append(args, "--exit-on-error")
+		if opts.Clean {
+			args = append(args, "--clean", "--if-exists")
 		}
-		if cfg.DBPort != "" {
-			os.Setenv("PGPORT", cfg.DBPort)
+		if opts.Jobs > 1 {
+			// pg_restore can only parallelize when it can seek the archive
+			if opts.Mode != "directory" && opts.Mode != "tar" {
+				return nil, fmt.Errorf("parallel restore requires a directory or tar mode backup (got %q)", opts.Mode)
+			}
+			args = append(args, fmt.Sprintf("--jobs=%d", opts.Jobs))
 		}
-		if cfg.DBUser != "" {
-			os.Setenv("PGUSER", cfg.DBUser)
+	}
+
+	// pg_dumpall output recreates databases itself, so connect to the
+	// maintenance database instead of the (possibly missing) target
+	dbName := "postgres"
+	if !allDatabases {
+		var err error
+		if dbName, err = restoreDatabase(cfg, opts); err != nil {
+			return nil, err
 		}
-		if cfg.DBPassword != "" {
-			os.Setenv("PGPASSWORD", cfg.DBPassword)
+	}
+
+	uri, env := p.connection(cfg)
+	if uri != "" {
+		if dbName != "" {
+			uri = withDBInURI(uri, dbName)
+		} else if dbNameFromURI(uri) == "" {
+			return nil, fmt.Errorf("postgres URI has no database name; set DB_NAME, add a database to the URI, or use --all-databases")
 		}
+		args = append(args, fmt.Sprintf("--dbname=%s", uri))
+	} else {
+		if dbName == "" {
+			dbName = cfg.DBName
+		}
+		args = append(args, fmt.Sprintf("--dbname=%s", dbName))
 	}
 
-	if mode == "file" && outputFile != "" {
-		args = append(args, fmt.Sprintf("--file=%s", outputFile))
+	if tool == "pg_restore" && (opts.Mode == "directory" || opts.Mode == "tar") {
+		args = append(args, opts.Dir)
 	}
 
-	cmd := exec.Command("pg_dumpall", args...)
+	cmd := exec.Command(tool, args...)
+	cmd.Env = env
 	cmd.Stderr = os.Stderr
 	return cmd, nil
 }
 
+// physicalRestoreCommand extracts a pg_basebackup tar stream from stdin
+// into opts.DataDir, which must be empty or missing. The server must be
+// stopped; it replays the included WAL when started on the directory.
+func (p *Postgres) physicalRestoreCommand(opts RestoreOptions) (*exec.Cmd, error) {
+	if opts.DataDir == "" {
+		return nil, fmt.Errorf("physical backups are restored into a data directory; set --data-dir")
+	}
+	if opts.TargetDB != "" || opts.Clean || opts.Jobs > 1 {
+		return nil, fmt.Errorf("--target-db, --clean, and --jobs do not apply to physical backups")
+	}
+
+	extract := `tar -xf - -C "$1"`
+	if opts.Compressed {
+		extract = `tar -xzf - -C "$1"`
+	}
+	script := `if [ -n "$(ls -A "$1" 2>/dev/null)" ]; then echo "data directory $1 is not empty" >&2; exit 1; fi && ` +
+		`mkdir -p "$1" && chmod 700 "$1" && ` + extract
+	cmd := exec.Command("sh", "-c", script, "sh", opts.DataDir)
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// ResetCommand drops and recreates dbName, connecting through the
+// postgres maintenance database.
+func (p *Postgres) ResetCommand(cfg *config.Config, dbName string) (*exec.Cmd, error) {
+	ident := quotePGIdent(dbName)
+	dbnameArg, env := p.dbnameArg(cfg, "postgres")
+	args := []string{
+		"--set=ON_ERROR_STOP=1", "--quiet", "--no-psqlrc",
+		"--command=DROP DATABASE IF EXISTS " + ident,
+		"--command=CREATE DATABASE " + ident,
+		dbnameArg,
+	}
+	cmd := exec.Command("psql", args...)
+	cmd.Env = env
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// Ping checks that the server accepts connections with pg_isready.
+func (p *Postgres) Ping(ctx context.Context, cfg *config.Config) error {
+	uri, env := p.connection(cfg)
+	var args []string
+	if uri != "" {
+		args = append(args, fmt.Sprintf("--dbname=%s", uri))
+	}
+	cmd := exec.Command("pg_isready", args...)
+	cmd.Env = env
+	_, err := run(ctx, cmd)
+	return err
+}
+
+// ServerVersion returns the server_version the server reports, without
+// the build details.
+func (p *Postgres) ServerVersion(ctx context.Context, cfg *config.Config) (string, error) {
+	dbName := cfg.DBName
+	if cfg.DBURI != "" {
+		dbName = dbNameFromURI(cfg.DBURI)
+	}
+	if dbName == "" {
+		dbName = "postgres"
+	}
+	dbnameArg, env := p.dbnameArg(cfg, dbName)
+	cmd := exec.Command("psql", "--no-psqlrc", "--tuples-only", "--no-align", "--command=SHOW server_version", dbnameArg)
+	cmd.Env = env
+	output, err := run(ctx, cmd)
+	if err != nil {
+		return "", err
+	}
+	version, _, _ := strings.Cut(strings.TrimSpace(output), " ")
+	return version, nil
+}
+
+// CheckVersion refuses a dump tool older than the server: pg_dump,
+// pg_dumpall, and pg_basebackup only back up servers of their own major
+// version or older.
+func (p *Postgres) CheckVersion(cfg *config.Config, server string) (string, error) {
+	tool := "pg_dump"
+	switch {
+	case cfg.BackupMethod == "physical":
+		tool = "pg_basebackup"
+	case cfg.BackupAllDatabases && !cfg.BackupSplitDatabases:
+		tool = "pg_dumpall"
+	}
+	installed := versionPattern.FindString(ToolVersion(tool))
+	toolVersion, serverVersion := parseVersion(installed), parseVersion(server)
+	if toolVersion == nil || serverVersion == nil {
+		return "", nil
+	}
+	if comparePGMajor(toolVersion, serverVersion) < 0 {
+		return "", fmt.Errorf("%s %s is older than the PostgreSQL %s server and cannot back it up; use %s %s or later",
+			tool, installed, server, tool, pgMajor(serverVersion))
+	}
+	return "", nil
+}
+
+// pgMajor returns the major version: the first part since PostgreSQL 10,
+// the first two before.
+func pgMajor(version []int) string {
+	if version[0] >= 10 || len(version) < 2 {
+		return strconv.Itoa(version[0])
+	}
+	return fmt.Sprintf("%d.%d", version[0], version[1])
+}
+
+// comparePGMajor compares the major versions of a and b.
+func comparePGMajor(a, b []int) int {
+	n := 1
+	if a[0] < 10 || b[0] < 10 {
+		n = 2
+	}
+	return compareVersions(a, b, n)
+}
+
+// QueryCommand runs script through psql, stopping at the first error.
+func (p *Postgres) QueryCommand(cfg *config.Config, dbName, script string) (*exec.Cmd, error) {
+	dbnameArg, env := p.dbnameArg(cfg, dbName)
+	args := []string{"--set=ON_ERROR_STOP=1", "--quiet", "--no-psqlrc", dbnameArg}
+	cmd := exec.Command("psql", args...)
+	cmd.Env = env
+	cmd.Stdin = strings.NewReader(script)
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// dbnameArg returns the --dbname flag that connects to dbName with the
+// configured credentials, and the environment for the command. Without a
+// URI, the connection is passed through PG* environment variables.
+func (p *Postgres) dbnameArg(cfg *config.Config, dbName string) (string, []string) {
+	uri, env := p.connection(cfg)
+	if uri != "" {
+		return fmt.Sprintf("--dbname=%s", withDBInURI(uri, dbName)), env
+	}
+	return fmt.Sprintf("--dbname=%s", dbName), env
+}
+
+// connection returns the URI to connect with (empty without DB_URI) and
+// the environment for a libpq tool: the PG* connection and TLS variables.
+// The password is always passed as PGPASSWORD, never in the arguments,
+// where any process on the host could read it. sslmode and the
+// certificate parameters in DB_URI override the TLS variables.
+func (p *Postgres) connection(cfg *config.Config) (string, []string) {
+	env := os.Environ()
+	set := func(key, value string) {
+		if value != "" {
+			env = append(env, key+"="+value)
+		}
+	}
+
+	uri := cfg.DBURI
+	if uri != "" {
+		var password string
+		uri, password = withoutPassword(uri)
+		set("PGPASSWORD", password)
+	} else {
+		set("PGHOST", cfg.DBHost)
+		set("PGPORT", cfg.DBPort)
+		set("PGUSER", cfg.DBUser)
+		set("PGPASSWORD", cfg.DBPassword)
+	}
+	set("PGSSLMODE", cfg.DBTLSMode)
+	set("PGSSLROOTCERT", cfg.DBTLSCAFile)
+	set("PGSSLCERT", cfg.DBTLSCertFile)
+	set("PGSSLKEY", cfg.DBTLSKeyFile)
+	return uri, env
+}
+
+// withoutPassword returns uri without the password, and the password.
+func withoutPassword(uri string) (string, string) {
+	u, err := url.Parse(uri)
+	if err != nil || u.User == nil {
+		return uri, ""
+	}
+	password, ok := u.User.Password()
+	if !ok {
+		return uri, ""
+	}
+	u.User = url.User(u.User.Username())
+	return u.String(), password
+}
+
+// quotePGIdent quotes a PostgreSQL identifier.
+func quotePGIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
 // DefaultExtension returns the file extension based on compression.
-func (p *Postgres) DefaultExtension(compressed bool) string {
+// Physical backups are tar archives.
+func (p *Postgres) DefaultExtension(cfg *config.Config, _ string, compressed bool) string {
+	if cfg.BackupMethod == "physical" {
+		if compressed {
+			return ".tar.gz"
+		}
+		return ".tar"
+	}
 	if compressed {
 		return ".dump"
 	}
@@ -1,10 +1,15 @@
 package engine
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/url"
 	"os"
 	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/viperadnan-git/dbstash/internal/config"
 )
@@ -21,20 +26,11 @@ func (r *Redis) DumpCommand(cfg *config.Config, mode string, _ string) (*exec.Cm
 		return nil, fmt.Errorf("redis only supports stream/file mode (got %q)", mode)
 	}
 
-	var args []string
-	host, port, password := r.resolveConnection(cfg)
-
-	if host != "" {
-		args = append(args, "-h", host)
-	}
-	if port != "" {
-		args = append(args, "-p", port)
+	conn, err := r.node(cfg)
+	if err != nil {
+		return nil, err
 	}
-	if password != "" {
-		args = append(args, "-a", password)
-		args = append(args, "--no-auth-warning")
-	}
-
+	args := r.connArgs(cfg, conn)
 	args = append(args, "--rdb", "-")
 
 	// Extra args
@@ -42,31 +38,311 @@ func (r *Redis) DumpCommand(cfg *config.Config, mode string, _ string) (*exec.Cm
 		args = append(args, shellSplit(cfg.DumpExtraArgs)...)
 	}
 
+	cmd := r.command(conn, args)
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// node returns the server to back up: the cluster shard set by
+// config.ForShard, the master (or a replica) the Sentinel reports for
+// REDIS_SENTINEL_MASTER, or the configured server.
+func (r *Redis) node(cfg *config.Config) (redisConn, error) {
+	conn, err := r.resolveConnection(cfg)
+	if err != nil {
+		return conn, err
+	}
+	switch {
+	case cfg.RedisNode != "":
+		conn.host, conn.port, err = net.SplitHostPort(cfg.RedisNode)
+	case cfg.RedisSentinelMaster != "":
+		conn.host, conn.port, err = r.sentinelLookup(cfg, conn)
+	}
+	return conn, err
+}
+
+// sentinelLookup asks the Sentinel at host:port for the address of the
+// REDIS_SENTINEL_MASTER master, or of a healthy replica of it with
+// REDIS_SENTINEL_ROLE=replica. The Sentinel is sent the same credentials
+// and TLS settings as the data nodes.
+func (r *Redis) sentinelLookup(cfg *config.Config, sentinel redisConn) (string, string, error) {
+	if sentinel.port == "" {
+		sentinel.port = "26379"
+	}
+	addr := net.JoinHostPort(sentinel.host, sentinel.port)
+	name := cfg.RedisSentinelMaster
+
+	if cfg.RedisSentinelRole == "replica" {
+		lines, err := r.query(cfg, sentinel, "SENTINEL", "replicas", name)
+		if err != nil {
+			return "", "", err
+		}
+		replicaHost, replicaPort, ok := healthyReplica(lines)
+		if !ok {
+			return "", "", fmt.Errorf("sentinel at %s reports no healthy replica of %q", addr, name)
+		}
+		return replicaHost, replicaPort, nil
+	}
+
+	lines, err := r.query(cfg, sentinel, "SENTINEL", "get-master-addr-by-name", name)
+	if err != nil {
+		return "", "", err
+	}
+	if len(lines) < 2 || lines[0] == "" {
+		return "", "", fmt.Errorf("sentinel at %s does not know master %q", addr, name)
+	}
+	return lines[0], lines[1], nil
+}
+
+// healthyReplica picks the first replica from SENTINEL REPLICAS output
+// (a flat list of field/value lines per replica) that is up and in sync
+// with its master.
+func healthyReplica(lines []string) (string, string, bool) {
+	var replicas []map[string]string
+	for i := 0; i+1 < len(lines); i += 2 {
+		if lines[i] == "name" {
+			replicas = append(replicas, map[string]string{})
+		}
+		if len(replicas) > 0 {
+			replicas[len(replicas)-1][lines[i]] = lines[i+1]
+		}
+	}
+	for _, replica := range replicas {
+		flags := strings.Split(replica["flags"], ",")
+		if slices.Contains(flags, "s_down") || slices.Contains(flags, "o_down") || slices.Contains(flags, "disconnected") {
+			continue
+		}
+		if status := replica["master-link-status"]; status != "" && status != "ok" {
+			continue
+		}
+		return replica["ip"], replica["port"], true
+	}
+	return "", "", false
+}
+
+// ListShards returns the master shards of the cluster DB_URI/DB_HOST
+// belongs to, from CLUSTER NODES. Each shard is named after its first
+// slot range, which stays with the shard when a replica takes over.
+func (r *Redis) ListShards(cfg *config.Config) ([]Shard, error) {
+	conn, err := r.resolveConnection(cfg)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := r.query(cfg, conn, "CLUSTER", "NODES")
+	if err != nil {
+		return nil, err
+	}
+
+	var shards []Shard
+	for _, line := range lines {
+		// <id> <ip:port@cport[,hostname]> <flags> <master> <ping-sent>
+		// <pong-recv> <config-epoch> <link-state> <slot>...
+		fields := strings.Fields(line)
+		if len(fields) < 8 || !slices.Contains(strings.Split(fields[2], ","), "master") {
+			continue
+		}
+		var slots string
+		for _, slot := range fields[8:] {
+			// Bracketed entries are slots being migrated or imported
+			if !strings.HasPrefix(slot, "[") {
+				slots = slot
+				break
+			}
+		}
+		if slots == "" {
+			// A master without slots holds no data
+			continue
+		}
+		if !strings.Contains(slots, "-") {
+			slots += "-" + slots
+		}
+		if slices.Contains(strings.Split(fields[2], ","), "fail") {
+			return nil, fmt.Errorf("the master of cluster slots %s is failing", slots)
+		}
+
+		addr, _, _ := strings.Cut(fields[1], "@")
+		i := strings.LastIndex(addr, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("unexpected address %q in CLUSTER NODES", fields[1])
+		}
+		shards = append(shards, Shard{Name: "slots-" + slots, Addr: net.JoinHostPort(addr[:i], addr[i+1:])})
+	}
+	if len(shards) == 0 {
+		return nil, fmt.Errorf("no master shards found in CLUSTER NODES")
+	}
+	slices.SortFunc(shards, func(a, b Shard) int { return firstSlot(a.Name) - firstSlot(b.Name) })
+	return shards, nil
+}
+
+// firstSlot returns the first slot of a shard name ("slots-<from>-<to>").
+func firstSlot(name string) int {
+	from, _, _ := strings.Cut(strings.TrimPrefix(name, "slots-"), "-")
+	n, _ := strconv.Atoi(from)
+	return n
+}
+
+// Ping checks that the server to back up answers PING. An error reply,
+// such as NOAUTH, still shows the server is up.
+func (r *Redis) Ping(ctx context.Context, cfg *config.Config) error {
+	conn, err := r.node(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = run(ctx, r.command(conn, append(r.connArgs(cfg, conn), "PING")))
+	return err
+}
+
+// ServerVersion returns the redis_version of the server to back up.
+func (r *Redis) ServerVersion(ctx context.Context, cfg *config.Config) (string, error) {
+	conn, err := r.node(cfg)
+	if err != nil {
+		return "", err
+	}
+	output, err := run(ctx, r.command(conn, append(r.connArgs(cfg, conn), "INFO", "server")))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if version, ok := strings.CutPrefix(strings.TrimSpace(line), "redis_version:"); ok {
+			return version, nil
+		}
+	}
+	return "", nil
+}
+
+// CheckVersion accepts any redis-cli: --rdb copies the snapshot as the
+// server writes it. The server version is still recorded, as an RDB only
+// loads into a server at least as new.
+func (r *Redis) CheckVersion(_ *config.Config, _ string) (string, error) {
+	return "", nil
+}
+
+// query runs a redis-cli command against conn and returns its output
+// lines. redis-cli exits zero on error replies, so those are detected by
+// their prefix.
+func (r *Redis) query(cfg *config.Config, conn redisConn, command ...string) ([]string, error) {
+	cmd := r.command(conn, append(r.connArgs(cfg, conn), command...))
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("redis-cli %s: %w (stderr: %s)", strings.Join(command, " "), err, stderr.String())
+	}
+	out := strings.TrimRight(string(output), "\n")
+	for _, prefix := range []string{"ERR", "NOAUTH", "WRONGPASS", "NOPERM", "(error)"} {
+		if strings.HasPrefix(out, prefix) {
+			return nil, fmt.Errorf("redis-cli %s: %s", strings.Join(command, " "), out)
+		}
+	}
+	if out == "" {
+		return nil, nil
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// command builds the redis-cli command. The password is passed in
+// REDISCLI_AUTH instead of -a, where any process on the host could read it.
+func (r *Redis) command(conn redisConn, args []string) *exec.Cmd {
 	cmd := exec.Command("redis-cli", args...)
+	if conn.password != "" {
+		cmd.Env = append(os.Environ(), "REDISCLI_AUTH="+conn.password)
+	}
+	return cmd
+}
+
+// redisConn is how redis-cli reaches one server.
+type redisConn struct {
+	host, port     string
+	user, password string
+	tls            bool
+}
+
+// connArgs returns the redis-cli flags that connect to conn: the ACL user
+// (Redis 6+) and the TLS settings. The password is passed by command. redis-cli has no
+// verify-ca equivalent, so both verify modes check the certificate chain.
+func (r *Redis) connArgs(cfg *config.Config, conn redisConn) []string {
+	var args []string
+	if conn.host != "" {
+		args = append(args, "-h", conn.host)
+	}
+	if conn.port != "" {
+		args = append(args, "-p", conn.port)
+	}
+	if conn.user != "" {
+		args = append(args, "--user", conn.user)
+	}
+	if conn.tls {
+		args = append(args, "--tls")
+		// redis-cli verifies the server certificate unless told not to
+		if cfg.DBTLSMode == "require" {
+			args = append(args, "--insecure")
+		}
+		if cfg.DBTLSCAFile != "" {
+			args = append(args, "--cacert", cfg.DBTLSCAFile)
+		}
+		if cfg.DBTLSCertFile != "" {
+			args = append(args, "--cert", cfg.DBTLSCertFile)
+		}
+		if cfg.DBTLSKeyFile != "" {
+			args = append(args, "--key", cfg.DBTLSKeyFile)
+		}
+	}
+	return args
+}
+
+// RestoreCommand stages an RDB read from stdin at opts.RDBPath. The file is
+// written next to the destination and renamed into place once complete, so
+// a failed download never clobbers an existing dump. Redis loads it on the
+// next server start.
+func (r *Redis) RestoreCommand(_ *config.Config, opts RestoreOptions) (*exec.Cmd, error) {
+	if opts.Mode != "stream" && opts.Mode != "file" {
+		return nil, fmt.Errorf("redis only supports stream/file mode (got %q)", opts.Mode)
+	}
+	if opts.RDBPath == "" {
+		return nil, fmt.Errorf("redis restore requires a destination RDB path (--rdb-path)")
+	}
+	if opts.TargetDB != "" || opts.Clean || opts.Jobs > 0 {
+		return nil, fmt.Errorf("redis restore replaces the whole RDB; target database, clean, and jobs options do not apply")
+	}
+
+	cmd := exec.Command("sh", "-c", `cat > "$1.dbstash-tmp" && mv -f "$1.dbstash-tmp" "$1"`, "sh", opts.RDBPath)
 	cmd.Stderr = os.Stderr
 	return cmd, nil
 }
 
-// resolveConnection parses redis://... URI or uses individual vars.
-func (r *Redis) resolveConnection(cfg *config.Config) (host, port, password string) {
+// resolveConnection parses a redis:// or rediss:// (TLS) URI or uses
+// individual vars. TLS is also used with any DB_TLS_MODE but disable, or a
+// TLS file. The /N database path is only checked: an RDB snapshot always
+// holds every database.
+func (r *Redis) resolveConnection(cfg *config.Config) (redisConn, error) {
+	conn := redisConn{tls: (cfg.DBTLSMode != "" && cfg.DBTLSMode != "disable") || cfg.HasTLSFiles()}
 	if cfg.DBURI != "" {
 		u, err := url.Parse(cfg.DBURI)
 		if err == nil {
-			host = u.Hostname()
-			port = u.Port()
-			password, _ = u.User.Password()
-			if password == "" && u.User != nil {
-				// redis://:password@host format
-				password = u.User.Username()
+			conn.host = u.Hostname()
+			conn.port = u.Port()
+			conn.tls = conn.tls || u.Scheme == "rediss"
+			conn.user = u.User.Username()
+			password, ok := u.User.Password()
+			if !ok {
+				// redis://password@host format
+				conn.user, password = "", conn.user
+			}
+			conn.password = password
+			if db := strings.Trim(u.Path, "/"); db != "" {
+				if _, err := strconv.Atoi(db); err != nil {
+					return conn, fmt.Errorf("redis URI path must be a database number (got %q)", db)
+				}
 			}
-			return
+			return conn, nil
 		}
 	}
-	return cfg.DBHost, cfg.DBPort, cfg.DBPassword
+	conn.host, conn.port = cfg.DBHost, cfg.DBPort
+	conn.user, conn.password = cfg.DBUser, cfg.DBPassword
+	return conn, nil
 }
 
 // DefaultExtension returns ".rdb".
-func (r *Redis) DefaultExtension(_ bool) string { return ".rdb" }
+func (r *Redis) DefaultExtension(_ *config.Config, _ string, _ bool) string { return ".rdb" }
 
 // SupportsCompression returns false — RDB is already compact.
 func (r *Redis) SupportsCompression() bool { return false }
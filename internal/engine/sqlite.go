@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/viperadnan-git/dbstash/internal/config"
+)
+
+// SQLite implements the Engine interface for SQLite database files using
+// the sqlite3 shell.
+type SQLite struct{}
+
+// Name returns "sqlite".
+func (s *SQLite) Name() string { return "sqlite" }
+
+// DumpCommand builds the sqlite3 command for the given mode. Stream mode
+// writes a .dump SQL script to stdout; file mode writes a binary copy to
+// outputFile with VACUUM INTO. Both read inside a single transaction, so
+// the snapshot is consistent while the database is in use.
+func (s *SQLite) DumpCommand(cfg *config.Config, mode string, outputFile string) (*exec.Cmd, error) {
+	// sqlite3 creates missing files; never back up an empty new database
+	if _, err := os.Stat(cfg.DBPath); err != nil {
+		return nil, fmt.Errorf("sqlite database: %w", err)
+	}
+
+	var args []string
+
+	// Extra args
+	if cfg.DumpExtraArgs != "" {
+		args = append(args, shellSplit(cfg.DumpExtraArgs)...)
+	}
+
+	args = append(args, cfg.DBPath)
+
+	switch mode {
+	case "stream":
+		args = append(args, ".dump")
+	case "file":
+		args = append(args, fmt.Sprintf("VACUUM INTO %s", quoteSQLiteString(outputFile)))
+	default:
+		return nil, fmt.Errorf("sqlite only supports stream/file mode (got %q)", mode)
+	}
+
+	cmd := exec.Command("sqlite3", args...)
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// RestoreCommand rebuilds the database file from stdin: a SQL script is
+// replayed into a fresh file, a binary copy is written as is. The result
+// is renamed over the target (DB_PATH, or opts.TargetDB as a path) only
+// once complete, and stale -wal/-shm files are removed with it. Stop
+// writers before restoring.
+func (s *SQLite) RestoreCommand(cfg *config.Config, opts RestoreOptions) (*exec.Cmd, error) {
+	if opts.Jobs > 1 {
+		return nil, fmt.Errorf("parallel restore is not supported for sqlite")
+	}
+
+	var load string
+	switch opts.Mode {
+	case "stream":
+		load = `sqlite3 -bail "$1.dbstash-tmp"`
+	case "file":
+		load = `cat > "$1.dbstash-tmp"`
+	default:
+		return nil, fmt.Errorf("sqlite only supports stream/file mode (got %q)", opts.Mode)
+	}
+
+	target := cfg.DBPath
+	if opts.TargetDB != "" {
+		target = opts.TargetDB
+	}
+
+	script := `rm -f "$1.dbstash-tmp" && ` + load + ` && rm -f "$1-wal" "$1-shm" && mv -f "$1.dbstash-tmp" "$1"`
+	cmd := exec.Command("sh", "-c", script, "sh", target)
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// ResetCommand returns nil: a restore replaces the database file.
+func (s *SQLite) ResetCommand(_ *config.Config, _ string) (*exec.Cmd, error) {
+	return nil, nil
+}
+
+// QueryCommand runs script against the database file at dbName, stopping
+// at the first error.
+func (s *SQLite) QueryCommand(_ *config.Config, dbName, script string) (*exec.Cmd, error) {
+	cmd := exec.Command("sqlite3", "-bail", dbName)
+	cmd.Stdin = strings.NewReader(script)
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// DefaultExtension returns ".sql" for stream mode and ".sqlite" for file
+// mode.
+func (s *SQLite) DefaultExtension(_ *config.Config, mode string, _ bool) string {
+	if mode == "file" {
+		return ".sqlite"
+	}
+	return ".sql"
+}
+
+// SupportsCompression returns false — sqlite3 has no native compression.
+func (s *SQLite) SupportsCompression() bool { return false }
+
+// ConflictingFlags returns nil — the mode is chosen by the command, not
+// by sqlite3 flags.
+func (s *SQLite) ConflictingFlags(_ string) []string { return nil }
+
+// quoteSQLiteString quotes s as an SQL string literal.
+func quoteSQLiteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
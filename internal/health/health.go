@@ -16,14 +16,20 @@ type Status struct {
 	Engine     string `json:"engine"`
 	LastBackup string `json:"last_backup"`
 	LastStatus string `json:"last_status"`
+
+	// Restore drill results, present once a drill has run
+	LastDrill       string `json:"last_drill,omitempty"`
+	LastDrillStatus string `json:"last_drill_status,omitempty"`
 }
 
 // Tracker tracks the last backup time and status in a thread-safe manner.
 type Tracker struct {
-	mu         sync.RWMutex
-	engine     string
-	lastBackup time.Time
-	lastStatus string
+	mu              sync.RWMutex
+	engine          string
+	lastBackup      time.Time
+	lastStatus      string
+	lastDrill       time.Time
+	lastDrillStatus string
 }
 
 // NewTracker creates a new health tracker for the given engine.
@@ -42,6 +48,14 @@ func (t *Tracker) Update(status string) {
 	t.lastStatus = status
 }
 
+// UpdateDrill records the result of a restore drill.
+func (t *Tracker) UpdateDrill(status string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastDrill = time.Now()
+	t.lastDrillStatus = status
+}
+
 // GetStatus returns the current health status.
 func (t *Tracker) GetStatus() Status {
 	t.mu.RLock()
@@ -52,11 +66,18 @@ func (t *Tracker) GetStatus() Status {
 		lastBackup = t.lastBackup.Format(time.RFC3339)
 	}
 
+	lastDrill := ""
+	if !t.lastDrill.IsZero() {
+		lastDrill = t.lastDrill.Format(time.RFC3339)
+	}
+
 	return Status{
-		Status:     "healthy",
-		Engine:     t.engine,
-		LastBackup: lastBackup,
-		LastStatus: t.lastStatus,
+		Status:          "healthy",
+		Engine:          t.engine,
+		LastBackup:      lastBackup,
+		LastStatus:      t.lastStatus,
+		LastDrill:       lastDrill,
+		LastDrillStatus: t.lastDrillStatus,
 	}
 }
 
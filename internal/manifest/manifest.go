@@ -0,0 +1,106 @@
+// Package manifest defines the JSON sidecar that dbstash uploads next to
+// every backup, recording how and when the backup was taken.
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Suffix is appended to a backup's remote path to form its manifest path.
+const Suffix = ".manifest.json"
+
+// Version is the dbstash version recorded in new manifests. It is set by
+// main from the build version.
+var Version = "dev"
+
+// Manifest describes a single backup.
+type Manifest struct {
+	BackupID        string    `json:"backup_id"`
+	Name            string    `json:"name"`
+	Engine          string    `json:"engine"`
+	Database        string    `json:"database"`
+	Mode            string    `json:"mode"`
+	Method          string    `json:"method,omitempty"`
+	Compressed      bool      `json:"compressed"`
+	Compression     string    `json:"compression,omitempty"`
+	Size            int64     `json:"size"`
+	SHA256          string    `json:"sha256,omitempty"`
+	MD5             string    `json:"md5,omitempty"`
+	Files           []File    `json:"files,omitempty"`
+	StartedAt       time.Time `json:"started_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	DumpCommand     string    `json:"dump_command"`
+	DumpToolVersion string    `json:"dump_tool_version"`
+	ServerVersion   string    `json:"server_version,omitempty"`
+	DBStashVersion  string    `json:"dbstash_version"`
+	Timezone        string    `json:"timezone"`
+	NameTemplate    string    `json:"name_template"`
+
+	// Metadata holds facts the dump tool reported about the backup, such
+	// as the WAL start and stop LSN of a physical pg backup or the binlog
+	// position of a mysqldump.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// File records the checksum of one file in a directory backup.
+type File struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	MD5    string `json:"md5"`
+}
+
+// Path returns the manifest path for a backup at remotePath. Directory
+// backups (trailing slash) get a sibling object, not one inside the directory.
+func Path(remotePath string) string {
+	return strings.TrimRight(remotePath, "/") + Suffix
+}
+
+// IsManifest reports whether name is a manifest sidecar.
+func IsManifest(name string) bool {
+	return strings.HasSuffix(name, Suffix)
+}
+
+// Upload writes m as the manifest of the backup at remotePath via rclone rcat.
+func Upload(ctx context.Context, remotePath string, m *Manifest, rcloneArgs []string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+
+	args := append([]string{"rcat", Path(remotePath)}, rcloneArgs...)
+	cmd := exec.CommandContext(ctx, "rclone", args...)
+	cmd.Stdin = bytes.NewReader(append(data, '\n'))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("rclone rcat %s: %w (stderr: %s)", Path(remotePath), err, stderr.String())
+	}
+	return nil
+}
+
+// Fetch reads the manifest of the backup at remotePath via rclone cat.
+func Fetch(ctx context.Context, remotePath string, rcloneArgs []string) (*Manifest, error) {
+	args := append([]string{"cat", Path(remotePath)}, rcloneArgs...)
+	cmd := exec.CommandContext(ctx, "rclone", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("rclone cat %s: %w (stderr: %s)", Path(remotePath), err, stderr.String())
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(stdout.Bytes(), &m); err != nil {
+		return nil, fmt.Errorf("parsing manifest %s: %w", Path(remotePath), err)
+	}
+	return &m, nil
+}
@@ -16,6 +16,7 @@ import (
 
 // Result contains the details of a backup run for notification purposes.
 type Result struct {
+	Operation  string        // "backup" (default), "verify", "drill", "wal", "binlog", or "oplog"
 	Status     string        // "success" or "failure"
 	Engine     string        // engine key (e.g. "pg")
 	Database   string        // database name
@@ -23,6 +24,7 @@ type Result struct {
 	FileSize   int64         // file size in bytes (0 if unknown)
 	Duration   time.Duration // backup duration
 	Error      string        // error message (empty on success)
+	Category   string        // failure category, e.g. "database_unreachable" (empty if none)
 }
 
 // Send dispatches a notification based on the configured webhook URL and
@@ -75,6 +77,13 @@ func Send(ctx context.Context, webhookURL, notifyOn string, result Result) {
 	logger.Log.Info().Str("platform", platform(webhookURL)).Msg("notification sent successfully")
 }
 
+func (r Result) operation() string {
+	if r.Operation == "" {
+		return "backup"
+	}
+	return r.Operation
+}
+
 func shouldNotify(notifyOn, status string) bool {
 	switch notifyOn {
 	case "always":
@@ -152,12 +161,15 @@ func buildSlackPayload(result Result) ([]byte, error) {
 		{"title": "Remote Path", "value": result.RemotePath, "short": false},
 	}
 
+	if result.Category != "" {
+		fields = append(fields, map[string]interface{}{"title": "Category", "value": result.Category, "short": true})
+	}
 	if result.Error != "" {
 		fields = append(fields, map[string]interface{}{"title": "Error", "value": result.Error, "short": false})
 	}
 
 	payload := map[string]interface{}{
-		"text": fmt.Sprintf("dbstash backup %s: %s/%s", result.Status, result.Engine, result.Database),
+		"text": fmt.Sprintf("dbstash %s %s: %s/%s", result.operation(), result.Status, result.Engine, result.Database),
 		"attachments": []map[string]interface{}{
 			{
 				"color":  statusColor(result.Status),
@@ -185,6 +197,9 @@ func buildDiscordPayload(result Result) ([]byte, error) {
 		{"name": "Remote Path", "value": result.RemotePath, "inline": false},
 	}
 
+	if result.Category != "" {
+		fields = append(fields, map[string]interface{}{"name": "Category", "value": result.Category, "inline": true})
+	}
 	if result.Error != "" {
 		fields = append(fields, map[string]interface{}{"name": "Error", "value": result.Error, "inline": false})
 	}
@@ -192,7 +207,7 @@ func buildDiscordPayload(result Result) ([]byte, error) {
 	payload := map[string]interface{}{
 		"embeds": []map[string]interface{}{
 			{
-				"title":     fmt.Sprintf("dbstash backup %s", result.Status),
+				"title":     fmt.Sprintf("dbstash %s %s", result.operation(), result.Status),
 				"color":     statusColorInt(result.Status),
 				"fields":    fields,
 				"timestamp": time.Now().UTC().Format(time.RFC3339),
@@ -116,6 +116,7 @@ func TestBuildSlackPayload_Failure(t *testing.T) {
 		Engine:   "mongo",
 		Database: "analytics",
 		Error:    "connection refused",
+		Category: "database_unreachable",
 		Duration: 5 * time.Second,
 	}
 
@@ -137,7 +138,7 @@ func TestBuildSlackPayload_Failure(t *testing.T) {
 
 	// Should have error field
 	fields := att["fields"].([]any)
-	hasError := false
+	hasError, hasCategory := false, false
 	for _, f := range fields {
 		field := f.(map[string]any)
 		if field["title"] == "Error" {
@@ -146,10 +147,19 @@ func TestBuildSlackPayload_Failure(t *testing.T) {
 				t.Errorf("expected error message, got %q", field["value"])
 			}
 		}
+		if field["title"] == "Category" {
+			hasCategory = true
+			if field["value"] != "database_unreachable" {
+				t.Errorf("expected category, got %q", field["value"])
+			}
+		}
 	}
 	if !hasError {
 		t.Error("expected error field in failure payload")
 	}
+	if !hasCategory {
+		t.Error("expected category field in failure payload")
+	}
 }
 
 func TestBuildDiscordPayload(t *testing.T) {
@@ -0,0 +1,109 @@
+package oplog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// documents splits a .bson file, a plain concatenation of documents, into
+// its documents.
+func documents(data []byte) ([][]byte, error) {
+	var docs [][]byte
+	for len(data) > 0 {
+		if len(data) < 5 {
+			return nil, fmt.Errorf("truncated BSON document")
+		}
+		n := int(binary.LittleEndian.Uint32(data))
+		if n < 5 || n > len(data) {
+			return nil, fmt.Errorf("invalid BSON document length %d", n)
+		}
+		docs = append(docs, data[:n])
+		data = data[n:]
+	}
+	return docs, nil
+}
+
+// timestampOf returns the top-level "ts" field of an oplog entry.
+func timestampOf(doc []byte) (Timestamp, error) {
+	pos := 4
+	for pos < len(doc)-1 {
+		typ := doc[pos]
+		pos++
+		end := bytes.IndexByte(doc[pos:], 0)
+		if end < 0 {
+			return Timestamp{}, fmt.Errorf("invalid BSON element name")
+		}
+		name := string(doc[pos : pos+end])
+		pos += end + 1
+
+		if name == "ts" && typ == 0x11 {
+			if pos+8 > len(doc) {
+				return Timestamp{}, fmt.Errorf("truncated BSON timestamp")
+			}
+			return Timestamp{
+				I: binary.LittleEndian.Uint32(doc[pos:]),
+				T: binary.LittleEndian.Uint32(doc[pos+4:]),
+			}, nil
+		}
+
+		size, err := valueSize(typ, doc[pos:])
+		if err != nil {
+			return Timestamp{}, err
+		}
+		if size < 0 || pos+size > len(doc) {
+			return Timestamp{}, fmt.Errorf("invalid BSON value size %d", size)
+		}
+		pos += size
+	}
+	return Timestamp{}, fmt.Errorf("oplog entry has no ts field")
+}
+
+// valueSize returns the encoded size of a BSON value of type typ at the
+// start of data.
+func valueSize(typ byte, data []byte) (int, error) {
+	int32At := func(off int) (int, error) {
+		if len(data) < off+4 {
+			return 0, fmt.Errorf("truncated BSON value")
+		}
+		return int(int32(binary.LittleEndian.Uint32(data[off:]))), nil
+	}
+
+	switch typ {
+	case 0x06, 0x0A, 0x7F, 0xFF: // undefined, null, max key, min key
+		return 0, nil
+	case 0x08: // boolean
+		return 1, nil
+	case 0x01, 0x09, 0x11, 0x12: // double, datetime, timestamp, int64
+		return 8, nil
+	case 0x10: // int32
+		return 4, nil
+	case 0x07: // ObjectId
+		return 12, nil
+	case 0x13: // decimal128
+		return 16, nil
+	case 0x02, 0x0D, 0x0E: // string, JavaScript, symbol
+		n, err := int32At(0)
+		return 4 + n, err
+	case 0x03, 0x04, 0x0F: // document, array, code with scope
+		return int32At(0)
+	case 0x05: // binary
+		n, err := int32At(0)
+		return 5 + n, err
+	case 0x0C: // DBPointer
+		n, err := int32At(0)
+		return 4 + n + 12, err
+	case 0x0B: // regex: two C strings
+		first := bytes.IndexByte(data, 0)
+		if first < 0 {
+			return 0, fmt.Errorf("truncated BSON regex")
+		}
+		second := bytes.IndexByte(data[first+1:], 0)
+		if second < 0 {
+			return 0, fmt.Errorf("truncated BSON regex")
+		}
+		return first + second + 2, nil
+	default:
+		return 0, fmt.Errorf("unknown BSON type 0x%02x", typ)
+	}
+}
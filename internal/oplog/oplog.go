@@ -0,0 +1,177 @@
+// Package oplog archives slices of the MongoDB oplog under the oplog/
+// prefix of RCLONE_REMOTE and replays them on top of a restored dump for
+// point-in-time recovery. Slices are cut by a long-running receiver
+// (Receive) that periodically dumps the entries written since the last
+// slice; dumps taken with BACKUP_OPLOG=true record where replay starts.
+package oplog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/viperadnan-git/dbstash/internal/archive"
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/engine"
+	"github.com/viperadnan-git/dbstash/internal/retention"
+)
+
+// RemoteDir returns the rclone path oplog slices are archived to.
+func RemoteDir(cfg *config.Config) string {
+	return archive.RemoteDir(cfg, retention.OplogDir)
+}
+
+// Timestamp is a BSON timestamp, the position of an oplog entry: seconds
+// since the epoch and an increment within that second.
+type Timestamp struct {
+	T uint32
+	I uint32
+}
+
+// String formats ts as "<seconds>:<increment>", the form mongorestore
+// --oplogLimit takes.
+func (ts Timestamp) String() string {
+	return fmt.Sprintf("%d:%d", ts.T, ts.I)
+}
+
+// Less reports whether ts comes before other.
+func (ts Timestamp) Less(other Timestamp) bool {
+	return ts.T < other.T || (ts.T == other.T && ts.I < other.I)
+}
+
+// before returns the timestamp immediately preceding ts.
+func (ts Timestamp) before() Timestamp {
+	if ts.I > 0 {
+		return Timestamp{T: ts.T, I: ts.I - 1}
+	}
+	return Timestamp{T: ts.T - 1, I: ^uint32(0)}
+}
+
+// key formats ts with fixed widths so slice names sort by position.
+func (ts Timestamp) key() string {
+	return fmt.Sprintf("%010d-%010d", ts.T, ts.I)
+}
+
+// query returns the mongodump --query selecting entries at or after ts.
+func (ts Timestamp) query() string {
+	return fmt.Sprintf(`{"ts":{"$gte":{"$timestamp":{"t":%d,"i":%d}}}}`, ts.T, ts.I)
+}
+
+// ParseTimestamp parses "<seconds>:<increment>".
+func ParseTimestamp(s string) (Timestamp, error) {
+	t, i, ok := strings.Cut(s, ":")
+	if !ok {
+		return Timestamp{}, fmt.Errorf("invalid oplog timestamp %q", s)
+	}
+	secs, err := strconv.ParseUint(t, 10, 32)
+	if err != nil {
+		return Timestamp{}, fmt.Errorf("invalid oplog timestamp %q", s)
+	}
+	inc, err := strconv.ParseUint(i, 10, 32)
+	if err != nil {
+		return Timestamp{}, fmt.Errorf("invalid oplog timestamp %q", s)
+	}
+	return Timestamp{T: uint32(secs), I: uint32(inc)}, nil
+}
+
+// Slice is an archived run of oplog entries: every entry after From up to
+// and including To. A slice whose From is the To of the previous one
+// continues it without a gap.
+type Slice struct {
+	Name string
+	From Timestamp
+	To   Timestamp
+}
+
+// sliceName returns the archive name of the slice (from, to].
+func sliceName(from, to Timestamp) string {
+	return from.key() + "_" + to.key() + ".bson"
+}
+
+// ParseSlice parses an archived slice name. ok is false for anything else.
+func ParseSlice(name string) (Slice, bool) {
+	base, ok := strings.CutSuffix(name, ".bson")
+	if !ok {
+		return Slice{}, false
+	}
+	from, to, ok := strings.Cut(base, "_")
+	if !ok {
+		return Slice{}, false
+	}
+	fromTS, ok1 := parseKey(from)
+	toTS, ok2 := parseKey(to)
+	if !ok1 || !ok2 {
+		return Slice{}, false
+	}
+	return Slice{Name: name, From: fromTS, To: toTS}, true
+}
+
+// listSlices returns the archived slices, oldest first.
+func listSlices(ctx context.Context, cfg *config.Config) ([]Slice, error) {
+	entries, err := archive.List(ctx, cfg, retention.OplogDir)
+	if err != nil {
+		return nil, err
+	}
+	var slices []Slice
+	for _, entry := range entries {
+		if s, ok := ParseSlice(entry.Name); ok {
+			slices = append(slices, s)
+		}
+	}
+	sort.Slice(slices, func(i, j int) bool { return slices[i].From.Less(slices[j].From) })
+	return slices, nil
+}
+
+// parseKey parses a timestamp formatted by key.
+func parseKey(s string) (Timestamp, bool) {
+	ts, err := ParseTimestamp(strings.Replace(s, "-", ":", 1))
+	return ts, err == nil
+}
+
+// Latest returns the timestamp of the newest entry in the oplog.
+func Latest(ctx context.Context, cfg *config.Config, eng engine.Engine) (Timestamp, error) {
+	mongo, err := mongoEngine(eng)
+	if err != nil {
+		return Timestamp{}, err
+	}
+	cmd, err := mongo.LatestOplogCommand(cfg)
+	if err != nil {
+		return Timestamp{}, err
+	}
+	defer engine.Cleanup(cmd)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return Timestamp{}, fmt.Errorf("reading the newest oplog entry: %w (stderr: %s)", err, stderr.String())
+	}
+
+	var doc struct {
+		TS struct {
+			Timestamp struct {
+				T uint32 `json:"t"`
+				I uint32 `json:"i"`
+			} `json:"$timestamp"`
+		} `json:"ts"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(stdout.Bytes()), &doc); err != nil {
+		return Timestamp{}, fmt.Errorf("parsing the newest oplog entry %q: %w", stdout.String(), err)
+	}
+	if doc.TS.Timestamp.T == 0 {
+		return Timestamp{}, fmt.Errorf("the oplog is empty; is the server a replica set member?")
+	}
+	return Timestamp{T: doc.TS.Timestamp.T, I: doc.TS.Timestamp.I}, nil
+}
+
+// mongoEngine returns eng as the MongoDB engine.
+func mongoEngine(eng engine.Engine) (*engine.Mongo, error) {
+	m, ok := eng.(*engine.Mongo)
+	if !ok {
+		return nil, fmt.Errorf("oplog archiving is only supported for mongo (got %s)", eng.Name())
+	}
+	return m, nil
+}
@@ -0,0 +1,137 @@
+package oplog
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+// entry builds a minimal oplog entry with ts after a few other fields.
+func entry(ts Timestamp) []byte {
+	var body []byte
+	cstring := func(s string) []byte { return append([]byte(s), 0) }
+	le32 := func(n uint32) []byte { return binary.LittleEndian.AppendUint32(nil, n) }
+
+	// op: "i"
+	body = append(body, 0x02)
+	body = append(body, cstring("op")...)
+	body = append(body, le32(2)...)
+	body = append(body, cstring("i")...)
+	// o: {x: 1}
+	inner := append([]byte{0x10}, cstring("x")...)
+	inner = append(inner, le32(1)...)
+	body = append(body, 0x03)
+	body = append(body, cstring("o")...)
+	body = append(body, le32(uint32(len(inner)+5))...)
+	body = append(body, inner...)
+	body = append(body, 0)
+	// ts
+	body = append(body, 0x11)
+	body = append(body, cstring("ts")...)
+	body = append(body, le32(ts.I)...)
+	body = append(body, le32(ts.T)...)
+
+	doc := le32(uint32(len(body) + 5))
+	doc = append(doc, body...)
+	return append(doc, 0)
+}
+
+func TestTimestampOf(t *testing.T) {
+	want := []Timestamp{{T: 1770000000, I: 1}, {T: 1770000000, I: 2}, {T: 1770000060, I: 1}}
+	var data []byte
+	for _, ts := range want {
+		data = append(data, entry(ts)...)
+	}
+
+	docs, err := documents(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(docs) != len(want) {
+		t.Fatalf("expected %d documents, got %d", len(want), len(docs))
+	}
+	for i, doc := range docs {
+		got, err := timestampOf(doc)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != want[i] {
+			t.Errorf("document %d: expected ts %s, got %s", i, want[i], got)
+		}
+	}
+
+	if _, err := documents(data[:len(data)-3]); err == nil {
+		t.Error("expected error for truncated data")
+	}
+}
+
+func TestParseSlice(t *testing.T) {
+	from := Timestamp{T: 1770000000, I: 4294967295}
+	to := Timestamp{T: 1770000060, I: 3}
+	s, ok := ParseSlice(sliceName(from, to))
+	if !ok || s.From != from || s.To != to {
+		t.Errorf("ParseSlice(%s) = %+v, %v", sliceName(from, to), s, ok)
+	}
+
+	for _, name := range []string{"oplog.bson", "1_2.json", "x_y.bson"} {
+		if _, ok := ParseSlice(name); ok {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+}
+
+func TestSelectReplay(t *testing.T) {
+	ts := func(t uint32) Timestamp { return Timestamp{T: t, I: 1} }
+	slice := func(from, to uint32) Slice {
+		return Slice{Name: sliceName(ts(from), ts(to)), From: ts(from), To: ts(to)}
+	}
+	slices := []Slice{slice(100, 200), slice(200, 300), slice(300, 400)}
+
+	names := func(chain []Slice) string {
+		var out []string
+		for _, s := range chain {
+			out = append(out, s.Name)
+		}
+		return strings.Join(out, ",")
+	}
+
+	got, err := SelectReplay(slices, ts(250), time.Time{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := names(slices[1:]); names(got) != want {
+		t.Errorf("expected %s, got %s", want, names(got))
+	}
+
+	// Slices starting at or after until are not needed
+	got, err = SelectReplay(slices, ts(150), time.Unix(300, 0))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := names(slices[:2]); names(got) != want {
+		t.Errorf("expected %s, got %s", want, names(got))
+	}
+
+	if _, err := SelectReplay(slices, ts(50), time.Time{}); err == nil {
+		t.Error("expected error when the oplog starts after the dump")
+	}
+	gapped := []Slice{slice(100, 200), slice(210, 300)}
+	if _, err := SelectReplay(gapped, ts(150), time.Time{}); err == nil || !strings.Contains(err.Error(), "gap") {
+		t.Errorf("expected gap error, got %v", err)
+	}
+	if _, err := SelectReplay(slices, ts(400), time.Time{}); err == nil {
+		t.Error("expected error when nothing follows the dump")
+	}
+}
+
+func TestSelectPrunable(t *testing.T) {
+	slices := []Slice{
+		{From: Timestamp{T: 100}, To: Timestamp{T: 200}},
+		{From: Timestamp{T: 200}, To: Timestamp{T: 300}},
+		{From: Timestamp{T: 300}, To: Timestamp{T: 400}},
+	}
+	if got := SelectPrunable(slices, Timestamp{T: 300}); len(got) != 1 || got[0].To.T != 200 {
+		t.Errorf("expected only the first slice, got %+v", got)
+	}
+}
@@ -0,0 +1,77 @@
+package oplog
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/viperadnan-git/dbstash/internal/archive"
+	"github.com/viperadnan-git/dbstash/internal/catalog"
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/engine"
+	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/manifest"
+	"github.com/viperadnan-git/dbstash/internal/pipeline"
+	"github.com/viperadnan-git/dbstash/internal/restore"
+	"github.com/viperadnan-git/dbstash/internal/retention"
+)
+
+// Prune deletes the archived oplog slices that no retained dump needs:
+// every slice that ends before the oplog position of the oldest dump that
+// records one. It does nothing unless retention is configured, and
+// deletes nothing if a dump's manifest cannot be read. It returns the
+// number of slices deleted.
+func Prune(ctx context.Context, cfg *config.Config, eng engine.Engine) (int, error) {
+	if cfg.RetentionMaxFiles <= 0 && cfg.RetentionMaxDays <= 0 {
+		return 0, nil
+	}
+
+	slices, err := listSlices(ctx, cfg)
+	if err != nil || len(slices) == 0 {
+		return 0, err
+	}
+
+	oldest, cutoff, err := oldestDump(ctx, cfg, eng)
+	if err != nil || oldest == nil {
+		return 0, err
+	}
+	logger.Log.Debug().Str("backup", oldest.Name).Str("cutoff", cutoff.String()).Msg("pruning oplog before oldest dump")
+
+	var entries []retention.RemoteEntry
+	for _, s := range SelectPrunable(slices, cutoff) {
+		entries = append(entries, retention.RemoteEntry{Path: s.Name, Name: s.Name})
+	}
+	return archive.Delete(ctx, cfg, retention.OplogDir, entries), nil
+}
+
+// SelectPrunable returns the slices that end before cutoff.
+func SelectPrunable(slices []Slice, cutoff Timestamp) []Slice {
+	var result []Slice
+	for _, s := range slices {
+		if s.To.Less(cutoff) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// oldestDump returns the manifest and oplog position of the oldest dump on
+// the remote that records one, or nil if there is none. A backup whose
+// manifest cannot be read stops the search with an error, since its
+// oplog may still be needed.
+func oldestDump(ctx context.Context, cfg *config.Config, eng engine.Engine) (*manifest.Manifest, Timestamp, error) {
+	entries, err := catalog.List(ctx, cfg, eng)
+	if err != nil {
+		return nil, Timestamp{}, err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		remotePath := restore.RemotePath(cfg, entries[i].Name)
+		m, err := manifest.Fetch(ctx, remotePath, pipeline.RcloneConfigArgs(cfg))
+		if err != nil {
+			return nil, Timestamp{}, fmt.Errorf("reading manifest of %s, keeping all oplog slices: %w", entries[i].Name, err)
+		}
+		if start, err := ParseTimestamp(m.Metadata["oplog_start"]); err == nil {
+			return m, start, nil
+		}
+	}
+	return nil, Timestamp{}, nil
+}
@@ -0,0 +1,180 @@
+package oplog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/viperadnan-git/dbstash/internal/archive"
+	"github.com/viperadnan-git/dbstash/internal/catalog"
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/engine"
+	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/manifest"
+	"github.com/viperadnan-git/dbstash/internal/notify"
+	"github.com/viperadnan-git/dbstash/internal/pipeline"
+	"github.com/viperadnan-git/dbstash/internal/restore"
+	"github.com/viperadnan-git/dbstash/internal/retention"
+)
+
+// ReceiveOptions controls an oplog receiver.
+type ReceiveOptions struct {
+	// Interval is how often a slice is cut. It bounds how much history
+	// can be lost.
+	Interval time.Duration
+}
+
+// Receive cuts an oplog slice every interval until ctx is cancelled and
+// archives it. Each slice holds the entries written since the previous
+// one; the first starts at the end of the newest archived slice, then at
+// the oplog position of the newest dump, then at the newest entry. A
+// failed slice is sent as a notification per NOTIFY_ON and retried on the
+// next tick.
+func Receive(ctx context.Context, cfg *config.Config, eng engine.Engine, opts ReceiveOptions) error {
+	mongo, err := mongoEngine(eng)
+	if err != nil {
+		return err
+	}
+	last, err := startPosition(ctx, cfg, eng)
+	if err != nil {
+		return err
+	}
+
+	log := logger.Log.With().Str("remote", RemoteDir(cfg)).Logger()
+	log.Info().Str("from", last.String()).Dur("interval", opts.Interval).Msg("oplog receiver started")
+	r := &receiver{cfg: cfg, mongo: mongo, last: last}
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		started := time.Now()
+		if err := r.cut(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Error().Err(err).Msg("oplog slice failed")
+			notify.Send(ctx, cfg.NotifyWebhookURL, cfg.NotifyOn, notify.Result{
+				Operation:  "oplog",
+				Status:     "failure",
+				Engine:     eng.Name(),
+				Database:   cfg.DBNameOrDefault(),
+				RemotePath: RemoteDir(cfg),
+				Duration:   time.Since(started),
+				Error:      err.Error(),
+			})
+		}
+	}
+}
+
+// startPosition returns the oplog position the first slice starts after.
+func startPosition(ctx context.Context, cfg *config.Config, eng engine.Engine) (Timestamp, error) {
+	slices, err := listSlices(ctx, cfg)
+	if err != nil {
+		return Timestamp{}, err
+	}
+	if len(slices) > 0 {
+		return slices[len(slices)-1].To, nil
+	}
+
+	backups, err := catalog.List(ctx, cfg, eng)
+	if err != nil {
+		return Timestamp{}, err
+	}
+	for _, entry := range backups {
+		m, err := manifest.Fetch(ctx, restore.RemotePath(cfg, entry.Name), pipeline.RcloneConfigArgs(cfg))
+		if err != nil {
+			continue
+		}
+		if start, err := ParseTimestamp(m.Metadata["oplog_start"]); err == nil {
+			return start, nil
+		}
+	}
+	return Latest(ctx, cfg, eng)
+}
+
+// receiver cuts consecutive oplog slices.
+type receiver struct {
+	cfg   *config.Config
+	mongo *engine.Mongo
+
+	// last is the newest archived entry.
+	last Timestamp
+}
+
+// cut dumps the entries from r.last on and archives those after it as a
+// slice. The dump includes r.last itself so a gap shows: if that entry is
+// gone, the oplog has rolled over and entries were lost. The slice is
+// still archived, starting after a gap that replay refuses to cross.
+func (r *receiver) cut(ctx context.Context) error {
+	os.MkdirAll(r.cfg.BackupTempDir, 0o755)
+	dir, err := os.MkdirTemp(r.cfg.BackupTempDir, "dbstash-oplog-")
+	if err != nil {
+		return fmt.Errorf("creating temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cmd, err := r.mongo.OplogDumpCommand(r.cfg, r.last.query(), dir)
+	if err != nil {
+		return err
+	}
+	defer engine.Cleanup(cmd)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("dumping oplog: %w (stderr: %s)", err, stderr.String())
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "local", "oplog.rs.bson"))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("reading oplog dump: %w", err)
+	}
+	docs, err := documents(data)
+	if err != nil {
+		return fmt.Errorf("reading oplog dump: %w", err)
+	}
+	if len(docs) == 0 {
+		return fmt.Errorf("oplog entry %s is gone and nothing newer was found", r.last)
+	}
+
+	from := r.last
+	var gap error
+	first, err := timestampOf(docs[0])
+	if err != nil {
+		return err
+	}
+	if first == r.last {
+		data = data[len(docs[0]):]
+		docs = docs[1:]
+	} else {
+		from = first.before()
+		gap = fmt.Errorf("the oplog rolled over: entries between %s and %s were lost and cannot be replayed", r.last, first)
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+
+	to, err := timestampOf(docs[len(docs)-1])
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, sliceName(from, to))
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("writing oplog slice: %w", err)
+	}
+	if err := archive.Push(ctx, r.cfg, retention.OplogDir, path); err != nil {
+		return err
+	}
+	logger.Log.Info().Str("slice", filepath.Base(path)).Int("entries", len(docs)).Msg("archived oplog slice")
+
+	r.last = to
+	return gap
+}
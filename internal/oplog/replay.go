@@ -0,0 +1,166 @@
+package oplog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/viperadnan-git/dbstash/internal/archive"
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/engine"
+	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/manifest"
+	"github.com/viperadnan-git/dbstash/internal/pipeline"
+	"github.com/viperadnan-git/dbstash/internal/restore"
+	"github.com/viperadnan-git/dbstash/internal/retention"
+)
+
+// Plan is a checked oplog replay: the slices that follow a dump, from the
+// oplog position recorded in its manifest.
+type Plan struct {
+	// From is the dump the oplog is replayed on top of.
+	From string
+
+	// Start is the oplog position recorded for the dump.
+	Start Timestamp
+
+	// Slices are the archived slices to replay, in order.
+	Slices []string
+
+	// Limit is the mongorestore --oplogLimit; empty replays every
+	// archived entry.
+	Limit string
+}
+
+// NewPlan checks that the dump from can be rolled forward to until with
+// the archived oplog and returns what to replay. Run it before restoring
+// the dump so a replay that cannot work fails early.
+func NewPlan(ctx context.Context, cfg *config.Config, from string, until time.Time) (*Plan, error) {
+	m, err := manifest.Fetch(ctx, restore.RemotePath(cfg, from), pipeline.RcloneConfigArgs(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest of %s: %w", from, err)
+	}
+	start, err := ParseTimestamp(m.Metadata["oplog_start"])
+	if err != nil {
+		return nil, fmt.Errorf("%s has no oplog position; take dumps with BACKUP_OPLOG=true", from)
+	}
+	if !until.IsZero() && until.Before(m.StartedAt) {
+		return nil, fmt.Errorf("%s was taken at %s, after %s", from, m.StartedAt.Format(time.RFC3339), until.Format(time.RFC3339))
+	}
+
+	slices, err := listSlices(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := selectReplay(slices, start, until)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{From: from, Start: start}
+	for _, s := range chain {
+		plan.Slices = append(plan.Slices, s.Name)
+	}
+	if !until.IsZero() {
+		// Entries at or after until are not replayed
+		plan.Limit = Timestamp{T: uint32(until.Unix())}.String()
+	}
+	return plan, nil
+}
+
+// SelectReplay returns the slices that cover the oplog from start to
+// until, in order. Exported for testing.
+func SelectReplay(slices []Slice, start Timestamp, until time.Time) ([]Slice, error) {
+	return selectReplay(slices, start, until)
+}
+
+// selectReplay picks the slices after start and checks they form a chain,
+// since replay cannot skip over a gap. slices must be sorted.
+func selectReplay(slices []Slice, start Timestamp, until time.Time) ([]Slice, error) {
+	var chain []Slice
+	for _, s := range slices {
+		if !start.Less(s.To) {
+			continue
+		}
+		// Every entry of this slice is at or after until
+		if !until.IsZero() && int64(s.From.T) >= until.Unix() {
+			break
+		}
+		if len(chain) == 0 && start.Less(s.From) {
+			return nil, fmt.Errorf("the oplog is not archived from %s; the first slice starts after %s", start, s.From)
+		}
+		if len(chain) > 0 && s.From != chain[len(chain)-1].To {
+			return nil, fmt.Errorf("oplog archive has a gap between %s and %s", chain[len(chain)-1].To, s.From)
+		}
+		chain = append(chain, s)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no oplog archived after %s", start)
+	}
+	return chain, nil
+}
+
+// Replay applies the slices of plan to the restored dump with mongorestore
+// --oplogReplay.
+func Replay(ctx context.Context, cfg *config.Config, eng engine.Engine, plan *Plan) error {
+	os.MkdirAll(cfg.BackupTempDir, 0o755)
+	dir, err := os.MkdirTemp(cfg.BackupTempDir, "dbstash-oplog-")
+	if err != nil {
+		return fmt.Errorf("creating temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// mongorestore replays the oplog.bson at the top of the dump directory;
+	// the slices are concatenated into one
+	replayDir := filepath.Join(dir, "replay")
+	if err := os.Mkdir(replayDir, 0o700); err != nil {
+		return fmt.Errorf("creating replay dir: %w", err)
+	}
+	out, err := os.Create(filepath.Join(replayDir, "oplog.bson"))
+	if err != nil {
+		return fmt.Errorf("creating oplog file: %w", err)
+	}
+	defer out.Close()
+	for _, name := range plan.Slices {
+		path := filepath.Join(dir, name)
+		if err := archive.Fetch(ctx, cfg, retention.OplogDir, name, path); err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading oplog slice: %w", err)
+		}
+		if _, err := out.Write(data); err != nil {
+			return fmt.Errorf("writing oplog file: %w", err)
+		}
+		os.Remove(path)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("writing oplog file: %w", err)
+	}
+
+	// The oplog spans the whole deployment
+	all := *cfg
+	all.BackupAllDatabases = true
+	cmd, err := eng.RestoreCommand(&all, engine.RestoreOptions{
+		Mode:        "directory",
+		Dir:         replayDir,
+		OplogReplay: true,
+		OplogLimit:  plan.Limit,
+	})
+	if err != nil {
+		return err
+	}
+	defer engine.Cleanup(cmd)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	logger.Log.Debug().Str("restore_cmd", config.MaskCmdArgs(cmd.Args)).Msg("replaying oplog")
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("oplog replay failed: %w (stderr: %s)", err, stderr.String())
+	}
+	return nil
+}
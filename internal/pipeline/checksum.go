@@ -0,0 +1,162 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/manifest"
+)
+
+// hashWriter computes SHA-256 and MD5 digests of the bytes written to it.
+// SHA-256 is the integrity record; MD5 is kept because it is the hash most
+// rclone backends can report for comparison.
+type hashWriter struct {
+	sha256 hash.Hash
+	md5    hash.Hash
+}
+
+func newHashWriter() *hashWriter {
+	return &hashWriter{sha256: sha256.New(), md5: md5.New()}
+}
+
+func (w *hashWriter) Write(p []byte) (int, error) {
+	w.sha256.Write(p)
+	w.md5.Write(p)
+	return len(p), nil
+}
+
+// digests returns the hex SHA-256 and MD5 of everything written so far.
+func (w *hashWriter) digests() (string, string) {
+	return hex.EncodeToString(w.sha256.Sum(nil)), hex.EncodeToString(w.md5.Sum(nil))
+}
+
+// hashFile returns the hex SHA-256 and MD5 of the file at path.
+func hashFile(path string) (string, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	hw := newHashWriter()
+	if _, err := io.Copy(hw, f); err != nil {
+		return "", "", err
+	}
+	sha, md := hw.digests()
+	return sha, md, nil
+}
+
+// hashDir returns checksums for every regular file under dir, with paths
+// relative to dir using forward slashes.
+func hashDir(dir string) ([]manifest.File, error) {
+	var files []manifest.File
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		sha, md, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, manifest.File{
+			Path:   filepath.ToSlash(rel),
+			Size:   info.Size(),
+			SHA256: sha,
+			MD5:    md,
+		})
+		return nil
+	})
+	return files, err
+}
+
+// verifyRemoteHashes compares the local digests of the uploaded files with
+// the hashes reported by the remote. SHA-256 is preferred, then MD5; if the
+// backend supports neither, the check is skipped. For a single file,
+// files holds one entry keyed by its base name.
+func verifyRemoteHashes(ctx context.Context, cfg *config.Config, remotePath string, files []manifest.File) error {
+	for _, hashType := range []string{"sha256", "md5"} {
+		remote, ok := remoteHashes(ctx, cfg, hashType, remotePath)
+		if !ok {
+			continue
+		}
+		if err := compareHashes(hashType, files, remote); err != nil {
+			return err
+		}
+		logger.Log.Debug().Str("hash", hashType).Str("remote_path", remotePath).Msg("remote checksum verified")
+		return nil
+	}
+
+	logger.Log.Debug().Str("remote_path", remotePath).Msg("remote does not report SHA-256 or MD5; skipping checksum comparison")
+	return nil
+}
+
+// compareHashes checks the hashType digests of files against those the
+// remote reported. A file the remote did not list was not uploaded.
+func compareHashes(hashType string, files []manifest.File, remote map[string]string) error {
+	for _, f := range files {
+		want := f.SHA256
+		if hashType == "md5" {
+			want = f.MD5
+		}
+		got, found := remote[f.Path]
+		if !found {
+			return fmt.Errorf("%s missing from remote", f.Path)
+		}
+		if got != want {
+			return fmt.Errorf("%s mismatch for %s: local %s, remote %s", hashType, f.Path, want, got)
+		}
+	}
+	return nil
+}
+
+// remoteHashes runs rclone hashsum and returns hashes keyed by path. ok is
+// false if the backend does not support the hash type.
+func remoteHashes(ctx context.Context, cfg *config.Config, hashType, remotePath string) (map[string]string, bool) {
+	args := []string{"hashsum", hashType, remotePath}
+	args = append(args, RcloneConfigArgs(cfg)...)
+	cmd := exec.CommandContext(ctx, "rclone", args...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return nil, false
+	}
+	return parseHashsum(&stdout)
+}
+
+// parseHashsum parses rclone hashsum output into hashes keyed by path. ok
+// is false if any hash is unsupported or there are none.
+func parseHashsum(r io.Reader) (map[string]string, bool) {
+	hashes := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// Format: "<hash>  <path>"; unsupported hashes are blank or UNSUPPORTED
+		sum, path, found := strings.Cut(strings.TrimSpace(scanner.Text()), "  ")
+		if !found || sum == "" || strings.EqualFold(sum, "UNSUPPORTED") {
+			return nil, false
+		}
+		hashes[strings.TrimSpace(path)] = strings.ToLower(sum)
+	}
+	return hashes, len(hashes) > 0
+}
@@ -0,0 +1,204 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/viperadnan-git/dbstash/internal/manifest"
+)
+
+const (
+	helloSHA256 = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	helloMD5    = "5d41402abc4b2a76b9719d911017c592"
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	emptyMD5    = "d41d8cd98f00b204e9800998ecf8427e"
+)
+
+func TestHashWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		sha256 string
+		md5    string
+	}{
+		{"empty", nil, emptySHA256, emptyMD5},
+		{"single write", []string{"hello"}, helloSHA256, helloMD5},
+		{"split writes", []string{"he", "", "llo"}, helloSHA256, helloMD5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hw := newHashWriter()
+			for _, c := range tt.chunks {
+				if n, err := hw.Write([]byte(c)); n != len(c) || err != nil {
+					t.Fatalf("Write(%q) = %d, %v", c, n, err)
+				}
+			}
+			sha, md := hw.digests()
+			if sha != tt.sha256 || md != tt.md5 {
+				t.Errorf("expected %s %s, got %s %s", tt.sha256, tt.md5, sha, md)
+			}
+		})
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dump.sql")
+	if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sha, md, err := hashFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sha != helloSHA256 || md != helloMD5 {
+		t.Errorf("expected %s %s, got %s %s", helloSHA256, helloMD5, sha, md)
+	}
+
+	if _, _, err := hashFile(filepath.Join(dir, "missing.sql")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestHashDir(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"toc.dat":          "hello",
+		"app/users.bson":   "",
+		"app/orders.bson":  "hello",
+		"app/empty/.keep":  "",
+		"metadata/v1.json": "hello",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// Only regular files are hashed
+	if err := os.Symlink("toc.dat", filepath.Join(dir, "link.dat")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	files, err := hashDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expect := []manifest.File{
+		{Path: "app/empty/.keep", Size: 0, SHA256: emptySHA256, MD5: emptyMD5},
+		{Path: "app/orders.bson", Size: 5, SHA256: helloSHA256, MD5: helloMD5},
+		{Path: "app/users.bson", Size: 0, SHA256: emptySHA256, MD5: emptyMD5},
+		{Path: "metadata/v1.json", Size: 5, SHA256: helloSHA256, MD5: helloMD5},
+		{Path: "toc.dat", Size: 5, SHA256: helloSHA256, MD5: helloMD5},
+	}
+	if len(files) != len(expect) {
+		t.Fatalf("expected %d files, got %d: %+v", len(expect), len(files), files)
+	}
+	for i, f := range files {
+		if f != expect[i] {
+			t.Errorf("file %d: expected %+v, got %+v", i, expect[i], f)
+		}
+	}
+
+	if _, err := hashDir(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected error for missing directory")
+	}
+}
+
+func TestParseHashsum(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		ok     bool
+		expect map[string]string
+	}{
+		{
+			name:   "single file",
+			output: helloSHA256 + "  app-20260207T020000Z.sql\n",
+			ok:     true,
+			expect: map[string]string{"app-20260207T020000Z.sql": helloSHA256},
+		},
+		{
+			name:   "directory",
+			output: helloMD5 + "  toc.dat\n" + emptyMD5 + "  app/users.bson\n",
+			ok:     true,
+			expect: map[string]string{"toc.dat": helloMD5, "app/users.bson": emptyMD5},
+		},
+		{
+			name:   "upper case hash",
+			output: strings.ToUpper(helloMD5) + "  toc.dat\n",
+			ok:     true,
+			expect: map[string]string{"toc.dat": helloMD5},
+		},
+		{
+			name:   "path with spaces",
+			output: helloMD5 + "  my dump.sql\n",
+			ok:     true,
+			expect: map[string]string{"my dump.sql": helloMD5},
+		},
+		{"unsupported", "UNSUPPORTED  toc.dat\n", false, nil},
+		{"blank hash", "                                  toc.dat\n", false, nil},
+		{"partly unsupported", helloMD5 + "  toc.dat\nUNSUPPORTED  app/users.bson\n", false, nil},
+		{"empty output", "", false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hashes, ok := parseHashsum(strings.NewReader(tt.output))
+			if ok != tt.ok {
+				t.Fatalf("expected ok %v, got %v", tt.ok, ok)
+			}
+			if len(hashes) != len(tt.expect) {
+				t.Fatalf("expected %d hashes, got %v", len(tt.expect), hashes)
+			}
+			for path, sum := range tt.expect {
+				if hashes[path] != sum {
+					t.Errorf("expected %s for %q, got %q", sum, path, hashes[path])
+				}
+			}
+		})
+	}
+}
+
+func TestCompareHashes(t *testing.T) {
+	files := []manifest.File{
+		{Path: "toc.dat", SHA256: helloSHA256, MD5: helloMD5},
+		{Path: "app/users.bson", SHA256: emptySHA256, MD5: emptyMD5},
+	}
+
+	tests := []struct {
+		name     string
+		hashType string
+		remote   map[string]string
+		wantErr  string
+	}{
+		{"sha256 match", "sha256", map[string]string{"toc.dat": helloSHA256, "app/users.bson": emptySHA256}, ""},
+		{"md5 match", "md5", map[string]string{"toc.dat": helloMD5, "app/users.bson": emptyMD5}, ""},
+		{"extra remote file", "md5", map[string]string{"toc.dat": helloMD5, "app/users.bson": emptyMD5, "old.dat": helloMD5}, ""},
+		{"sha256 mismatch", "sha256", map[string]string{"toc.dat": helloSHA256, "app/users.bson": helloSHA256}, "sha256 mismatch for app/users.bson"},
+		{"md5 compared to sha256", "md5", map[string]string{"toc.dat": helloSHA256, "app/users.bson": emptySHA256}, "md5 mismatch for toc.dat"},
+		{"missing file", "sha256", map[string]string{"toc.dat": helloSHA256}, "app/users.bson missing from remote"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := compareHashes(tt.hashType, files, tt.remote)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -11,13 +11,14 @@ import (
 	"github.com/viperadnan-git/dbstash/internal/config"
 	"github.com/viperadnan-git/dbstash/internal/engine"
 	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/manifest"
 )
 
 // DirectoryPipeline dumps to a temp directory then uploads via rclone copy.
 type DirectoryPipeline struct{}
 
 // Execute runs the directory pipeline: dump → temp dir → rclone copy.
-func (p *DirectoryPipeline) Execute(ctx context.Context, eng engine.Engine, cfg *config.Config) (string, int64, error) {
+func (p *DirectoryPipeline) Execute(ctx context.Context, eng engine.Engine, cfg *config.Config, m *manifest.Manifest) (string, int64, error) {
 	dirname := resolveDirname(cfg.BackupNameTemplate, cfg, eng)
 	remotePath := strings.TrimRight(cfg.RcloneRemote, "/") + "/" + dirname + "/"
 
@@ -41,6 +42,8 @@ func (p *DirectoryPipeline) Execute(ctx context.Context, eng engine.Engine, cfg
 	if err != nil {
 		return "", 0, fmt.Errorf("building dump command: %w", err)
 	}
+	defer engine.Cleanup(dumpCmd)
+	recordDump(m, dumpCmd)
 	var dumpStderr bytes.Buffer
 	dumpCmd.Stderr = &dumpStderr
 
@@ -48,10 +51,16 @@ func (p *DirectoryPipeline) Execute(ctx context.Context, eng engine.Engine, cfg
 	if err := dumpCmd.Run(); err != nil {
 		return "", 0, fmt.Errorf("dump failed: %w (stderr: %s)", err, dumpStderr.String())
 	}
+	recordMetadata(m, cfg, eng, "", dumpStderr.String())
+
+	m.Files, err = hashDir(tempDir)
+	if err != nil {
+		return "", 0, fmt.Errorf("hashing dump: %w", err)
+	}
 
 	// Upload via rclone copy
 	rcloneArgs := []string{"copy", tempDir, remotePath}
-	rcloneArgs = append(rcloneArgs, rcloneConfigArgs(cfg)...)
+	rcloneArgs = append(rcloneArgs, RcloneConfigArgs(cfg)...)
 	rcloneCmd := exec.CommandContext(ctx, "rclone", rcloneArgs...)
 	var rcloneStderr bytes.Buffer
 	rcloneCmd.Stderr = &rcloneStderr
@@ -61,6 +70,13 @@ func (p *DirectoryPipeline) Execute(ctx context.Context, eng engine.Engine, cfg
 		return "", 0, fmt.Errorf("rclone copy failed: %w (stderr: %s)", err, rcloneStderr.String())
 	}
 
+	if err := verifyRemoteHashes(ctx, cfg, remotePath, m.Files); err != nil {
+		cleanupRemoteDir(ctx, remotePath, cfg)
+		return "", 0, fmt.Errorf("verifying upload: %w", err)
+	}
+
+	writeManifest(ctx, cfg, m, remotePath, dirname+"/", "directory", cfg.BackupCompress && eng.SupportsCompression(), "", 0)
+
 	log.Debug().Msg("directory pipeline completed")
 	return remotePath, 0, nil
 }
@@ -4,14 +4,18 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
 
+	"github.com/viperadnan-git/dbstash/internal/compress"
 	"github.com/viperadnan-git/dbstash/internal/config"
 	"github.com/viperadnan-git/dbstash/internal/engine"
 	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/manifest"
 )
 
 // FilePipeline dumps to a temp file then uploads via rclone copy.
@@ -19,7 +23,7 @@ import (
 type FilePipeline struct{}
 
 // Execute runs the file pipeline: dump → temp file → rclone copy.
-func (p *FilePipeline) Execute(ctx context.Context, eng engine.Engine, cfg *config.Config) (string, int64, error) {
+func (p *FilePipeline) Execute(ctx context.Context, eng engine.Engine, cfg *config.Config, m *manifest.Manifest) (string, int64, error) {
 	filename := resolveFilename(cfg.BackupNameTemplate, cfg, eng, cfg.BackupExtension)
 	remoteDir := strings.TrimRight(cfg.RcloneRemote, "/") + "/"
 	remotePath := remoteDir + filename
@@ -40,16 +44,22 @@ func (p *FilePipeline) Execute(ctx context.Context, eng engine.Engine, cfg *conf
 
 	tempFilePath := filepath.Join(tempDir, filename)
 
+	// With BACKUP_COMPRESSION the dump is written without the compression
+	// extension and compressed into tempFilePath once it is complete
+	dumpPath := strings.TrimSuffix(tempFilePath, compress.Extension(cfg.CompressionAlgorithm))
+
 	// Build dump command — engines that support direct file output (mongo, pg)
-	// write to tempFilePath natively; others (mysql, redis) write to stdout
-	// which is redirected to tempFilePath via cmd.Stdout below.
-	dumpCmd, err := eng.DumpCommand(cfg, "file", tempFilePath)
+	// write to dumpPath natively; others (mysql, redis) write to stdout
+	// which is redirected to dumpPath via cmd.Stdout below.
+	dumpCmd, err := eng.DumpCommand(cfg, "file", dumpPath)
 	if err != nil {
 		return "", 0, fmt.Errorf("building dump command: %w", err)
 	}
+	defer engine.Cleanup(dumpCmd)
+	recordDump(m, dumpCmd)
 
 	// Open temp file; used as stdout fallback for engines that write to stdout
-	f, err := os.Create(tempFilePath)
+	f, err := os.Create(dumpPath)
 	if err != nil {
 		return "", 0, fmt.Errorf("creating temp file: %w", err)
 	}
@@ -65,10 +75,23 @@ func (p *FilePipeline) Execute(ctx context.Context, eng engine.Engine, cfg *conf
 	if dumpErr != nil {
 		return "", 0, fmt.Errorf("dump failed: %w (stderr: %s)", dumpErr, dumpStderr.String())
 	}
+	recordMetadata(m, cfg, eng, readHead(dumpPath), dumpStderr.String())
+
+	if dumpPath != tempFilePath {
+		log.Debug().Str("algorithm", cfg.CompressionAlgorithm).Msg("compressing dump")
+		if err := compressFile(dumpPath, tempFilePath, cfg.CompressionAlgorithm, cfg.CompressionLevel); err != nil {
+			return "", 0, err
+		}
+	}
+
+	m.SHA256, m.MD5, err = hashFile(tempFilePath)
+	if err != nil {
+		return "", 0, fmt.Errorf("hashing dump: %w", err)
+	}
 
 	// Upload via rclone copy — runs after dump is fully complete
 	rcloneArgs := []string{"copy", tempDir, remoteDir}
-	rcloneArgs = append(rcloneArgs, rcloneConfigArgs(cfg)...)
+	rcloneArgs = append(rcloneArgs, RcloneConfigArgs(cfg)...)
 	rcloneCmd := exec.CommandContext(ctx, "rclone", rcloneArgs...)
 	var rcloneStderr bytes.Buffer
 	rcloneCmd.Stderr = &rcloneStderr
@@ -78,7 +101,44 @@ func (p *FilePipeline) Execute(ctx context.Context, eng engine.Engine, cfg *conf
 		return "", 0, fmt.Errorf("rclone copy failed: %w (stderr: %s)", err, rcloneStderr.String())
 	}
 
+	if err := verifyRemoteHashes(ctx, cfg, remotePath, []manifest.File{{Path: path.Base(filename), SHA256: m.SHA256, MD5: m.MD5}}); err != nil {
+		cleanupRemoteFile(ctx, remotePath, cfg)
+		return "", 0, fmt.Errorf("verifying upload: %w", err)
+	}
+
 	fileSize := getRemoteFileSize(ctx, remotePath, cfg)
+	writeManifest(ctx, cfg, m, remotePath, filename, "file", cfg.BackupCompress && eng.SupportsCompression(), cfg.CompressionAlgorithm, fileSize)
 	log.Debug().Int64("file_size", fileSize).Msg("file pipeline completed")
 	return remotePath, fileSize, nil
 }
+
+// compressFile compresses the file at src into dst with alg and removes
+// src, so only dst is left to upload.
+func compressFile(src, dst, alg string, level int) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("opening dump: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("creating compressed file: %w", err)
+	}
+	defer out.Close()
+
+	zw, err := compressor(out, alg, level)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(zw, in); err != nil {
+		return fmt.Errorf("%s compression failed: %w", alg, err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("%s compression failed: %w", alg, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("writing compressed file: %w", err)
+	}
+	return os.Remove(src)
+}
@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -13,16 +14,20 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/viperadnan-git/dbstash/internal/compress"
 	"github.com/viperadnan-git/dbstash/internal/config"
 	"github.com/viperadnan-git/dbstash/internal/engine"
 	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/manifest"
 )
 
 // Pipeline defines the interface for backup execution strategies.
 type Pipeline interface {
 	// Execute runs the backup pipeline and returns the remote path,
-	// uploaded file size (best-effort), and any error.
-	Execute(ctx context.Context, eng engine.Engine, cfg *config.Config) (remotePath string, fileSize int64, err error)
+	// uploaded file size (best-effort), and any error. On success it
+	// completes m with the facts of the dump and uploads it as the
+	// backup's manifest sidecar.
+	Execute(ctx context.Context, eng engine.Engine, cfg *config.Config, m *manifest.Manifest) (remotePath string, fileSize int64, err error)
 }
 
 // CleanStaleTempDirs removes any leftover dbstash-* temp directories under
@@ -71,8 +76,9 @@ func New(mode string) (Pipeline, error) {
 //	{uuid}   — first 8 characters of a UUIDv7 (e.g. "019c38fb")
 //
 // The file extension is appended automatically based on the engine and
-// compression setting, unless overridden by BACKUP_EXTENSION. Timestamps
-// use the timezone configured via the TZ environment variable (default UTC).
+// compression setting, unless overridden by BACKUP_EXTENSION, followed by
+// the BACKUP_COMPRESSION extension (e.g. ".zst"). Timestamps use the
+// timezone configured via the TZ environment variable (default UTC).
 func resolveFilename(template string, cfg *config.Config, eng engine.Engine, extension string) string {
 	now := time.Now()
 	if cfg.Timezone != "" && cfg.Timezone != "UTC" {
@@ -95,13 +101,13 @@ func resolveFilename(template string, cfg *config.Config, eng engine.Engine, ext
 
 	// Determine extension
 	if extension == "" {
-		extension = eng.DefaultExtension(cfg.BackupCompress)
+		extension = eng.DefaultExtension(cfg, cfg.BackupMode, cfg.BackupCompress)
 	}
 	if !strings.HasPrefix(extension, ".") {
 		extension = "." + extension
 	}
 
-	return name + extension
+	return name + extension + compress.Extension(cfg.CompressionAlgorithm)
 }
 
 // resolveDirname expands the template for directory mode (no extension).
@@ -128,10 +134,100 @@ func resolveDirname(template string, cfg *config.Config, eng engine.Engine) stri
 	return name
 }
 
+// recordDump fills the manifest fields that describe the dump command.
+func recordDump(m *manifest.Manifest, dumpCmd *exec.Cmd) {
+	m.DumpCommand = config.MaskCmdArgs(dumpCmd.Args)
+	m.DumpToolVersion = engine.ToolVersion(dumpCmd.Args[0])
+}
+
+// headSize is how much of the dump output is kept for metadata parsing.
+// Dump tools write positions such as mysqldump's binlog coordinates in
+// the header, before any data.
+const headSize = 64 * 1024
+
+// headWriter keeps the first headSize bytes written to it and discards
+// the rest.
+type headWriter struct {
+	buf []byte
+}
+
+func (w *headWriter) Write(p []byte) (int, error) {
+	if n := headSize - len(w.buf); n > 0 {
+		w.buf = append(w.buf, p[:min(n, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// readHead returns the first headSize bytes of the file at path, or
+// nothing if it cannot be read.
+func readHead(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	head, _ := io.ReadAll(io.LimitReader(f, headSize))
+	return string(head)
+}
+
+// recordMetadata adds what the dump tool reported about the backup in the
+// head of its output or on stderr to the manifest, for engines that parse
+// it.
+func recordMetadata(m *manifest.Manifest, cfg *config.Config, eng engine.Engine, head, stderr string) {
+	parser, ok := eng.(engine.MetadataParser)
+	if !ok {
+		return
+	}
+	for k, v := range parser.ParseMetadata(cfg, head, stderr) {
+		if m.Metadata == nil {
+			m.Metadata = map[string]string{}
+		}
+		m.Metadata[k] = v
+	}
+	if len(m.Metadata) > 0 {
+		logger.Log.Debug().Interface("metadata", m.Metadata).Msg("recorded backup metadata")
+	}
+}
+
+// compressor wraps w in the BACKUP_COMPRESSION stage for alg. Without
+// an algorithm, it returns w with a Close that does nothing.
+func compressor(w io.Writer, alg string, level int) (io.WriteCloser, error) {
+	if alg == "" {
+		return nopWriteCloser{w}, nil
+	}
+	zw, err := compress.NewWriter(w, alg, level)
+	if err != nil {
+		return nil, fmt.Errorf("starting %s compression: %w", alg, err)
+	}
+	return zw, nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// writeManifest completes m for the uploaded backup and uploads it next to
+// remotePath. Failures are logged rather than returned since the backup
+// itself is intact.
+func writeManifest(ctx context.Context, cfg *config.Config, m *manifest.Manifest, remotePath, name, mode string, compressed bool, compression string, size int64) {
+	m.Name = name
+	m.Mode = mode
+	m.Compressed = compressed
+	m.Compression = compression
+	m.Size = size
+	m.DurationSeconds = time.Since(m.StartedAt).Seconds()
+
+	if err := manifest.Upload(ctx, remotePath, m, RcloneConfigArgs(cfg)); err != nil {
+		logger.Log.Warn().Err(err).Str("path", manifest.Path(remotePath)).Msg("failed to upload backup manifest")
+		return
+	}
+	logger.Log.Debug().Str("path", manifest.Path(remotePath)).Msg("uploaded backup manifest")
+}
+
 // cleanupRemoteFile removes a partially uploaded file from the remote on failure.
 func cleanupRemoteFile(ctx context.Context, remotePath string, cfg *config.Config) {
 	args := []string{"deletefile", remotePath}
-	args = append(args, rcloneConfigArgs(cfg)...)
+	args = append(args, RcloneConfigArgs(cfg)...)
 	cmd := exec.CommandContext(ctx, "rclone", args...)
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
@@ -142,8 +238,24 @@ func cleanupRemoteFile(ctx context.Context, remotePath string, cfg *config.Confi
 	}
 }
 
-// rcloneConfigArgs returns the config flag for rclone if a config file is set.
-func rcloneConfigArgs(cfg *config.Config) []string {
+// cleanupRemoteDir removes a partially uploaded directory from the remote on
+// failure.
+func cleanupRemoteDir(ctx context.Context, remotePath string, cfg *config.Config) {
+	args := []string{"purge", remotePath}
+	args = append(args, RcloneConfigArgs(cfg)...)
+	cmd := exec.CommandContext(ctx, "rclone", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		logger.Log.Warn().Err(err).Str("path", remotePath).Msg("failed to clean up remote directory after error")
+	} else {
+		logger.Log.Debug().Str("path", remotePath).Msg("cleaned up remote directory after error")
+	}
+}
+
+// RcloneConfigArgs returns the config flag for rclone if a config file is set,
+// followed by any RCLONE_EXTRA_ARGS.
+func RcloneConfigArgs(cfg *config.Config) []string {
 	var args []string
 	if cfg.RcloneConfigFile != "" {
 		args = append(args, "--config", cfg.RcloneConfigFile)
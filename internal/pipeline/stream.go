@@ -6,19 +6,21 @@ import (
 	"fmt"
 	"io"
 	"os/exec"
+	"path"
 	"strconv"
 	"strings"
 
 	"github.com/viperadnan-git/dbstash/internal/config"
 	"github.com/viperadnan-git/dbstash/internal/engine"
 	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/manifest"
 )
 
 // StreamPipeline pipes dump stdout directly into rclone rcat.
 type StreamPipeline struct{}
 
 // Execute runs the streaming pipeline: dump stdout → rclone rcat.
-func (p *StreamPipeline) Execute(ctx context.Context, eng engine.Engine, cfg *config.Config) (string, int64, error) {
+func (p *StreamPipeline) Execute(ctx context.Context, eng engine.Engine, cfg *config.Config, m *manifest.Manifest) (string, int64, error) {
 	filename := resolveFilename(cfg.BackupNameTemplate, cfg, eng, cfg.BackupExtension)
 	remotePath := strings.TrimRight(cfg.RcloneRemote, "/") + "/" + filename
 
@@ -30,15 +32,24 @@ func (p *StreamPipeline) Execute(ctx context.Context, eng engine.Engine, cfg *co
 	if err != nil {
 		return "", 0, fmt.Errorf("building dump command: %w", err)
 	}
+	defer engine.Cleanup(dumpCmd)
+	recordDump(m, dumpCmd)
 
 	// Build rclone command
 	rcloneArgs := []string{"rcat", remotePath}
-	rcloneArgs = append(rcloneArgs, rcloneConfigArgs(cfg)...)
+	rcloneArgs = append(rcloneArgs, RcloneConfigArgs(cfg)...)
 	rcloneCmd := exec.CommandContext(ctx, "rclone", rcloneArgs...)
 
-	// Pipe dump stdout → rclone stdin
+	// Pipe dump stdout → compressor → rclone stdin, hashing the uploaded
+	// bytes on the way. Metadata is parsed from the uncompressed head.
 	pr, pw := io.Pipe()
-	dumpCmd.Stdout = pw
+	hw := newHashWriter()
+	head := &headWriter{}
+	zw, err := compressor(io.MultiWriter(pw, hw), cfg.CompressionAlgorithm, cfg.CompressionLevel)
+	if err != nil {
+		return "", 0, err
+	}
+	dumpCmd.Stdout = io.MultiWriter(zw, head)
 
 	rcloneCmd.Stdin = pr
 	var rcloneStderr bytes.Buffer
@@ -65,9 +76,10 @@ func (p *StreamPipeline) Execute(ctx context.Context, eng engine.Engine, cfg *co
 
 	log.Debug().Msg("waiting for dump to complete")
 
-	// Wait for dump to finish, then close the pipe
+	// Wait for dump to finish, flush the compressor, then close the pipe
 	dumpErr := dumpCmd.Wait()
 	log.Debug().Err(dumpErr).Msg("dump process finished")
+	zErr := zw.Close()
 	pw.Close()
 
 	// Wait for rclone to finish
@@ -81,12 +93,24 @@ func (p *StreamPipeline) Execute(ctx context.Context, eng engine.Engine, cfg *co
 		cleanupRemoteFile(ctx, remotePath, cfg)
 		return "", 0, fmt.Errorf("dump failed: %w (stderr: %s)", dumpErr, dumpStderr.String())
 	}
+	if zErr != nil {
+		cleanupRemoteFile(ctx, remotePath, cfg)
+		return "", 0, fmt.Errorf("%s compression failed: %w", cfg.CompressionAlgorithm, zErr)
+	}
 	if rcloneErr != nil {
 		return "", 0, fmt.Errorf("rclone rcat failed: %w (stderr: %s)", rcloneErr, rcloneStderr.String())
 	}
+	recordMetadata(m, cfg, eng, string(head.buf), dumpStderr.String())
+
+	m.SHA256, m.MD5 = hw.digests()
+	if err := verifyRemoteHashes(ctx, cfg, remotePath, []manifest.File{{Path: path.Base(filename), SHA256: m.SHA256, MD5: m.MD5}}); err != nil {
+		cleanupRemoteFile(ctx, remotePath, cfg)
+		return "", 0, fmt.Errorf("verifying upload: %w", err)
+	}
 
 	// Best-effort file size retrieval
 	fileSize := getRemoteFileSize(ctx, remotePath, cfg)
+	writeManifest(ctx, cfg, m, remotePath, filename, "stream", cfg.BackupCompress && eng.SupportsCompression(), cfg.CompressionAlgorithm, fileSize)
 
 	log.Debug().Int64("file_size", fileSize).Msg("stream pipeline completed")
 	return remotePath, fileSize, nil
@@ -95,7 +119,7 @@ func (p *StreamPipeline) Execute(ctx context.Context, eng engine.Engine, cfg *co
 // getRemoteFileSize attempts to get the size of the uploaded file via rclone size.
 func getRemoteFileSize(ctx context.Context, remotePath string, cfg *config.Config) int64 {
 	args := []string{"size", remotePath, "--json"}
-	args = append(args, rcloneConfigArgs(cfg)...)
+	args = append(args, RcloneConfigArgs(cfg)...)
 	cmd := exec.CommandContext(ctx, "rclone", args...)
 
 	output, err := cmd.Output()
@@ -7,23 +7,23 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"path"
 	"strings"
 
+	"github.com/viperadnan-git/dbstash/internal/compress"
 	"github.com/viperadnan-git/dbstash/internal/config"
 	"github.com/viperadnan-git/dbstash/internal/engine"
 	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/manifest"
 )
 
 // TarPipeline dumps to a temp directory, then streams tar output to rclone rcat.
 type TarPipeline struct{}
 
 // Execute runs the tar pipeline: dump → temp dir → tar → rclone rcat.
-func (p *TarPipeline) Execute(ctx context.Context, eng engine.Engine, cfg *config.Config) (string, int64, error) {
-	ext := ".tar"
-	if cfg.BackupCompress {
-		ext = ".tar.gz"
-	}
-	filename := resolveDirname(cfg.BackupNameTemplate, cfg, eng) + ext
+func (p *TarPipeline) Execute(ctx context.Context, eng engine.Engine, cfg *config.Config, m *manifest.Manifest) (string, int64, error) {
+	alg, level := tarCompression(cfg)
+	filename := resolveDirname(cfg.BackupNameTemplate, cfg, eng) + ".tar" + compress.Extension(alg)
 	remotePath := strings.TrimRight(cfg.RcloneRemote, "/") + "/" + filename
 
 	log := logger.Log.With().Str("pipeline", "tar").Str("remote_path", remotePath).Logger()
@@ -45,6 +45,8 @@ func (p *TarPipeline) Execute(ctx context.Context, eng engine.Engine, cfg *confi
 	if err != nil {
 		return "", 0, fmt.Errorf("building dump command: %w", err)
 	}
+	defer engine.Cleanup(dumpCmd)
+	recordDump(m, dumpCmd)
 	var dumpStderr bytes.Buffer
 	dumpCmd.Stderr = &dumpStderr
 
@@ -52,20 +54,21 @@ func (p *TarPipeline) Execute(ctx context.Context, eng engine.Engine, cfg *confi
 	if err := dumpCmd.Run(); err != nil {
 		return "", 0, fmt.Errorf("dump failed: %w (stderr: %s)", err, dumpStderr.String())
 	}
+	recordMetadata(m, cfg, eng, "", dumpStderr.String())
 
-	// Pipe: tar → rclone rcat (with gzip if compression is enabled)
-	var tarCmd *exec.Cmd
-	if cfg.BackupCompress {
-		tarCmd = exec.CommandContext(ctx, "tar", "czf", "-", "-C", tempDir, ".")
-	} else {
-		tarCmd = exec.CommandContext(ctx, "tar", "cf", "-", "-C", tempDir, ".")
-	}
+	// Pipe: tar → compressor → rclone rcat
+	tarCmd := exec.CommandContext(ctx, "tar", "cf", "-", "-C", tempDir, ".")
 	rcloneArgs := []string{"rcat", remotePath}
-	rcloneArgs = append(rcloneArgs, rcloneConfigArgs(cfg)...)
+	rcloneArgs = append(rcloneArgs, RcloneConfigArgs(cfg)...)
 	rcloneCmd := exec.CommandContext(ctx, "rclone", rcloneArgs...)
 
 	pr, pw := io.Pipe()
-	tarCmd.Stdout = pw
+	hw := newHashWriter()
+	zw, err := compressor(io.MultiWriter(pw, hw), alg, level)
+	if err != nil {
+		return "", 0, err
+	}
+	tarCmd.Stdout = zw
 	var tarStderr bytes.Buffer
 	tarCmd.Stderr = &tarStderr
 
@@ -83,6 +86,7 @@ func (p *TarPipeline) Execute(ctx context.Context, eng engine.Engine, cfg *confi
 	}
 
 	tarErr := tarCmd.Wait()
+	zErr := zw.Close()
 	pw.Close()
 
 	rcloneErr := rcloneCmd.Wait()
@@ -93,13 +97,34 @@ func (p *TarPipeline) Execute(ctx context.Context, eng engine.Engine, cfg *confi
 		cleanupRemoteFile(ctx, remotePath, cfg)
 		return "", 0, fmt.Errorf("tar failed: %w (stderr: %s)", tarErr, tarStderr.String())
 	}
+	if zErr != nil {
+		cleanupRemoteFile(ctx, remotePath, cfg)
+		return "", 0, fmt.Errorf("%s compression failed: %w", alg, zErr)
+	}
 	if rcloneErr != nil {
 		return "", 0, fmt.Errorf("rclone rcat failed: %w (stderr: %s)", rcloneErr, rcloneStderr.String())
 	}
 
+	m.SHA256, m.MD5 = hw.digests()
+	if err := verifyRemoteHashes(ctx, cfg, remotePath, []manifest.File{{Path: path.Base(filename), SHA256: m.SHA256, MD5: m.MD5}}); err != nil {
+		cleanupRemoteFile(ctx, remotePath, cfg)
+		return "", 0, fmt.Errorf("verifying upload: %w", err)
+	}
+
 	// Best-effort file size
 	fileSize := getRemoteFileSize(ctx, remotePath, cfg)
+	writeManifest(ctx, cfg, m, remotePath, filename, "tar", cfg.BackupCompress && eng.SupportsCompression(), alg, fileSize)
 
 	log.Debug().Int64("file_size", fileSize).Msg("tar pipeline completed")
 	return remotePath, fileSize, nil
 }
+
+// tarCompression returns the compression for the tar stream:
+// BACKUP_COMPRESSION, or gzip at its default level when only
+// BACKUP_COMPRESS is set.
+func tarCompression(cfg *config.Config) (string, int) {
+	if cfg.CompressionAlgorithm == "" && cfg.BackupCompress {
+		return compress.Gzip, 0
+	}
+	return cfg.CompressionAlgorithm, cfg.CompressionLevel
+}
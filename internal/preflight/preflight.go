@@ -0,0 +1,103 @@
+// Package preflight checks that the database is reachable, and that the
+// dump tool can back up its version, before a backup starts, so either
+// problem fails the run with a clear error before anything is uploaded.
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/engine"
+)
+
+// Failure categories reported in logs and notifications.
+const (
+	// Unreachable is reported when the database never answered.
+	Unreachable = "database_unreachable"
+
+	// VersionMismatch is reported when the dump tool cannot back up the
+	// server's version.
+	VersionMismatch = "version_mismatch"
+)
+
+// attemptTimeout bounds each attempt, so a host that drops packets is not
+// waited on for the operating system's connect timeout.
+const attemptTimeout = 30 * time.Second
+
+// maxBackoff caps the delay between attempts.
+const maxBackoff = 5 * time.Minute
+
+// Check pings the database, retrying up to PREFLIGHT_RETRIES times with a
+// delay that starts at PREFLIGHT_BACKOFF and doubles after each attempt.
+// It returns nil without checking if PREFLIGHT_CHECK is off or the engine
+// cannot be pinged.
+func Check(ctx context.Context, cfg *config.Config, eng engine.Engine, log zerolog.Logger) error {
+	pinger, ok := eng.(engine.Pinger)
+	if !cfg.PreflightCheck || !ok {
+		return nil
+	}
+
+	delay := cfg.PreflightBackoff
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, attemptTimeout)
+		err := pinger.Ping(attemptCtx, cfg)
+		cancel()
+		if err == nil {
+			if attempt > 1 {
+				log.Info().Int("attempts", attempt).Msg("database reachable")
+			}
+			return nil
+		}
+		if attempt > cfg.PreflightRetries {
+			if attempt == 1 {
+				return fmt.Errorf("database unreachable: %w", err)
+			}
+			return fmt.Errorf("database unreachable after %d attempts: %w", attempt, err)
+		}
+
+		log.Warn().Err(err).Int("attempt", attempt).Dur("retry_in", delay).Msg("database unreachable, retrying")
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("database unreachable: %w", err)
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxBackoff)
+	}
+}
+
+// CheckVersions reads the server version and compares it with the dump
+// tool's. It returns the server version, empty if it cannot be read, and
+// an error if the dump tool cannot back up the server. A version that
+// cannot be read, or a tool that may not fully support the server, is
+// only logged.
+func CheckVersions(ctx context.Context, cfg *config.Config, eng engine.Engine, log zerolog.Logger) (string, error) {
+	checker, ok := eng.(engine.VersionChecker)
+	if !ok {
+		return "", nil
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, attemptTimeout)
+	server, err := checker.ServerVersion(attemptCtx, cfg)
+	cancel()
+	if err != nil {
+		log.Warn().Err(err).Msg("could not read the server version")
+		return "", nil
+	}
+	if server == "" {
+		return "", nil
+	}
+
+	warning, err := checker.CheckVersion(cfg, server)
+	if err != nil {
+		return server, err
+	}
+	if warning != "" {
+		log.Warn().Str("server_version", server).Msg(warning)
+	} else {
+		log.Debug().Str("server_version", server).Msg("server version")
+	}
+	return server, nil
+}
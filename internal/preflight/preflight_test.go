@@ -0,0 +1,128 @@
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/engine"
+)
+
+// fakePinger fails its first fails pings.
+type fakePinger struct {
+	engine.Engine
+	fails int
+	calls int
+}
+
+func (f *fakePinger) Ping(_ context.Context, _ *config.Config) error {
+	f.calls++
+	if f.calls <= f.fails {
+		return fmt.Errorf("connection refused")
+	}
+	return nil
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		check     bool
+		retries   int
+		fails     int
+		wantErr   bool
+		wantCalls int
+	}{
+		{"reachable", true, 3, 0, false, 1},
+		{"recovers", true, 3, 2, false, 3},
+		{"unreachable", true, 3, 10, true, 4},
+		{"no retries", true, 0, 1, true, 1},
+		{"disabled", false, 3, 10, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				PreflightCheck:   tt.check,
+				PreflightRetries: tt.retries,
+				PreflightBackoff: time.Millisecond,
+			}
+			eng := &fakePinger{fails: tt.fails}
+			err := Check(context.Background(), cfg, eng, zerolog.Nop())
+			if tt.wantErr && err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if eng.calls != tt.wantCalls {
+				t.Errorf("expected %d pings, got %d", tt.wantCalls, eng.calls)
+			}
+		})
+	}
+}
+
+func TestCheck_Cancelled(t *testing.T) {
+	cfg := &config.Config{PreflightCheck: true, PreflightRetries: 3, PreflightBackoff: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	eng := &fakePinger{fails: 10}
+	if err := Check(ctx, cfg, eng, zerolog.Nop()); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if eng.calls != 1 {
+		t.Errorf("expected 1 ping before the context ended, got %d", eng.calls)
+	}
+}
+
+// fakeChecker reports a server version and the result of comparing it.
+type fakeChecker struct {
+	engine.Engine
+	server     string
+	serverErr  error
+	warning    string
+	checkErr   error
+	checkedFor string
+}
+
+func (f *fakeChecker) ServerVersion(_ context.Context, _ *config.Config) (string, error) {
+	return f.server, f.serverErr
+}
+
+func (f *fakeChecker) CheckVersion(_ *config.Config, server string) (string, error) {
+	f.checkedFor = server
+	return f.warning, f.checkErr
+}
+
+func TestCheckVersions(t *testing.T) {
+	tests := []struct {
+		name       string
+		eng        *fakeChecker
+		wantServer string
+		wantErr    bool
+	}{
+		{"compatible", &fakeChecker{server: "16.2"}, "16.2", false},
+		{"warning", &fakeChecker{server: "8.0.36", warning: "older client"}, "8.0.36", false},
+		{"incompatible", &fakeChecker{server: "17.0", checkErr: fmt.Errorf("pg_dump 16.2 is older")}, "17.0", true},
+		{"unreadable", &fakeChecker{serverErr: fmt.Errorf("connection refused")}, "", false},
+		{"unknown", &fakeChecker{}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := CheckVersions(context.Background(), &config.Config{}, tt.eng, zerolog.Nop())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckVersions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if server != tt.wantServer {
+				t.Errorf("expected server version %q, got %q", tt.wantServer, server)
+			}
+			if tt.eng.checkedFor != tt.wantServer {
+				t.Errorf("expected CheckVersion for %q, got %q", tt.wantServer, tt.eng.checkedFor)
+			}
+		})
+	}
+}
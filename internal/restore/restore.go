@@ -0,0 +1,433 @@
+// Package restore streams a backup from the rclone remote back into a
+// database using the engine's native client tools.
+package restore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/viperadnan-git/dbstash/internal/catalog"
+	"github.com/viperadnan-git/dbstash/internal/compress"
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/engine"
+	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/manifest"
+	"github.com/viperadnan-git/dbstash/internal/pipeline"
+	"github.com/viperadnan-git/dbstash/internal/retention"
+)
+
+// Options controls a single restore run.
+type Options struct {
+	// From is the backup to restore: a name relative to RCLONE_REMOTE
+	// or a full rclone path (remote:path/file).
+	From string
+
+	// RDBPath is the destination of the staged RDB file (redis only).
+	RDBPath string
+
+	// DataDir is the empty data directory a physical backup is extracted
+	// into (pg only).
+	DataDir string
+
+	// TargetDB restores into this database instead of the configured one.
+	TargetDB string
+
+	// Clean drops existing objects before restoring them.
+	Clean bool
+
+	// Jobs is the number of parallel restore workers (0 = tool default).
+	Jobs int
+}
+
+// RemotePath resolves a backup reference to a full rclone path. References
+// that already name a remote (contain ":") are returned unchanged.
+func RemotePath(cfg *config.Config, from string) string {
+	if strings.Contains(from, ":") {
+		return from
+	}
+	return strings.TrimRight(cfg.RcloneRemote, "/") + "/" + strings.TrimLeft(from, "/")
+}
+
+// Command builds the loader command for the given options without running
+// it. Used by dry run to show what would be executed.
+func Command(ctx context.Context, cfg *config.Config, eng engine.Engine, opts Options) (*exec.Cmd, error) {
+	if opts.From == "" {
+		return nil, fmt.Errorf("no backup given; set --from")
+	}
+	restoreOpts := engineOptions(opts)
+	detectFormat(ctx, cfg, eng, RemotePath(cfg, opts.From), &restoreOpts)
+	if restoreOpts.Mode == "directory" || restoreOpts.Mode == "tar" {
+		restoreOpts.Dir = "<extracted backup>"
+	}
+	return eng.RestoreCommand(cfg, restoreOpts)
+}
+
+// Run restores a backup. Stream and file backups are piped straight from
+// rclone cat into the loader; directory and tar backups are first staged in
+// a temp directory under BACKUP_TEMP_DIR.
+func Run(ctx context.Context, cfg *config.Config, eng engine.Engine, opts Options) error {
+	if opts.From == "" {
+		return fmt.Errorf("no backup given; set --from")
+	}
+	remotePath := RemotePath(cfg, opts.From)
+
+	restoreOpts := engineOptions(opts)
+	compression := detectFormat(ctx, cfg, eng, remotePath, &restoreOpts)
+
+	log := logger.Log.With().Str("restore_from", remotePath).Str("mode", restoreOpts.Mode).Logger()
+	log.Debug().Bool("compressed", restoreOpts.Compressed).Str("compression", compression).Msg("starting restore")
+
+	if restoreOpts.Mode == "directory" || restoreOpts.Mode == "tar" {
+		tempDir, err := os.MkdirTemp(cfg.BackupTempDir, "dbstash-restore-")
+		if err != nil {
+			os.MkdirAll(cfg.BackupTempDir, 0o755)
+			tempDir, err = os.MkdirTemp(cfg.BackupTempDir, "dbstash-restore-")
+			if err != nil {
+				return fmt.Errorf("creating temp dir: %w", err)
+			}
+		}
+		defer os.RemoveAll(tempDir)
+
+		if err := stage(ctx, cfg, remotePath, restoreOpts, compression, tempDir); err != nil {
+			return err
+		}
+		restoreOpts.Dir = tempDir
+
+		loadCmd, err := eng.RestoreCommand(cfg, restoreOpts)
+		if err != nil {
+			return fmt.Errorf("building restore command: %w", err)
+		}
+		defer engine.Cleanup(loadCmd)
+		var loadStderr bytes.Buffer
+		loadCmd.Stderr = &loadStderr
+
+		log.Debug().Str("restore_cmd", config.MaskCmdArgs(loadCmd.Args)).Msg("executing restore command")
+		if err := loadCmd.Run(); err != nil {
+			return fmt.Errorf("restore failed: %w (stderr: %s)", err, loadStderr.String())
+		}
+
+		log.Debug().Msg("restore completed")
+		return nil
+	}
+
+	loadCmd, err := eng.RestoreCommand(cfg, restoreOpts)
+	if err != nil {
+		return fmt.Errorf("building restore command: %w", err)
+	}
+	defer engine.Cleanup(loadCmd)
+
+	rcloneArgs := []string{"cat", remotePath}
+	rcloneArgs = append(rcloneArgs, pipeline.RcloneConfigArgs(cfg)...)
+	rcloneCmd := exec.CommandContext(ctx, "rclone", rcloneArgs...)
+
+	// Pipe rclone stdout → decompressor → loader stdin
+	pr, pw := io.Pipe()
+	rcloneCmd.Stdout = pw
+	zr := decompressor(pr, compression)
+	loadCmd.Stdin = zr
+
+	var rcloneStderr, loadStderr bytes.Buffer
+	rcloneCmd.Stderr = &rcloneStderr
+	loadCmd.Stderr = &loadStderr
+
+	log.Debug().Str("restore_cmd", config.MaskCmdArgs(loadCmd.Args)).Msg("executing restore command")
+	log.Debug().Strs("rclone_args", rcloneArgs).Msg("executing rclone command")
+
+	// Start the loader first so it is ready to consume the stream
+	if err := loadCmd.Start(); err != nil {
+		return fmt.Errorf("starting restore: %w", err)
+	}
+	if err := rcloneCmd.Start(); err != nil {
+		pw.Close()
+		loadCmd.Wait()
+		return fmt.Errorf("starting rclone: %w", err)
+	}
+
+	rcloneErr, loadErr := waitPipe(rcloneCmd, loadCmd, pr, pw, zr)
+	if rcloneErr != nil {
+		return fmt.Errorf("rclone cat failed: %w (stderr: %s)", rcloneErr, rcloneStderr.String())
+	}
+	if loadErr != nil {
+		return fmt.Errorf("restore failed: %w (stderr: %s)", loadErr, loadStderr.String())
+	}
+
+	log.Debug().Msg("restore completed")
+	return nil
+}
+
+// errConsumerExited fails rclone's writes once nothing reads the pipe.
+var errConsumerExited = errors.New("consumer exited before the end of the backup")
+
+// waitPipe waits for rcloneCmd, which writes to pw, and consumer, which
+// reads from pr through the decompressor zr. The consumer is waited on
+// concurrently: once it exits nothing reads pr, so pr and zr are closed to
+// fail rclone's writes instead of leaving rclone blocked. An rclone failure
+// closes pw with its error, so the consumer sees a failed read rather than
+// a clean end of stream and a truncated backup is not taken as complete.
+// Only the error of the side that ended the stream is returned.
+func waitPipe(rcloneCmd, consumer *exec.Cmd, pr *io.PipeReader, pw *io.PipeWriter, zr io.Closer) (rcloneErr, consumerErr error) {
+	consumerDone := make(chan error, 1)
+	go func() {
+		consumerDone <- consumer.Wait()
+		pr.CloseWithError(errConsumerExited)
+		zr.Close()
+	}()
+
+	rcloneErr = rcloneCmd.Wait()
+	select {
+	case consumerErr = <-consumerDone:
+		// The consumer exited first; rclone only failed to write to it
+		if consumerErr != nil {
+			return nil, consumerErr
+		}
+		return rcloneErr, nil
+	default:
+	}
+
+	pw.CloseWithError(rcloneErr)
+	consumerErr = <-consumerDone
+	if rcloneErr != nil {
+		return rcloneErr, nil
+	}
+	return nil, consumerErr
+}
+
+// engineOptions copies the user-facing options into engine restore options.
+func engineOptions(opts Options) engine.RestoreOptions {
+	return engine.RestoreOptions{
+		RDBPath:  opts.RDBPath,
+		DataDir:  opts.DataDir,
+		TargetDB: opts.TargetDB,
+		Clean:    opts.Clean,
+		Jobs:     opts.Jobs,
+	}
+}
+
+// detectFormat sets the backup mode, compression, whether it is a
+// physical backup, whether it carries an oplog to replay, and the tool
+// that took it, preferring the backup's manifest and falling back to
+// InferFormat, BACKUP_METHOD, and BACKUP_OPLOG. It returns the
+// BACKUP_COMPRESSION algorithm the backup was compressed with, if any.
+func detectFormat(ctx context.Context, cfg *config.Config, eng engine.Engine, remotePath string, opts *engine.RestoreOptions) string {
+	m, err := manifest.Fetch(ctx, remotePath, pipeline.RcloneConfigArgs(cfg))
+	if err == nil {
+		opts.Mode, opts.Compressed = m.Mode, m.Compressed
+		opts.Database = m.Database
+		opts.Physical = m.Method == "physical"
+		opts.OplogReplay = m.Metadata["oplog"] == "true"
+		if fields := strings.Fields(m.DumpCommand); len(fields) > 0 {
+			opts.DumpTool = filepath.Base(fields[0])
+		}
+		return m.Compression
+	}
+	logger.Log.Debug().Err(err).Msg("no manifest found, inferring format from name")
+	var compression string
+	opts.Mode, opts.Compressed, compression = InferFormat(ctx, cfg, eng, remotePath)
+	opts.Physical = cfg.BackupMethod == "physical"
+	opts.OplogReplay = cfg.BackupOplog
+	if cfg.BackupSplitDatabases {
+		opts.Database = databaseFromName(cfg, eng, remotePath)
+	}
+	return compression
+}
+
+// databaseFromName returns the {db} of a backup on RCLONE_REMOTE, read
+// from its name with the name template, or an empty string if the name
+// does not match it.
+func databaseFromName(cfg *config.Config, eng engine.Engine, remotePath string) string {
+	matcher, err := catalog.NewMatcher(cfg, eng)
+	if err != nil {
+		return ""
+	}
+	name, ok := strings.CutPrefix(remotePath, strings.TrimRight(cfg.RcloneRemote, "/")+"/")
+	if !ok {
+		return ""
+	}
+	entry, ok := matcher.Match(retention.RemoteEntry{
+		Path:  strings.TrimRight(name, "/"),
+		Name:  path.Base(name),
+		IsDir: strings.HasSuffix(name, "/"),
+	})
+	if !ok {
+		return ""
+	}
+	return entry.Database
+}
+
+// InferFormat guesses the backup mode, native compression, and
+// BACKUP_COMPRESSION algorithm from the remote name. Names that match none
+// of the engine's extensions are looked up on the remote to tell directory
+// backups apart from files with a custom BACKUP_EXTENSION; for those,
+// compression follows BACKUP_COMPRESS.
+func InferFormat(ctx context.Context, cfg *config.Config, eng engine.Engine, remotePath string) (string, bool, string) {
+	if strings.HasSuffix(remotePath, "/") {
+		return "directory", cfg.BackupCompress, ""
+	}
+	if mode, compressed, ok := formatFromName(cfg, eng, remotePath); ok {
+		return mode, compressed, ""
+	}
+	// The compression extension follows the one the format has
+	if stem, alg := compress.FromName(remotePath); alg != "" {
+		if mode, compressed, ok := formatFromName(cfg, eng, stem); ok {
+			return mode, compressed, alg
+		}
+		return "stream", cfg.BackupCompress, alg
+	}
+
+	if isRemoteDir(ctx, cfg, remotePath) {
+		return "directory", cfg.BackupCompress, ""
+	}
+	return "stream", cfg.BackupCompress, ""
+}
+
+// formatFromName returns the mode and native compression of a name that
+// ends with one of the engine's extensions or a tar extension.
+func formatFromName(cfg *config.Config, eng engine.Engine, name string) (string, bool, bool) {
+	// Engine extensions come first: physical pg backups are streamed tars
+	for _, mode := range []string{"stream", "file"} {
+		for _, compressed := range []bool{false, true} {
+			if strings.HasSuffix(name, eng.DefaultExtension(cfg, mode, compressed)) {
+				return mode, compressed, true
+			}
+		}
+	}
+	switch {
+	case strings.HasSuffix(name, ".tar"):
+		return "tar", false, true
+	case strings.HasSuffix(name, ".tar.gz"):
+		return "tar", true, true
+	}
+	return "", false, false
+}
+
+// isRemoteDir reports whether remotePath is a directory on the remote.
+// Lookup errors are treated as "not a directory".
+func isRemoteDir(ctx context.Context, cfg *config.Config, remotePath string) bool {
+	args := []string{"lsjson", "--stat", remotePath}
+	args = append(args, pipeline.RcloneConfigArgs(cfg)...)
+	output, err := exec.CommandContext(ctx, "rclone", args...).Output()
+	if err != nil {
+		return false
+	}
+	var entry struct {
+		IsDir bool `json:"IsDir"`
+	}
+	if err := json.Unmarshal(output, &entry); err != nil {
+		return false
+	}
+	return entry.IsDir
+}
+
+// stage downloads a directory or tar backup into dir.
+func stage(ctx context.Context, cfg *config.Config, remotePath string, opts engine.RestoreOptions, compression, dir string) error {
+	if opts.Mode == "directory" {
+		args := []string{"copy", remotePath, dir}
+		args = append(args, pipeline.RcloneConfigArgs(cfg)...)
+		cmd := exec.CommandContext(ctx, "rclone", args...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("rclone copy failed: %w (stderr: %s)", err, stderr.String())
+		}
+		return nil
+	}
+
+	// Pipe: rclone cat → decompressor → tar extract. Tars without a
+	// recorded BACKUP_COMPRESSION are gzipped when BACKUP_COMPRESS was set.
+	rcloneArgs := []string{"cat", remotePath}
+	rcloneArgs = append(rcloneArgs, pipeline.RcloneConfigArgs(cfg)...)
+	rcloneCmd := exec.CommandContext(ctx, "rclone", rcloneArgs...)
+
+	if compression == "" && opts.Compressed {
+		compression = compress.Gzip
+	}
+	tarCmd := exec.CommandContext(ctx, "tar", "xf", "-", "-C", dir)
+
+	pr, pw := io.Pipe()
+	rcloneCmd.Stdout = pw
+	zr := decompressor(pr, compression)
+	tarCmd.Stdin = zr
+
+	var rcloneStderr, tarStderr bytes.Buffer
+	rcloneCmd.Stderr = &rcloneStderr
+	tarCmd.Stderr = &tarStderr
+
+	if err := tarCmd.Start(); err != nil {
+		return fmt.Errorf("starting tar: %w", err)
+	}
+	if err := rcloneCmd.Start(); err != nil {
+		pw.Close()
+		tarCmd.Wait()
+		return fmt.Errorf("starting rclone: %w", err)
+	}
+
+	rcloneErr, tarErr := waitPipe(rcloneCmd, tarCmd, pr, pw, zr)
+	if rcloneErr != nil {
+		return fmt.Errorf("rclone cat failed: %w (stderr: %s)", rcloneErr, rcloneStderr.String())
+	}
+	if tarErr != nil {
+		return fmt.Errorf("tar extract failed: %w (stderr: %s)", tarErr, tarStderr.String())
+	}
+	return nil
+}
+
+// decompressor returns a reader that undoes the BACKUP_COMPRESSION stage
+// alg on r, or r itself for no compression. The stream header is read on
+// the first Read, so the reader can be handed to a command before rclone
+// has started writing. A corrupt stream closes r with the error, which
+// stops rclone at once rather than when the consumer gives up.
+func decompressor(r *io.PipeReader, alg string) io.ReadCloser {
+	if alg == "" {
+		return io.NopCloser(r)
+	}
+	return &lazyReader{r: r, alg: alg}
+}
+
+type lazyReader struct {
+	r   *io.PipeReader
+	alg string
+	zr  io.ReadCloser
+	err error
+}
+
+func (l *lazyReader) Read(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	if l.zr == nil {
+		zr, err := compress.NewReader(l.r, l.alg)
+		if err != nil {
+			return 0, l.fail(err)
+		}
+		l.zr = zr
+	}
+	n, err := l.zr.Read(p)
+	if err != nil && err != io.EOF {
+		return n, l.fail(err)
+	}
+	return n, err
+}
+
+// fail records err as the result of every later Read and closes the pipe
+// with it.
+func (l *lazyReader) fail(err error) error {
+	l.err = fmt.Errorf("reading %s stream: %w", l.alg, err)
+	l.r.CloseWithError(l.err)
+	return l.err
+}
+
+func (l *lazyReader) Close() error {
+	if l.zr == nil {
+		return nil
+	}
+	return l.zr.Close()
+}
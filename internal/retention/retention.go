@@ -9,13 +9,37 @@ import (
 	"fmt"
 	"os/exec"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/viperadnan-git/dbstash/internal/config"
 	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/manifest"
 )
 
+// Directories under RCLONE_REMOTE that log archiving writes to:
+// PostgreSQL WAL, MySQL/MariaDB binlogs, and MongoDB oplog slices. They
+// are not backups and are pruned separately.
+const (
+	WALDir    = "wal"
+	BinlogDir = "binlog"
+	OplogDir  = "oplog"
+)
+
+// IsArchiveDir reports whether entry is one of the log archive
+// directories.
+func IsArchiveDir(entry RemoteEntry) bool {
+	return entry.IsDir && (entry.Path == WALDir || entry.Path == BinlogDir || entry.Path == OplogDir)
+}
+
+// InArchiveDir reports whether path lies inside one of the log archive
+// directories.
+func InArchiveDir(path string) bool {
+	dir, _, nested := strings.Cut(path, "/")
+	return nested && IsArchiveDir(RemoteEntry{Path: dir, IsDir: true})
+}
+
 // RemoteEntry represents a single item returned by rclone lsjson.
 type RemoteEntry struct {
 	Path    string    `json:"Path"`
@@ -29,12 +53,19 @@ type RemoteEntry struct {
 // RETENTION_MAX_FILES and RETENTION_MAX_DAYS. It returns the number
 // of entries deleted.
 func Run(ctx context.Context, cfg *config.Config) (int, error) {
+	return RunMatching(ctx, cfg, nil)
+}
+
+// RunMatching is Run limited to the backups match accepts, so that each
+// database of a split backup keeps its own RETENTION_MAX_FILES. A nil
+// match accepts every backup.
+func RunMatching(ctx context.Context, cfg *config.Config, match func(RemoteEntry) bool) (int, error) {
 	if cfg.RetentionMaxFiles <= 0 && cfg.RetentionMaxDays <= 0 {
 		logger.Log.Debug().Msg("retention: no constraints configured, skipping")
 		return 0, nil
 	}
 
-	entries, err := listRemote(ctx, cfg)
+	entries, err := ListBackups(ctx, cfg)
 	if err != nil {
 		return 0, fmt.Errorf("listing remote for retention: %w", err)
 	}
@@ -44,9 +75,32 @@ func Run(ctx context.Context, cfg *config.Config) (int, error) {
 		return 0, nil
 	}
 
-	toDelete := selectDeletions(entries, cfg.RetentionMaxFiles, cfg.RetentionMaxDays)
+	// Manifest sidecars don't count as backups; they are removed together
+	// with the backup they describe. Neither do the directories the name
+	// template creates to hold them.
+	depth := templateDepth(cfg)
+	manifests := make(map[string]bool)
+	var backups []RemoteEntry
+	for _, entry := range entries {
+		if IsArchiveDir(entry) || InArchiveDir(entry.Path) {
+			continue
+		}
+		if entry.IsDir && strings.Count(entry.Path, "/")+1 < depth {
+			continue
+		}
+		if manifest.IsManifest(entry.Path) {
+			manifests[entry.Path] = true
+			continue
+		}
+		if match != nil && !match(entry) {
+			continue
+		}
+		backups = append(backups, entry)
+	}
+
+	toDelete := selectDeletions(backups, cfg.RetentionMaxFiles, cfg.RetentionMaxDays)
 	if len(toDelete) == 0 {
-		logger.Log.Debug().Int("total_entries", len(entries)).Msg("retention: nothing to delete")
+		logger.Log.Debug().Int("total_entries", len(backups)).Msg("retention: nothing to delete")
 		return 0, nil
 	}
 
@@ -58,6 +112,12 @@ func Run(ctx context.Context, cfg *config.Config) (int, error) {
 		}
 		logger.Log.Info().Str("path", entry.Path).Time("mod_time", entry.ModTime).Msg("retention: deleted old backup")
 		deleted++
+
+		if sidecar := manifest.Path(entry.Path); manifests[sidecar] {
+			if err := deleteEntry(ctx, cfg, RemoteEntry{Path: sidecar}); err != nil {
+				logger.Log.Warn().Err(err).Str("path", sidecar).Msg("retention: failed to delete manifest")
+			}
+		}
 	}
 
 	return deleted, nil
@@ -117,8 +177,30 @@ func selectDeletions(entries []RemoteEntry, maxFiles, maxDays int) []RemoteEntry
 	return result
 }
 
-func listRemote(ctx context.Context, cfg *config.Config) ([]RemoteEntry, error) {
+// ListRemote returns the top-level entries of RCLONE_REMOTE via rclone lsjson.
+func ListRemote(ctx context.Context, cfg *config.Config) ([]RemoteEntry, error) {
+	return listRemote(ctx, cfg, 1)
+}
+
+// ListBackups returns the entries of RCLONE_REMOTE down to the depth of
+// BACKUP_NAME_TEMPLATE, so that backups the template places in
+// subdirectories (e.g. "{engine}/{db}-{timestamp}") are included. Paths
+// are relative to RCLONE_REMOTE.
+func ListBackups(ctx context.Context, cfg *config.Config) ([]RemoteEntry, error) {
+	return listRemote(ctx, cfg, templateDepth(cfg))
+}
+
+// templateDepth returns the number of path components in the names
+// BACKUP_NAME_TEMPLATE expands to.
+func templateDepth(cfg *config.Config) int {
+	return strings.Count(cfg.BackupNameTemplate, "/") + 1
+}
+
+func listRemote(ctx context.Context, cfg *config.Config, depth int) ([]RemoteEntry, error) {
 	args := []string{"lsjson", cfg.RcloneRemote}
+	if depth > 1 {
+		args = append(args, "--recursive", "--max-depth", strconv.Itoa(depth))
+	}
 	if cfg.RcloneConfigFile != "" {
 		args = append(args, "--config", cfg.RcloneConfigFile)
 	}
@@ -156,3 +156,25 @@ func TestSelectDeletions_SortOrder(t *testing.T) {
 		t.Errorf("expected a.sql and b.sql to be deleted, got %v", result)
 	}
 }
+
+func TestInArchiveDir(t *testing.T) {
+	tests := []struct {
+		path   string
+		expect bool
+	}{
+		{"wal/000000010000000000000001", true},
+		{"binlog/mysql-bin.000001", true},
+		{"oplog/oplog-1770508800-1770512400.bson.gz", true},
+		{"wal", false},
+		{"mongo/shop_2026-02-07_020000.archive.gz", false},
+		{"app-20260207T020000Z.sql", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := InArchiveDir(tt.path); got != tt.expect {
+				t.Errorf("InArchiveDir(%q) = %v, want %v", tt.path, got, tt.expect)
+			}
+		})
+	}
+}
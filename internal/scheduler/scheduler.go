@@ -13,25 +13,35 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog"
+	"github.com/viperadnan-git/dbstash/internal/binlog"
 	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/drill"
 	"github.com/viperadnan-git/dbstash/internal/engine"
 	"github.com/viperadnan-git/dbstash/internal/health"
 	"github.com/viperadnan-git/dbstash/internal/hooks"
 	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/manifest"
 	"github.com/viperadnan-git/dbstash/internal/notify"
+	"github.com/viperadnan-git/dbstash/internal/oplog"
 	"github.com/viperadnan-git/dbstash/internal/pipeline"
+	"github.com/viperadnan-git/dbstash/internal/preflight"
 	"github.com/viperadnan-git/dbstash/internal/retention"
+	"github.com/viperadnan-git/dbstash/internal/tunnel"
+	"github.com/viperadnan-git/dbstash/internal/verify"
+	"github.com/viperadnan-git/dbstash/internal/wal"
 )
 
 // Scheduler wraps cron scheduling with lock guarding.
 type Scheduler struct {
-	cron    *cron.Cron
-	cfg     *config.Config
-	eng     engine.Engine
-	pipe    pipeline.Pipeline
-	tracker *health.Tracker
-	running atomic.Bool
-	mu      sync.Mutex
+	cron     *cron.Cron
+	cfg      *config.Config
+	eng      engine.Engine
+	pipe     pipeline.Pipeline
+	tracker  *health.Tracker
+	running  atomic.Bool
+	drilling atomic.Bool
+	mu       sync.Mutex
 }
 
 // New creates a new Scheduler.
@@ -55,6 +65,31 @@ func (s *Scheduler) Start() error {
 		return fmt.Errorf("adding cron job: %w", err)
 	}
 
+	if s.cfg.VerifySchedule != "" {
+		_, err := s.cron.AddFunc(s.cfg.VerifySchedule, func() {
+			RunVerify(context.Background(), s.cfg, s.eng, "")
+		})
+		if err != nil {
+			return fmt.Errorf("adding verify cron job: %w", err)
+		}
+		logger.Log.Info().Str("schedule", s.cfg.VerifySchedule).Msg("backup verification scheduled")
+	}
+
+	if s.cfg.DrillSchedule != "" {
+		_, err := s.cron.AddFunc(s.cfg.DrillSchedule, func() {
+			if !s.drilling.CompareAndSwap(false, true) {
+				logger.Log.Warn().Msg("skipping restore drill: previous drill still in progress")
+				return
+			}
+			defer s.drilling.Store(false)
+			RunDrill(context.Background(), s.cfg, s.eng, s.tracker)
+		})
+		if err != nil {
+			return fmt.Errorf("adding drill cron job: %w", err)
+		}
+		logger.Log.Info().Str("schedule", s.cfg.DrillSchedule).Str("target", s.cfg.DrillTargetDB).Msg("restore drills scheduled")
+	}
+
 	s.cron.Start()
 	logger.Log.Info().Str("schedule", s.cfg.BackupSchedule).Msg("cron scheduler started")
 	return nil
@@ -109,6 +144,11 @@ func RunOnce(parentCtx context.Context, cfg *config.Config, eng engine.Engine, p
 		fileSize   int64
 		status     = "success"
 		backupErr  error
+		category   string
+		notified   bool
+		m          = newManifest(backupID, cfg, eng, start)
+		tun        *tunnel.Tunnel
+		tunneled   *config.Config
 	)
 
 	// Pre-backup hook
@@ -119,8 +159,56 @@ func RunOnce(parentCtx context.Context, cfg *config.Config, eng engine.Engine, p
 		goto notify
 	}
 
+	// Reach the database through the SSH bastion for the rest of the run
+	if tun, tunneled, backupErr = tunnel.Open(cfg); backupErr != nil {
+		status = "failure"
+		log.Error().Err(backupErr).Msg("SSH tunnel failed, skipping backup")
+		goto notify
+	}
+	defer tun.Close()
+	cfg = tunneled
+
+	// Fail before anything is uploaded if the database is down
+	if backupErr = preflight.Check(ctx, cfg, eng, log); backupErr != nil {
+		status = "failure"
+		category = preflight.Unreachable
+		log.Error().Err(backupErr).Str("category", category).Msg("database unreachable, skipping backup")
+		goto notify
+	}
+	if m.ServerVersion, backupErr = preflight.CheckVersions(ctx, cfg, eng, log); backupErr != nil {
+		status = "failure"
+		category = preflight.VersionMismatch
+		log.Error().Err(backupErr).Str("category", category).Msg("dump tool cannot back up this server, skipping backup")
+		goto notify
+	}
+
+	// Split backups clean up and notify per database (or cluster shard)
+	if cfg.BackupSplitDatabases || cfg.RedisCluster {
+		var dumped int
+		remotePath = cfg.RcloneRemote
+		fileSize, dumped, backupErr = runSplit(ctx, cfg, eng, pipe, backupID, m.ServerVersion, log)
+		notified = dumped > 0
+		if backupErr != nil {
+			status = "failure"
+			log.Error().Err(backupErr).Msg("backup failed")
+		} else {
+			pruneArchives(ctx, cfg, eng, log)
+		}
+		goto notify
+	}
+
+	// Oplog replay starts from the newest entry before the dump; mongodump
+	// --oplog captures everything after it
+	if cfg.BackupOplog {
+		if ts, err := oplog.Latest(ctx, cfg, eng); err != nil {
+			log.Warn().Err(err).Msg("failed to read the oplog position, the dump cannot be rolled forward")
+		} else {
+			m.Metadata = map[string]string{"oplog_start": ts.String()}
+		}
+	}
+
 	// Execute pipeline
-	remotePath, fileSize, backupErr = pipe.Execute(ctx, eng, cfg)
+	remotePath, fileSize, backupErr = pipe.Execute(ctx, eng, cfg, m)
 	if backupErr != nil {
 		status = "failure"
 		log.Error().Err(backupErr).Msg("backup failed")
@@ -138,6 +226,8 @@ func RunOnce(parentCtx context.Context, cfg *config.Config, eng engine.Engine, p
 		} else if deleted > 0 {
 			log.Info().Int("deleted", deleted).Msg("retention cleanup completed")
 		}
+
+		pruneArchives(ctx, cfg, eng, log)
 	}
 
 notify:
@@ -163,8 +253,11 @@ notify:
 	}
 	if backupErr != nil {
 		result.Error = backupErr.Error()
+		result.Category = category
+	}
+	if !notified {
+		notify.Send(ctx, cfg.NotifyWebhookURL, cfg.NotifyOn, result)
 	}
-	notify.Send(ctx, cfg.NotifyWebhookURL, cfg.NotifyOn, result)
 
 	// Log summary
 	log.Info().
@@ -180,6 +273,138 @@ notify:
 	return nil
 }
 
+// newManifest starts the manifest of a backup run.
+func newManifest(backupID string, cfg *config.Config, eng engine.Engine, start time.Time) *manifest.Manifest {
+	return &manifest.Manifest{
+		BackupID:       backupID,
+		Engine:         eng.Name(),
+		Database:       cfg.DBNameOrDefault(),
+		Method:         cfg.BackupMethod,
+		StartedAt:      start,
+		DBStashVersion: manifest.Version,
+		Timezone:       cfg.Timezone,
+		NameTemplate:   cfg.BackupNameTemplate,
+	}
+}
+
+// pruneArchives deletes the archived WAL, binlogs, and oplog slices that
+// no retained backup needs, for whichever log archiving is configured.
+func pruneArchives(ctx context.Context, cfg *config.Config, eng engine.Engine, log zerolog.Logger) {
+	// Archived WAL is only useful from the oldest base backup on
+	if cfg.BackupMethod == "physical" && cfg.Engine == "pg" {
+		pruned, err := wal.Prune(ctx, cfg, eng)
+		if err != nil {
+			log.Warn().Err(err).Msg("WAL pruning failed")
+		} else if pruned > 0 {
+			log.Info().Int("deleted", pruned).Msg("WAL pruning completed")
+		}
+	}
+
+	// Likewise binlogs and oplog are only replayed from the oldest dump on
+	if cfg.BackupBinlogPosition {
+		pruned, err := binlog.Prune(ctx, cfg, eng)
+		if err != nil {
+			log.Warn().Err(err).Msg("binlog pruning failed")
+		} else if pruned > 0 {
+			log.Info().Int("deleted", pruned).Msg("binlog pruning completed")
+		}
+	}
+	if cfg.BackupOplog {
+		pruned, err := oplog.Prune(ctx, cfg, eng)
+		if err != nil {
+			log.Warn().Err(err).Msg("oplog pruning failed")
+		} else if pruned > 0 {
+			log.Info().Int("deleted", pruned).Msg("oplog pruning completed")
+		}
+	}
+}
+
+// RunVerify verifies a backup (the newest one if from is empty), logs the
+// outcome, and sends a notification per NOTIFY_ON.
+func RunVerify(ctx context.Context, cfg *config.Config, eng engine.Engine, from string) error {
+	log := logger.With(eng.Name(), cfg.DBNameOrDefault(), "")
+	start := time.Now()
+
+	log.Info().Str("from", from).Msg("verification started")
+	res, err := verify.Run(ctx, cfg, eng, from)
+
+	result := notify.Result{
+		Operation: "verify",
+		Status:    "success",
+		Engine:    eng.Name(),
+		Database:  cfg.DBNameOrDefault(),
+		Duration:  time.Since(start),
+	}
+	if res != nil {
+		result.RemotePath = res.RemotePath
+		result.FileSize = res.Size
+	}
+	if err != nil {
+		result.Status = "failure"
+		result.Error = err.Error()
+		log.Error().Err(err).Str("remote_path", result.RemotePath).Msg("backup verification failed")
+	} else {
+		log.Info().
+			Str("remote_path", res.RemotePath).
+			Str("mode", res.Mode).
+			Int64("file_size", res.Size).
+			Strs("checks", res.Checks).
+			Dur("duration", result.Duration).
+			Msg("backup verified")
+	}
+
+	notify.Send(ctx, cfg.NotifyWebhookURL, cfg.NotifyOn, result)
+	return err
+}
+
+// RunDrill restores the newest backup into the scratch database and runs
+// the sanity queries, recording the outcome in the health tracker and
+// sending a notification per NOTIFY_ON.
+func RunDrill(ctx context.Context, cfg *config.Config, eng engine.Engine, tracker *health.Tracker) error {
+	log := logger.With(eng.Name(), cfg.DBNameOrDefault(), "")
+	start := time.Now()
+
+	log.Info().Str("target", cfg.DrillTargetDB).Msg("restore drill started")
+	var res *drill.Result
+	t, tunneled, err := tunnel.Open(cfg)
+	if err == nil {
+		defer t.Close()
+		res, err = drill.Run(ctx, tunneled, eng)
+	}
+
+	result := notify.Result{
+		Operation: "drill",
+		Status:    "success",
+		Engine:    eng.Name(),
+		Database:  cfg.DBNameOrDefault(),
+		Duration:  time.Since(start),
+	}
+	if res != nil {
+		result.RemotePath = res.RemotePath
+		if res.Size > 0 {
+			result.FileSize = res.Size
+		}
+	}
+	if err != nil {
+		result.Status = "failure"
+		result.Error = err.Error()
+		log.Error().Err(err).Str("remote_path", result.RemotePath).Msg("restore drill failed")
+	} else {
+		log.Info().
+			Str("remote_path", res.RemotePath).
+			Str("target", cfg.DrillTargetDB).
+			Bool("queries", res.Queries).
+			Dur("duration", result.Duration).
+			Msg("restore drill passed")
+	}
+
+	if tracker != nil {
+		tracker.UpdateDrill(result.Status)
+	}
+	notify.Send(ctx, cfg.NotifyWebhookURL, cfg.NotifyOn, result)
+	return err
+}
+
 // CheckConflictingFlags scans DUMP_EXTRA_ARGS against the engine's
 // conflicting flags for the current mode and logs warnings.
 func CheckConflictingFlags(cfg *config.Config, eng engine.Engine) {
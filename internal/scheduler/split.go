@@ -0,0 +1,222 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/viperadnan-git/dbstash/internal/catalog"
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/engine"
+	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/notify"
+	"github.com/viperadnan-git/dbstash/internal/pipeline"
+	"github.com/viperadnan-git/dbstash/internal/retention"
+)
+
+// globalsName is the {db} of the backup holding the server-wide objects
+// of a split backup.
+const globalsName = engine.GlobalsDatabase
+
+// splitTarget is one backup of a split run.
+type splitTarget struct {
+	cfg  *config.Config
+	eng  engine.Engine
+	pipe pipeline.Pipeline
+}
+
+// runSplit backs up every database on the server as its own backup, after
+// the server-wide globals if the engine has any, or every shard of a Redis
+// Cluster. Each backup gets its own retention and notification, and
+// records serverVersion in its manifest. It returns the total size
+// uploaded, the number of backups attempted, and an error if any of them
+// failed.
+func runSplit(ctx context.Context, cfg *config.Config, eng engine.Engine, pipe pipeline.Pipeline, backupID, serverVersion string, log zerolog.Logger) (int64, int, error) {
+	var (
+		targets []splitTarget
+		err     error
+	)
+	if cfg.RedisCluster {
+		targets, err = shardTargets(cfg, eng, pipe, log)
+	} else {
+		targets, err = databaseTargets(cfg, eng, pipe, log)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var (
+		total  int64
+		failed []string
+	)
+	for _, t := range targets {
+		size, err := backupDatabase(ctx, t.cfg, t.eng, t.pipe, backupID, serverVersion)
+		total += size
+		if err != nil {
+			failed = append(failed, t.cfg.DBName)
+		}
+	}
+	if len(failed) > 0 {
+		return total, len(targets), fmt.Errorf("%d of %d backups failed: %s", len(failed), len(targets), strings.Join(failed, ", "))
+	}
+	return total, len(targets), nil
+}
+
+// databaseTargets lists the databases of a BACKUP_SPLIT_DATABASES run
+// that pass the filters, preceded by the globals if the engine has any.
+func databaseTargets(cfg *config.Config, eng engine.Engine, pipe pipeline.Pipeline, log zerolog.Logger) ([]splitTarget, error) {
+	lister, ok := eng.(engine.DatabaseLister)
+	if !ok {
+		return nil, fmt.Errorf("BACKUP_SPLIT_DATABASES is not supported for %s", eng.Name())
+	}
+	all, err := listDatabases(cfg, lister)
+	if err != nil {
+		return nil, err
+	}
+	var dbs []string
+	for _, db := range all {
+		if cfg.IncludesDatabase(db) {
+			dbs = append(dbs, db)
+		}
+	}
+	if len(dbs) == 0 {
+		return nil, fmt.Errorf("BACKUP_INCLUDE and BACKUP_EXCLUDE leave none of the %d databases", len(all))
+	}
+	log.Info().Strs("databases", dbs).Msg("backing up databases separately")
+
+	var targets []splitTarget
+	globals, err := lister.GlobalsCommand(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if globals != nil {
+		// Globals are a small plain SQL file whatever the mode
+		g := cfg.ForDatabase(globalsName)
+		g.BackupMode = "stream"
+		g.BackupCompress = false
+		g.BackupExtension = ""
+		g.BackupBinlogPosition = false
+		targets = append(targets, splitTarget{g, &globalsEngine{Engine: eng, cmd: globals}, &pipeline.StreamPipeline{}})
+	}
+	for _, db := range dbs {
+		targets = append(targets, splitTarget{cfg.ForDatabase(db), eng, pipe})
+	}
+	return targets, nil
+}
+
+// shardTargets lists the master shards of a REDIS_CLUSTER run.
+func shardTargets(cfg *config.Config, eng engine.Engine, pipe pipeline.Pipeline, log zerolog.Logger) ([]splitTarget, error) {
+	lister, ok := eng.(engine.ShardLister)
+	if !ok {
+		return nil, fmt.Errorf("REDIS_CLUSTER is not supported for %s", eng.Name())
+	}
+	shards, err := lister.ListShards(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("listing cluster shards: %w", err)
+	}
+
+	var targets []splitTarget
+	names := make([]string, len(shards))
+	for i, shard := range shards {
+		names[i] = shard.Name + "@" + shard.Addr
+		targets = append(targets, splitTarget{cfg.ForShard(shard.Name, shard.Addr), eng, pipe})
+	}
+	log.Info().Strs("shards", names).Msg("backing up cluster shards separately")
+	return targets, nil
+}
+
+// backupDatabase runs the pipeline for one database (or shard) of a
+// split backup, then applies retention to that database's backups and
+// sends its notification per NOTIFY_ON.
+func backupDatabase(ctx context.Context, cfg *config.Config, eng engine.Engine, pipe pipeline.Pipeline, backupID, serverVersion string) (int64, error) {
+	db := cfg.DBNameOrDefault()
+	log := logger.With(eng.Name(), db, backupID)
+	start := time.Now()
+
+	m := newManifest(backupID, cfg, eng, start)
+	m.ServerVersion = serverVersion
+	remotePath, fileSize, err := pipe.Execute(ctx, eng, cfg, m)
+	result := notify.Result{
+		Status:     "success",
+		Engine:     eng.Name(),
+		Database:   db,
+		RemotePath: remotePath,
+		FileSize:   fileSize,
+		Duration:   time.Since(start),
+	}
+	if err != nil {
+		result.Status = "failure"
+		result.Error = err.Error()
+		log.Error().Err(err).Msg("database backup failed")
+	} else {
+		log.Info().
+			Str("remote_path", remotePath).
+			Int64("file_size", fileSize).
+			Dur("duration", result.Duration).
+			Msg("database backup completed")
+
+		// Only this database's backups count towards its retention
+		if matcher, err := catalog.NewMatcher(cfg, eng); err != nil {
+			log.Warn().Err(err).Msg("retention cleanup failed")
+		} else {
+			deleted, err := retention.RunMatching(ctx, cfg, func(re retention.RemoteEntry) bool {
+				entry, ok := matcher.Match(re)
+				return ok && entry.Database == db
+			})
+			if err != nil {
+				log.Warn().Err(err).Msg("retention cleanup failed")
+			} else if deleted > 0 {
+				log.Info().Int("deleted", deleted).Msg("retention cleanup completed")
+			}
+		}
+	}
+
+	notify.Send(ctx, cfg.NotifyWebhookURL, cfg.NotifyOn, result)
+	return fileSize, err
+}
+
+// listDatabases returns the databases the engine reports, in its order.
+func listDatabases(cfg *config.Config, lister engine.DatabaseLister) ([]string, error) {
+	cmd, err := lister.ListDatabasesCommand(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer engine.Cleanup(cmd)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("listing databases: %w (stderr: %s)", err, stderr.String())
+	}
+
+	var dbs []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if name := strings.TrimSpace(line); name != "" {
+			dbs = append(dbs, name)
+		}
+	}
+	if len(dbs) == 0 {
+		return nil, fmt.Errorf("no databases found on the server")
+	}
+	return dbs, nil
+}
+
+// globalsEngine runs an engine's globals dump through the stream pipeline
+// in place of a database dump.
+type globalsEngine struct {
+	engine.Engine
+	cmd *exec.Cmd
+}
+
+func (g *globalsEngine) DumpCommand(_ *config.Config, _ string, _ string) (*exec.Cmd, error) {
+	return g.cmd, nil
+}
+
+// DefaultExtension returns ".sql": globals are always plain SQL.
+func (g *globalsEngine) DefaultExtension(_ *config.Config, _ string, _ bool) string {
+	return ".sql"
+}
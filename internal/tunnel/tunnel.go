@@ -0,0 +1,267 @@
+// Package tunnel forwards database connections through an SSH bastion.
+package tunnel
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/logger"
+)
+
+// defaultPorts are the ports the engines connect to when none is set.
+var defaultPorts = map[string]string{
+	"pg":      "5432",
+	"mysql":   "3306",
+	"mariadb": "3306",
+	"mongo":   "27017",
+	"redis":   "6379",
+}
+
+// Tunnel listens on a local port and forwards each connection through the
+// bastion to the database. A dropped SSH connection is re-established on
+// the next connection.
+type Tunnel struct {
+	bastion  string
+	target   string
+	config   *ssh.ClientConfig
+	listener net.Listener
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+// Open connects to DB_SSH_HOST and starts forwarding from a random port on
+// 127.0.0.1 to the configured database. It returns a copy of cfg that
+// connects through the tunnel. Without DB_SSH_HOST it returns a nil Tunnel
+// and cfg unchanged.
+func Open(cfg *config.Config) (*Tunnel, *config.Config, error) {
+	if cfg.DBSSHHost == "" {
+		return nil, cfg, nil
+	}
+	target, err := targetAddr(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	sshConfig, err := clientConfig(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bastion := cfg.DBSSHHost
+	if _, _, err := net.SplitHostPort(bastion); err != nil {
+		bastion = net.JoinHostPort(bastion, "22")
+	}
+	t := &Tunnel{bastion: bastion, target: target, config: sshConfig}
+	if _, err := t.sshClient(); err != nil {
+		return nil, nil, err
+	}
+
+	t.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.client.Close()
+		return nil, nil, fmt.Errorf("listening for the SSH tunnel: %w", err)
+	}
+	tunneled, err := throughTunnel(cfg, t.listener.Addr().(*net.TCPAddr).Port)
+	if err != nil {
+		t.Close()
+		return nil, nil, err
+	}
+	go t.serve()
+
+	logger.Log.Info().Str("bastion", bastion).Str("target", target).Str("local", t.listener.Addr().String()).Msg("SSH tunnel opened")
+	return t, tunneled, nil
+}
+
+// Close stops forwarding and closes the SSH connection. It is safe to call
+// on a nil Tunnel.
+func (t *Tunnel) Close() error {
+	if t == nil {
+		return nil
+	}
+	err := t.listener.Close()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client != nil {
+		t.client.Close()
+		t.client = nil
+	}
+	return err
+}
+
+// serve accepts local connections until the listener is closed.
+func (t *Tunnel) serve() {
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		go t.forward(local)
+	}
+}
+
+// forward copies one local connection to the database and back.
+func (t *Tunnel) forward(local net.Conn) {
+	defer local.Close()
+	remote, err := t.dial()
+	if err != nil {
+		logger.Log.Warn().Err(err).Str("target", t.target).Msg("SSH tunnel could not reach the database")
+		return
+	}
+	defer remote.Close()
+
+	// The database may still be answering after the client has finished
+	// sending, so each direction only half-closes its destination when its
+	// source ends, and the connection lasts until both have finished
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		copyHalf(remote, local)
+	}()
+	go func() {
+		defer wg.Done()
+		copyHalf(local, remote)
+	}()
+	wg.Wait()
+}
+
+// copyHalf copies src to dst and then closes dst for writing: CloseWrite
+// on a TCP connection or an SSH channel, Close on anything else. If the
+// copy fails, both are closed so the other direction stops too.
+func copyHalf(dst, src net.Conn) {
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		src.Close()
+		return
+	}
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+		return
+	}
+	dst.Close()
+}
+
+// dial opens a connection to the database from the bastion. If the SSH
+// connection has dropped, it reconnects to the bastion once.
+func (t *Tunnel) dial() (net.Conn, error) {
+	client, err := t.sshClient()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.Dial("tcp", t.target)
+	if err == nil {
+		return conn, nil
+	}
+	if _, _, alive := client.SendRequest("keepalive@openssh.com", true, nil); alive == nil {
+		return nil, fmt.Errorf("connecting to %s through %s: %w", t.target, t.bastion, err)
+	}
+
+	t.mu.Lock()
+	if t.client == client {
+		t.client.Close()
+		t.client = nil
+	}
+	t.mu.Unlock()
+	if client, err = t.sshClient(); err != nil {
+		return nil, err
+	}
+	conn, err = client.Dial("tcp", t.target)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s through %s: %w", t.target, t.bastion, err)
+	}
+	return conn, nil
+}
+
+// sshClient returns the SSH connection to the bastion, connecting if
+// there is none.
+func (t *Tunnel) sshClient() (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client != nil {
+		return t.client, nil
+	}
+	client, err := ssh.Dial("tcp", t.bastion, t.config)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to SSH bastion %s: %w", t.bastion, err)
+	}
+	t.client = client
+	return client, nil
+}
+
+// clientConfig authenticates with the DB_SSH_KEY private key and
+// checks the bastion's host key against DB_SSH_KNOWN_HOSTS_FILE.
+func clientConfig(cfg *config.Config) (*ssh.ClientConfig, error) {
+	signer, err := ssh.ParsePrivateKey([]byte(cfg.DBSSHKey))
+	if err != nil {
+		return nil, fmt.Errorf("parsing DB_SSH_KEY: %w", err)
+	}
+
+	knownHostsFile := cfg.DBSSHKnownHostsFile
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("finding known_hosts: %w", err)
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeys, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading DB_SSH_KNOWN_HOSTS_FILE: %w", err)
+	}
+
+	return &ssh.ClientConfig{
+		User:            cfg.DBSSHUser,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeys,
+		Timeout:         30 * time.Second,
+	}, nil
+}
+
+// targetAddr returns the host:port of the database, as seen from the
+// bastion.
+func targetAddr(cfg *config.Config) (string, error) {
+	host, port := cfg.DBHost, cfg.DBPort
+	if cfg.DBURI != "" {
+		u, err := url.Parse(cfg.DBURI)
+		if err != nil || strings.Contains(u.Host, ",") || strings.HasSuffix(u.Scheme, "+srv") {
+			return "", fmt.Errorf("DB_SSH_HOST needs DB_URI to name a single host")
+		}
+		host, port = u.Hostname(), u.Port()
+	}
+	if host == "" {
+		return "", fmt.Errorf("DB_SSH_HOST needs the database host in DB_URI or DB_HOST")
+	}
+	if port == "" {
+		port = defaultPorts[cfg.Engine]
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// throughTunnel returns a copy of cfg that connects to 127.0.0.1:port.
+func throughTunnel(cfg *config.Config, port int) (*config.Config, error) {
+	tunneled := *cfg
+	local := fmt.Sprintf("127.0.0.1:%d", port)
+	if cfg.DBURI != "" {
+		u, err := url.Parse(cfg.DBURI)
+		if err != nil {
+			return nil, fmt.Errorf("parsing DB_URI: %w", err)
+		}
+		u.Host = local
+		tunneled.DBURI = u.String()
+	} else {
+		tunneled.DBHost = "127.0.0.1"
+		tunneled.DBPort = fmt.Sprint(port)
+	}
+	return &tunneled, nil
+}
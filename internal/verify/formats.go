@@ -0,0 +1,369 @@
+package verify
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/viperadnan-git/dbstash/internal/compress"
+)
+
+// Trailers the dump tools write as the last comment of a complete plain
+// SQL dump.
+var (
+	pgTrailers     = []string{"-- PostgreSQL database dump complete", "-- PostgreSQL database cluster dump complete"}
+	mysqlTrailers  = []string{"-- Dump completed"}
+	sqliteTrailers = []string{"COMMIT;"}
+)
+
+// sqliteHeader starts every SQLite database file.
+const sqliteHeader = "SQLite format 3\x00"
+
+// xbstreamMagic starts every chunk of an xtrabackup/mariabackup xbstream.
+const xbstreamMagic = "XBSTCK01"
+
+// mongoArchiveMagic starts every mongodump --archive stream (little endian).
+const mongoArchiveMagic = 0x8199e26d
+
+// tailSize is how much of the end of a SQL dump is searched for the trailer.
+const tailSize = 4096
+
+// checkStream runs the validators for a single-object backup and returns
+// the names of the checks that passed. A gzip, zstd, or xz layer is
+// detected by its magic bytes and unwrapped first.
+func checkStream(ctx context.Context, engineName, mode string, br *bufio.Reader) ([]string, error) {
+	var checks []string
+
+	head, _ := br.Peek(compress.MagicSize)
+	if alg := compress.Detect(head); alg != "" {
+		zr, err := compress.NewReader(br, alg)
+		if err != nil {
+			return checks, fmt.Errorf("invalid %s header: %w", alg, err)
+		}
+		defer zr.Close()
+		inner := bufio.NewReader(zr)
+		innerChecks, err := checkContent(ctx, engineName, mode, inner)
+		if err != nil {
+			return checks, err
+		}
+		// Reading to the end makes the decompressor verify its checksum
+		if _, err := io.Copy(io.Discard, inner); err != nil {
+			return checks, fmt.Errorf("%s stream is corrupt: %w", alg, err)
+		}
+		checks = append(checks, alg)
+		return append(checks, innerChecks...), nil
+	}
+
+	return checkContent(ctx, engineName, mode, br)
+}
+
+// checkContent validates uncompressed backup content.
+func checkContent(ctx context.Context, engineName, mode string, br *bufio.Reader) ([]string, error) {
+	if mode == "tar" {
+		if err := checkTar(br); err != nil {
+			return nil, err
+		}
+		return []string{"tar"}, nil
+	}
+
+	switch engineName {
+	case "pg":
+		if head, _ := br.Peek(5); string(head) == "PGDMP" {
+			if err := pgRestoreList(ctx, br, ""); err != nil {
+				return nil, err
+			}
+			return []string{"pg_restore --list"}, nil
+		}
+		if err := checkSQLTrailer(br, pgTrailers); err != nil {
+			return nil, err
+		}
+		return []string{"sql trailer"}, nil
+	case "mysql", "mariadb":
+		if head, _ := br.Peek(len(xbstreamMagic)); string(head) == xbstreamMagic {
+			if err := checkXBStream(br); err != nil {
+				return nil, err
+			}
+			return []string{"xbstream checksums"}, nil
+		}
+		if err := checkSQLTrailer(br, mysqlTrailers); err != nil {
+			return nil, fmt.Errorf("%w (dumps taken with --skip-comments have no trailer)", err)
+		}
+		return []string{"sql trailer"}, nil
+	case "mongo":
+		if err := checkMongoArchive(br); err != nil {
+			return nil, err
+		}
+		return []string{"archive header"}, nil
+	case "redis":
+		if err := checkRDB(br); err != nil {
+			return nil, err
+		}
+		return []string{"rdb checksum"}, nil
+	case "sqlite":
+		if mode == "file" {
+			if head, _ := br.Peek(len(sqliteHeader)); string(head) != sqliteHeader {
+				return nil, fmt.Errorf("not an SQLite database (missing header)")
+			}
+			return []string{"sqlite header"}, nil
+		}
+		if err := checkSQLTrailer(br, sqliteTrailers); err != nil {
+			return nil, err
+		}
+		return []string{"sql trailer"}, nil
+	}
+	return nil, nil
+}
+
+// checkGzip reads a gzip stream to the end, which verifies its checksum.
+func checkGzip(r io.Reader) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("invalid gzip header: %w", err)
+	}
+	if _, err := io.Copy(io.Discard, zr); err != nil {
+		return fmt.Errorf("gzip stream is corrupt: %w", err)
+	}
+	return nil
+}
+
+// checkTar walks every entry of a tar stream. Members ending in .gz are
+// checked for gzip integrity as well.
+func checkTar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	var entries int
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("tar archive is corrupt after %d entries: %w", entries, err)
+		}
+		entries++
+		if strings.HasSuffix(hdr.Name, ".gz") && hdr.Typeflag == tar.TypeReg {
+			if err := checkGzip(tr); err != nil {
+				return fmt.Errorf("%s: %w", hdr.Name, err)
+			}
+			continue
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return fmt.Errorf("reading %s: %w", hdr.Name, err)
+		}
+	}
+	if entries == 0 {
+		return fmt.Errorf("tar archive is empty")
+	}
+	return nil
+}
+
+// checkSQLTrailer reads a plain SQL dump to the end and checks that one of
+// the trailers appears near the end. A dump that was cut short never
+// gets one.
+func checkSQLTrailer(r io.Reader, trailers []string) error {
+	tail, err := readTail(r, tailSize)
+	if err != nil {
+		return fmt.Errorf("reading dump: %w", err)
+	}
+	if len(tail) == 0 {
+		return fmt.Errorf("dump is empty")
+	}
+	for _, t := range trailers {
+		if bytes.Contains(tail, []byte(t)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("dump has no %q trailer; it is probably truncated", trailers[0])
+}
+
+// readTail reads r to the end and returns its last n bytes.
+func readTail(r io.Reader, n int) ([]byte, error) {
+	buf := make([]byte, 0, 2*n)
+	chunk := make([]byte, 32*1024)
+	for {
+		k, err := r.Read(chunk)
+		buf = append(buf, chunk[:k]...)
+		if len(buf) > n {
+			buf = append(buf[:0], buf[len(buf)-n:]...)
+		}
+		if err == io.EOF {
+			return buf, nil
+		}
+		if err != nil {
+			return buf, err
+		}
+	}
+}
+
+// checkMongoArchive checks the magic number that starts a mongodump
+// archive. The archive body has no checksum of its own.
+func checkMongoArchive(r io.Reader) error {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return fmt.Errorf("reading archive header: %w", err)
+	}
+	if got := binary.LittleEndian.Uint32(magic[:]); got != mongoArchiveMagic {
+		return fmt.Errorf("not a mongodump archive (magic %#08x, want %#08x)", got, mongoArchiveMagic)
+	}
+	return nil
+}
+
+// checkXBStream walks the chunks of an xbstream, checking the CRC-32 of
+// each payload and that every file it starts is closed by an EOF chunk,
+// which a truncated stream lacks.
+func checkXBStream(r io.Reader) error {
+	open := map[string]bool{}
+	files := 0
+	header := make([]byte, len(xbstreamMagic)+6)
+	for {
+		if _, err := io.ReadFull(r, header); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("xbstream is truncated: %w", err)
+		}
+		if string(header[:len(xbstreamMagic)]) != xbstreamMagic {
+			return fmt.Errorf("xbstream chunk has no %s magic", xbstreamMagic)
+		}
+		chunkType := header[len(xbstreamMagic)+1]
+		path := make([]byte, binary.LittleEndian.Uint32(header[len(xbstreamMagic)+2:]))
+		if _, err := io.ReadFull(r, path); err != nil {
+			return fmt.Errorf("xbstream is truncated: %w", err)
+		}
+
+		var sparseEntries uint32
+		switch chunkType {
+		case 'E':
+			delete(open, string(path))
+			continue
+		case 'P':
+		case 'S':
+			var n [4]byte
+			if _, err := io.ReadFull(r, n[:]); err != nil {
+				return fmt.Errorf("xbstream is truncated: %w", err)
+			}
+			sparseEntries = binary.LittleEndian.Uint32(n[:])
+		default:
+			return fmt.Errorf("xbstream chunk for %s has unknown type %q", path, chunkType)
+		}
+
+		// Payload length, offset, and checksum, then the sparse map
+		fields := make([]byte, 20+8*int(sparseEntries))
+		if _, err := io.ReadFull(r, fields); err != nil {
+			return fmt.Errorf("xbstream is truncated: %w", err)
+		}
+		length := binary.LittleEndian.Uint64(fields)
+		sum := crc32.NewIEEE()
+		if _, err := io.CopyN(sum, r, int64(length)); err != nil {
+			return fmt.Errorf("xbstream is truncated in %s: %w", path, err)
+		}
+		if want := binary.LittleEndian.Uint32(fields[16:]); chunkType == 'P' && sum.Sum32() != want {
+			return fmt.Errorf("xbstream checksum mismatch in %s (got %08x, want %08x)", path, sum.Sum32(), want)
+		}
+		if !open[string(path)] {
+			open[string(path)] = true
+			files++
+		}
+	}
+
+	if files == 0 {
+		return fmt.Errorf("xbstream has no files")
+	}
+	for path := range open {
+		return fmt.Errorf("xbstream ends before the end of %s; it is probably truncated", path)
+	}
+	return nil
+}
+
+// crc64Jones is the CRC-64 variant Redis uses for RDB checksums. The
+// polynomial is given in reversed form as hash/crc64 expects.
+var crc64Jones = crc64.MakeTable(0x95ac9329ac4bc9b5)
+
+// rdbCRC64 continues a Redis CRC-64 over p. hash/crc64 inverts the value
+// on the way in and out; Redis does neither.
+func rdbCRC64(crc uint64, p []byte) uint64 {
+	return ^crc64.Update(^crc, crc64Jones, p)
+}
+
+// checkRDB checks the REDIS magic and version of an RDB file, that it ends
+// with the EOF opcode, and its trailing CRC-64 (RDB version 5 and later).
+// A zero checksum means the server ran with rdbchecksum no.
+func checkRDB(r io.Reader) error {
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("reading RDB header: %w", err)
+	}
+	if string(header[:5]) != "REDIS" {
+		return fmt.Errorf("not an RDB file (missing REDIS magic)")
+	}
+	version, err := strconv.Atoi(string(header[5:]))
+	if err != nil {
+		return fmt.Errorf("invalid RDB version %q", header[5:])
+	}
+
+	trailer := 0
+	if version >= 5 {
+		trailer = 8
+	}
+
+	// Hold back the trailer so it is not fed into the checksum
+	crc := rdbCRC64(0, header)
+	var pending []byte
+	var last byte
+	chunk := make([]byte, 32*1024)
+	for {
+		k, err := r.Read(chunk)
+		pending = append(pending, chunk[:k]...)
+		if len(pending) > trailer {
+			body := pending[:len(pending)-trailer]
+			crc = rdbCRC64(crc, body)
+			last = body[len(body)-1]
+			pending = append(pending[:0], pending[len(pending)-trailer:]...)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading RDB: %w", err)
+		}
+	}
+
+	if len(pending) < trailer || last != 0xff {
+		return fmt.Errorf("RDB file is truncated (no EOF marker)")
+	}
+	if trailer == 0 {
+		return nil
+	}
+	stored := binary.LittleEndian.Uint64(pending)
+	if stored != 0 && stored != crc {
+		return fmt.Errorf("RDB checksum mismatch: stored %016x, computed %016x", stored, crc)
+	}
+	return nil
+}
+
+// pgRestoreList runs pg_restore --list, which parses the archive's table
+// of contents. It reads a custom-format archive from stdin, or a
+// directory-format dump from dir.
+func pgRestoreList(ctx context.Context, stdin io.Reader, dir string) error {
+	args := []string{"--list"}
+	if dir != "" {
+		args = append(args, "--format=directory", dir)
+	}
+	cmd := exec.CommandContext(ctx, "pg_restore", args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = io.Discard
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pg_restore --list failed: %w (stderr: %s)", err, stderr.String())
+	}
+	return nil
+}
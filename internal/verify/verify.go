@@ -0,0 +1,226 @@
+// Package verify downloads a backup from the rclone remote and checks that
+// it is structurally intact, without restoring it.
+package verify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/viperadnan-git/dbstash/internal/catalog"
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/engine"
+	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/manifest"
+	"github.com/viperadnan-git/dbstash/internal/pipeline"
+	"github.com/viperadnan-git/dbstash/internal/restore"
+)
+
+// Result describes a verified backup.
+type Result struct {
+	RemotePath string
+	Mode       string
+	Size       int64    // bytes downloaded
+	Checks     []string // checks that passed, in order
+}
+
+// Run verifies the backup named by from (a name relative to RCLONE_REMOTE
+// or a full rclone path), or the newest backup in the catalog if from is
+// empty. The returned Result is non-nil whenever the backup was located,
+// so callers can report what failed.
+func Run(ctx context.Context, cfg *config.Config, eng engine.Engine, from string) (*Result, error) {
+	if from == "" {
+		entries, err := catalog.List(ctx, cfg, eng)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			return nil, fmt.Errorf("no backups found on %s", cfg.RcloneRemote)
+		}
+		from = entries[0].Name
+	}
+
+	res := &Result{RemotePath: restore.RemotePath(cfg, from)}
+
+	m, err := manifest.Fetch(ctx, res.RemotePath, pipeline.RcloneConfigArgs(cfg))
+	physical := cfg.BackupMethod == "physical"
+	if err != nil {
+		logger.Log.Debug().Err(err).Msg("no manifest found, inferring format from name")
+		m = nil
+		res.Mode, _, _ = restore.InferFormat(ctx, cfg, eng, res.RemotePath)
+	} else {
+		res.Mode = m.Mode
+		physical = m.Method == "physical"
+	}
+
+	// A physical pg backup is a tar archive of the data directory; a
+	// physical mysql backup is an xbstream, checked like a stream dump
+	if physical && eng.Name() == "pg" {
+		res.Mode = "tar"
+	}
+
+	if res.Mode == "directory" {
+		return res, verifyDirectory(ctx, cfg, eng, m, res)
+	}
+	return res, verifyFile(ctx, cfg, eng, m, res)
+}
+
+// verifyFile streams a single-object backup through rclone cat, hashing it
+// and feeding it to the format validators in one pass.
+func verifyFile(ctx context.Context, cfg *config.Config, eng engine.Engine, m *manifest.Manifest, res *Result) error {
+	args := []string{"cat", res.RemotePath}
+	args = append(args, pipeline.RcloneConfigArgs(cfg)...)
+	rcloneCmd := exec.CommandContext(ctx, "rclone", args...)
+	var rcloneStderr bytes.Buffer
+	rcloneCmd.Stderr = &rcloneStderr
+
+	stdout, err := rcloneCmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("creating rclone pipe: %w", err)
+	}
+	if err := rcloneCmd.Start(); err != nil {
+		return fmt.Errorf("starting rclone: %w", err)
+	}
+
+	hash := sha256.New()
+	counter := &countWriter{}
+	br := bufio.NewReader(io.TeeReader(stdout, io.MultiWriter(hash, counter)))
+
+	checks, checkErr := checkStream(ctx, eng.Name(), res.Mode, br)
+
+	// Drain whatever the validators did not read so the digest covers
+	// the whole object
+	_, drainErr := io.Copy(io.Discard, br)
+	rcloneErr := rcloneCmd.Wait()
+	res.Size = counter.n
+
+	if rcloneErr != nil {
+		return fmt.Errorf("rclone cat failed: %w (stderr: %s)", rcloneErr, rcloneStderr.String())
+	}
+	if drainErr != nil {
+		return fmt.Errorf("reading backup: %w", drainErr)
+	}
+
+	if m != nil && m.SHA256 != "" {
+		if got := hex.EncodeToString(hash.Sum(nil)); got != m.SHA256 {
+			return fmt.Errorf("sha256 mismatch: manifest %s, downloaded %s", m.SHA256, got)
+		}
+		res.Checks = append(res.Checks, "sha256")
+	}
+
+	res.Checks = append(res.Checks, checks...)
+	return checkErr
+}
+
+// verifyDirectory downloads a directory backup into a temp directory under
+// BACKUP_TEMP_DIR and checks every file in it.
+func verifyDirectory(ctx context.Context, cfg *config.Config, eng engine.Engine, m *manifest.Manifest, res *Result) error {
+	tempDir, err := os.MkdirTemp(cfg.BackupTempDir, "dbstash-verify-")
+	if err != nil {
+		os.MkdirAll(cfg.BackupTempDir, 0o755)
+		tempDir, err = os.MkdirTemp(cfg.BackupTempDir, "dbstash-verify-")
+		if err != nil {
+			return fmt.Errorf("creating temp dir: %w", err)
+		}
+	}
+	defer os.RemoveAll(tempDir)
+
+	args := []string{"copy", res.RemotePath, tempDir}
+	args = append(args, pipeline.RcloneConfigArgs(cfg)...)
+	cmd := exec.CommandContext(ctx, "rclone", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("rclone copy failed: %w (stderr: %s)", err, stderr.String())
+	}
+
+	// Checksums of every file recorded in the manifest
+	if m != nil && len(m.Files) > 0 {
+		for _, f := range m.Files {
+			got, err := hashFile(filepath.Join(tempDir, filepath.FromSlash(f.Path)))
+			if err != nil {
+				return fmt.Errorf("hashing %s: %w", f.Path, err)
+			}
+			if got != f.SHA256 {
+				return fmt.Errorf("sha256 mismatch for %s: manifest %s, downloaded %s", f.Path, f.SHA256, got)
+			}
+		}
+		res.Checks = append(res.Checks, "sha256")
+	}
+
+	// Gzip integrity of compressed members
+	var gzipped int
+	err = filepath.WalkDir(tempDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		res.Size += info.Size()
+		if !strings.HasSuffix(path, ".gz") {
+			return nil
+		}
+		gzipped++
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := checkGzip(f); err != nil {
+			rel, _ := filepath.Rel(tempDir, path)
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if res.Size == 0 {
+		return fmt.Errorf("backup directory is empty")
+	}
+	if gzipped > 0 {
+		res.Checks = append(res.Checks, "gzip")
+	}
+
+	if eng.Name() == "pg" {
+		if err := pgRestoreList(ctx, nil, tempDir); err != nil {
+			return err
+		}
+		res.Checks = append(res.Checks, "pg_restore --list")
+	}
+	return nil
+}
+
+// hashFile returns the hex SHA-256 of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// countWriter counts the bytes written to it.
+type countWriter struct{ n int64 }
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,211 @@
+package verify
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+	"testing"
+
+	"github.com/viperadnan-git/dbstash/internal/compress"
+)
+
+func TestRDBCRC64_CheckValue(t *testing.T) {
+	// Reference value from Redis' crc64.c self-test
+	if got := rdbCRC64(0, []byte("123456789")); got != 0xe9c6d914c4b8d9ca {
+		t.Errorf("expected e9c6d914c4b8d9ca, got %016x", got)
+	}
+}
+
+func buildRDB(version string, body []byte) []byte {
+	data := append([]byte("REDIS"+version), body...)
+	data = append(data, 0xff)
+	sum := make([]byte, 8)
+	binary.LittleEndian.PutUint64(sum, rdbCRC64(0, data))
+	return append(data, sum...)
+}
+
+func TestCheckRDB(t *testing.T) {
+	valid := buildRDB("0011", []byte{0xfa, 0x05, 'h', 'e', 'l', 'l', 'o'})
+
+	corrupt := append([]byte(nil), valid...)
+	corrupt[10] ^= 0x01
+
+	noChecksum := append([]byte(nil), valid...)
+	copy(noChecksum[len(noChecksum)-8:], make([]byte, 8))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"valid", valid, false},
+		{"checksum disabled", noChecksum, false},
+		{"corrupt body", corrupt, true},
+		{"truncated", valid[:len(valid)-12], true},
+		{"bad magic", append([]byte("RADIS"), valid[5:]...), true},
+		{"old version without checksum", append([]byte("REDIS0004\xfe\x00"), 0xff), false},
+		{"empty", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkRDB(bytes.NewReader(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkRDB() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckSQLTrailer(t *testing.T) {
+	complete := "SET x = 1;\n" + strings.Repeat("INSERT INTO t VALUES (1);\n", 1000) +
+		"\n--\n-- PostgreSQL database dump complete\n--\n\n"
+
+	if err := checkSQLTrailer(strings.NewReader(complete), pgTrailers); err != nil {
+		t.Errorf("expected complete dump to pass, got %v", err)
+	}
+	if err := checkSQLTrailer(strings.NewReader(complete[:len(complete)-50]), pgTrailers); err == nil {
+		t.Error("expected truncated dump to fail")
+	}
+	if err := checkSQLTrailer(strings.NewReader("-- Dump completed on 2026-02-07  2:00:01\n"), mysqlTrailers); err != nil {
+		t.Errorf("expected mysqldump trailer to pass, got %v", err)
+	}
+	if err := checkSQLTrailer(strings.NewReader(""), pgTrailers); err == nil {
+		t.Error("expected empty dump to fail")
+	}
+}
+
+func TestCheckMongoArchive(t *testing.T) {
+	if err := checkMongoArchive(bytes.NewReader([]byte{0x6d, 0xe2, 0x99, 0x81, 0x00})); err != nil {
+		t.Errorf("expected valid header to pass, got %v", err)
+	}
+	if err := checkMongoArchive(bytes.NewReader([]byte("{\"a\":1}"))); err == nil {
+		t.Error("expected invalid header to fail")
+	}
+}
+
+// xbstreamChunk builds an xbstream payload chunk, or an EOF chunk if
+// payload is nil.
+func xbstreamChunk(path string, payload []byte, offset uint64) []byte {
+	var b bytes.Buffer
+	b.WriteString("XBSTCK01")
+	b.WriteByte(0)
+	if payload == nil {
+		b.WriteByte('E')
+	} else {
+		b.WriteByte('P')
+	}
+	binary.Write(&b, binary.LittleEndian, uint32(len(path)))
+	b.WriteString(path)
+	if payload != nil {
+		binary.Write(&b, binary.LittleEndian, uint64(len(payload)))
+		binary.Write(&b, binary.LittleEndian, offset)
+		binary.Write(&b, binary.LittleEndian, crc32.ChecksumIEEE(payload))
+		b.Write(payload)
+	}
+	return b.Bytes()
+}
+
+func TestCheckXBStream(t *testing.T) {
+	var stream []byte
+	stream = append(stream, xbstreamChunk("ibdata1", []byte("page one"), 0)...)
+	stream = append(stream, xbstreamChunk("ibdata1", []byte("page two"), 8)...)
+	stream = append(stream, xbstreamChunk("ibdata1", nil, 0)...)
+	stream = append(stream, xbstreamChunk("xtrabackup_checkpoints", []byte("to_lsn = 18245423\n"), 0)...)
+	stream = append(stream, xbstreamChunk("xtrabackup_checkpoints", nil, 0)...)
+
+	ctx := context.Background()
+	if _, err := checkContent(ctx, "mysql", "stream", bufio.NewReader(bytes.NewReader(stream))); err != nil {
+		t.Errorf("expected valid xbstream to pass, got %v", err)
+	}
+
+	// Cut before the last EOF chunk
+	truncated := stream[:len(stream)-len(xbstreamChunk("xtrabackup_checkpoints", nil, 0))]
+	if err := checkXBStream(bytes.NewReader(truncated)); err == nil {
+		t.Error("expected xbstream without the last EOF chunk to fail")
+	}
+
+	// Flip a byte of the first payload, which follows a 41-byte header
+	corrupt := append([]byte{}, stream...)
+	corrupt[43] ^= 0xff
+	if err := checkXBStream(bytes.NewReader(corrupt)); err == nil {
+		t.Error("expected corrupt payload to fail")
+	}
+}
+
+func TestCheckContent_SQLite(t *testing.T) {
+	ctx := context.Background()
+	file := bufio.NewReader(strings.NewReader("SQLite format 3\x00\x10\x00"))
+	if _, err := checkContent(ctx, "sqlite", "file", file); err != nil {
+		t.Errorf("expected database file to pass, got %v", err)
+	}
+	if _, err := checkContent(ctx, "sqlite", "file", bufio.NewReader(strings.NewReader("PRAGMA foreign_keys=OFF;"))); err == nil {
+		t.Error("expected SQL script in file mode to fail")
+	}
+	dump := "PRAGMA foreign_keys=OFF;\nBEGIN TRANSACTION;\nCREATE TABLE t(id int);\nCOMMIT;\n"
+	if _, err := checkContent(ctx, "sqlite", "stream", bufio.NewReader(strings.NewReader(dump))); err != nil {
+		t.Errorf("expected complete dump to pass, got %v", err)
+	}
+}
+
+func TestCheckStream_TarGzip(t *testing.T) {
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	content := []byte("toc")
+	tw.WriteHeader(&tar.Header{Name: "dump/toc.dat", Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+	tw.Write(content)
+	tw.Close()
+
+	var gzBuf bytes.Buffer
+	zw := gzip.NewWriter(&gzBuf)
+	zw.Write(tarBuf.Bytes())
+	zw.Close()
+	valid := gzBuf.Bytes()
+
+	checks, err := checkStream(context.Background(), "pg", "tar", bufio.NewReader(bytes.NewReader(valid)))
+	if err != nil {
+		t.Fatalf("expected valid tar.gz to pass, got %v", err)
+	}
+	if strings.Join(checks, ",") != "gzip,tar" {
+		t.Errorf("expected checks gzip,tar, got %v", checks)
+	}
+
+	// Flip a byte in the gzip CRC trailer
+	corrupt := append([]byte(nil), valid...)
+	corrupt[len(corrupt)-6] ^= 0xff
+	if _, err := checkStream(context.Background(), "pg", "tar", bufio.NewReader(bytes.NewReader(corrupt))); err == nil {
+		t.Error("expected corrupt gzip to fail")
+	}
+
+	if _, err := checkStream(context.Background(), "pg", "tar", bufio.NewReader(bytes.NewReader(tarBuf.Bytes()[:100]))); err == nil {
+		t.Error("expected truncated tar to fail")
+	}
+}
+
+func TestCheckStream_Zstd(t *testing.T) {
+	var buf bytes.Buffer
+	zw, err := compress.NewWriter(&buf, compress.Zstd, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw.Write([]byte("CREATE TABLE t (id int);\n-- Dump completed on 2026-02-07\n"))
+	zw.Close()
+
+	checks, err := checkStream(context.Background(), "mysql", "stream", bufio.NewReader(bytes.NewReader(buf.Bytes())))
+	if err != nil {
+		t.Fatalf("expected valid zstd dump to pass, got %v", err)
+	}
+	if strings.Join(checks, ",") != "zstd,sql trailer" {
+		t.Errorf("expected checks zstd,sql trailer, got %v", checks)
+	}
+
+	truncated := buf.Bytes()[:buf.Len()-4]
+	if _, err := checkStream(context.Background(), "mysql", "stream", bufio.NewReader(bytes.NewReader(truncated))); err == nil {
+		t.Error("expected truncated zstd to fail")
+	}
+}
@@ -0,0 +1,110 @@
+package wal
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/viperadnan-git/dbstash/internal/archive"
+	"github.com/viperadnan-git/dbstash/internal/catalog"
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/engine"
+	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/manifest"
+	"github.com/viperadnan-git/dbstash/internal/pipeline"
+	"github.com/viperadnan-git/dbstash/internal/restore"
+	"github.com/viperadnan-git/dbstash/internal/retention"
+)
+
+// Prune deletes the archived WAL that no retained base backup needs: every
+// segment before the start segment of the oldest physical backup still on
+// the remote. Timeline history files are always kept. It does nothing
+// unless retention is configured, and deletes nothing if the oldest
+// backup's manifest cannot be read. It returns the number of files deleted.
+func Prune(ctx context.Context, cfg *config.Config, eng engine.Engine) (int, error) {
+	if cfg.RetentionMaxFiles <= 0 && cfg.RetentionMaxDays <= 0 {
+		return 0, nil
+	}
+
+	walEntries, err := archive.List(ctx, cfg, retention.WALDir)
+	if err != nil || len(walEntries) == 0 {
+		return 0, err
+	}
+
+	oldest, err := oldestBaseBackup(ctx, cfg, eng)
+	if err != nil || oldest == nil {
+		return 0, err
+	}
+
+	cutoff, err := startSegment(oldest, segmentSize(walEntries))
+	if err != nil {
+		return 0, fmt.Errorf("oldest base backup %s: %w", oldest.Name, err)
+	}
+	logger.Log.Debug().Str("backup", oldest.Name).Str("cutoff", cutoff).Msg("pruning WAL before oldest base backup")
+
+	return archive.Delete(ctx, cfg, retention.WALDir, selectPrunable(walEntries, cutoff)), nil
+}
+
+// selectPrunable returns the WAL files that belong to segments before
+// cutoff.
+func selectPrunable(entries []retention.RemoteEntry, cutoff string) []retention.RemoteEntry {
+	var result []retention.RemoteEntry
+	for _, entry := range entries {
+		segment, ok := segmentPrefix(entry.Name)
+		if !ok {
+			continue
+		}
+		// Names sort by timeline, then position
+		if segment < cutoff {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// oldestBaseBackup returns the manifest of the oldest physical backup on
+// the remote, or nil if there is none. Logical backups are skipped. A
+// backup whose manifest cannot be read stops the search with an error,
+// since it may be a physical backup that still needs its WAL.
+func oldestBaseBackup(ctx context.Context, cfg *config.Config, eng engine.Engine) (*manifest.Manifest, error) {
+	entries, err := catalog.List(ctx, cfg, eng)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		remotePath := restore.RemotePath(cfg, entries[i].Name)
+		m, err := manifest.Fetch(ctx, remotePath, pipeline.RcloneConfigArgs(cfg))
+		if err != nil {
+			return nil, fmt.Errorf("reading manifest of %s, keeping all WAL: %w", entries[i].Name, err)
+		}
+		if m.Method == "physical" {
+			return m, nil
+		}
+	}
+	return nil, nil
+}
+
+// startSegment returns the name of the WAL segment a physical backup
+// starts in, from the LSN and timeline recorded in its manifest.
+func startSegment(m *manifest.Manifest, segSize int64) (string, error) {
+	lsn, err := ParseLSN(m.Metadata["start_lsn"])
+	if err != nil {
+		return "", fmt.Errorf("manifest has no start LSN: %w", err)
+	}
+	tli, err := strconv.ParseUint(m.Metadata["timeline"], 10, 32)
+	if err != nil {
+		return "", fmt.Errorf("manifest has no timeline: %w", err)
+	}
+	return SegmentName(uint32(tli), lsn, segSize), nil
+}
+
+// segmentSize returns the size of the archived segments, which is the
+// cluster's wal_segment_size, falling back to the PostgreSQL default.
+func segmentSize(entries []retention.RemoteEntry) int64 {
+	for _, entry := range entries {
+		if IsSegment(entry.Name) && entry.Size > 0 {
+			return entry.Size
+		}
+	}
+	return DefaultSegmentSize
+}
@@ -0,0 +1,169 @@
+package wal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/engine"
+	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/notify"
+)
+
+// pollInterval is how often the spool directory is checked for completed
+// segments.
+const pollInterval = 5 * time.Second
+
+// maxBackoff caps the delay before pg_receivewal is restarted.
+const maxBackoff = time.Minute
+
+// ReceiveOptions controls a WAL receiver.
+type ReceiveOptions struct {
+	// SpoolDir is where pg_receivewal writes segments before they are
+	// shipped. Keep it on a persistent volume so a restart resumes from
+	// the last segment.
+	SpoolDir string
+
+	// Slot is the replication slot to stream from, created if missing.
+	// Without a slot the server may recycle WAL the receiver has not seen.
+	Slot string
+}
+
+// Receive runs pg_receivewal until ctx is cancelled, shipping every
+// completed segment to the WAL directory on the remote. pg_receivewal is
+// restarted with a growing delay whenever it exits; each failure is sent
+// as a notification per NOTIFY_ON.
+func Receive(ctx context.Context, cfg *config.Config, opts ReceiveOptions) error {
+	if err := os.MkdirAll(opts.SpoolDir, 0o700); err != nil {
+		return fmt.Errorf("creating spool dir: %w", err)
+	}
+	pg := &engine.Postgres{}
+
+	if opts.Slot != "" {
+		cmd := pg.ReceiveWALCommand(cfg, opts.SpoolDir, opts.Slot, true)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("creating replication slot %s: %w (stderr: %s)", opts.Slot, err, stderr.String())
+		}
+	}
+
+	log := logger.Log.With().Str("spool_dir", opts.SpoolDir).Str("remote", RemoteDir(cfg)).Logger()
+	s := &shipper{cfg: cfg, dir: opts.SpoolDir}
+	backoff := pollInterval
+
+	for {
+		cmd := pg.ReceiveWALCommand(cfg, opts.SpoolDir, opts.Slot, false)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+
+		log.Info().Str("cmd", config.MaskCmdArgs(cmd.Args)).Msg("starting pg_receivewal")
+		started := time.Now()
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("starting pg_receivewal: %w", err)
+		}
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+
+		ticker := time.NewTicker(pollInterval)
+		var recvErr error
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				// pg_receivewal flushes and exits on SIGINT; ship what it
+				// completed before returning
+				cmd.Process.Signal(os.Interrupt)
+				<-done
+				ticker.Stop()
+				s.ship(context.WithoutCancel(ctx))
+				return nil
+			case recvErr = <-done:
+				break wait
+			case <-ticker.C:
+				s.ship(ctx)
+			}
+		}
+		ticker.Stop()
+		s.ship(ctx)
+
+		err := fmt.Errorf("pg_receivewal exited: %v (stderr: %s)", recvErr, strings.TrimSpace(stderr.String()))
+		log.Error().Err(err).Dur("restart_in", backoff).Msg("WAL receiver stopped")
+		notify.Send(ctx, cfg.NotifyWebhookURL, cfg.NotifyOn, notify.Result{
+			Operation:  "wal",
+			Status:     "failure",
+			Engine:     "pg",
+			Database:   cfg.DBNameOrDefault(),
+			RemotePath: RemoteDir(cfg),
+			Duration:   time.Since(started),
+			Error:      err.Error(),
+		})
+
+		// A receiver that ran for a while was healthy; start over
+		if time.Since(started) > maxBackoff {
+			backoff = pollInterval
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// shipper uploads completed segments from the spool directory.
+type shipper struct {
+	cfg *config.Config
+	dir string
+
+	// newest is the most recently shipped segment. It is left in the spool
+	// directory because pg_receivewal resumes after the newest segment it
+	// finds there.
+	newest string
+}
+
+// ship pushes every completed file in the spool directory, oldest first.
+// Shipped files are removed, except the newest segment. Failures are
+// logged and retried on the next call.
+func (s *shipper) ship(ctx context.Context) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		logger.Log.Warn().Err(err).Str("spool_dir", s.dir).Msg("failed to read spool dir")
+		return
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasSuffix(name, ".partial") || name == s.newest {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := filepath.Join(s.dir, name)
+		if err := Push(ctx, s.cfg, path); err != nil {
+			logger.Log.Warn().Err(err).Str("wal_file", name).Msg("failed to ship WAL file")
+			return
+		}
+		logger.Log.Info().Str("wal_file", name).Msg("shipped WAL file")
+
+		if !IsSegment(name) {
+			os.Remove(path)
+			continue
+		}
+		if s.newest != "" {
+			os.Remove(filepath.Join(s.dir, s.newest))
+		}
+		s.newest = name
+	}
+}
@@ -0,0 +1,63 @@
+package wal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/viperadnan-git/dbstash/internal/catalog"
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/engine"
+	"github.com/viperadnan-git/dbstash/internal/logger"
+	"github.com/viperadnan-git/dbstash/internal/manifest"
+	"github.com/viperadnan-git/dbstash/internal/pipeline"
+	"github.com/viperadnan-git/dbstash/internal/restore"
+)
+
+// BaseBackup returns the newest physical backup that had finished by
+// target, which is where recovery to target starts. A zero target picks
+// the newest physical backup.
+func BaseBackup(ctx context.Context, cfg *config.Config, eng engine.Engine, target time.Time) (*manifest.Manifest, error) {
+	entries, err := catalog.List(ctx, cfg, eng)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		m, err := manifest.Fetch(ctx, restore.RemotePath(cfg, entry.Name), pipeline.RcloneConfigArgs(cfg))
+		if err != nil {
+			logger.Log.Debug().Err(err).Str("backup", entry.Name).Msg("skipping backup without manifest")
+			continue
+		}
+		if m.Method != "physical" {
+			continue
+		}
+		// The backup is consistent only once it has finished
+		finished := m.StartedAt.Add(time.Duration(m.DurationSeconds * float64(time.Second)))
+		if target.IsZero() || !finished.After(target) {
+			return m, nil
+		}
+	}
+	if target.IsZero() {
+		return nil, fmt.Errorf("no physical backups found on %s", cfg.RcloneRemote)
+	}
+	return nil, fmt.Errorf("no physical backup on %s finished before %s", cfg.RcloneRemote, target.Format(time.RFC3339))
+}
+
+// RecoverySettings returns the postgresql.conf settings that replay the
+// archived WAL through restoreCommand, stopping at target and promoting.
+// A zero target replays all archived WAL.
+func RecoverySettings(restoreCommand string, target time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "restore_command = %s\n", confQuote(restoreCommand))
+	if !target.IsZero() {
+		fmt.Fprintf(&b, "recovery_target_time = %s\n", confQuote(target.Format("2006-01-02 15:04:05.999999-07:00")))
+		b.WriteString("recovery_target_action = 'promote'\n")
+	}
+	return b.String()
+}
+
+// confQuote quotes s as a postgresql.conf string value.
+func confQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,70 @@
+package wal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// segmentNameLen is the length of a WAL segment file name: timeline, log
+// and segment number as 8 hex digits each.
+const segmentNameLen = 24
+
+// DefaultSegmentSize is PostgreSQL's default wal_segment_size.
+const DefaultSegmentSize = 16 * 1024 * 1024
+
+// ParseLSN parses a log sequence number in PostgreSQL's "X/Y" notation.
+func ParseLSN(s string) (uint64, error) {
+	hi, lo, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, fmt.Errorf("invalid LSN %q", s)
+	}
+	h, err := strconv.ParseUint(hi, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LSN %q", s)
+	}
+	l, err := strconv.ParseUint(lo, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LSN %q", s)
+	}
+	return h<<32 | l, nil
+}
+
+// SegmentName returns the name of the WAL segment that holds lsn on
+// timeline tli, for segments of segSize bytes.
+func SegmentName(tli uint32, lsn uint64, segSize int64) string {
+	segNo := lsn / uint64(segSize)
+	perLogID := uint64(0x100000000) / uint64(segSize)
+	return fmt.Sprintf("%08X%08X%08X", tli, segNo/perLogID, segNo%perLogID)
+}
+
+// IsSegment reports whether name is a complete WAL segment file (not a
+// history, backup label, or partial file).
+func IsSegment(name string) bool {
+	return len(name) == segmentNameLen && isHex(name)
+}
+
+// segmentPrefix returns the segment a WAL-related file name refers to:
+// the segment itself, or the one a .backup label or .partial file is
+// named after. It reports false for timeline history files and anything
+// else.
+func segmentPrefix(name string) (string, bool) {
+	if len(name) < segmentNameLen || !isHex(name[:segmentNameLen]) {
+		return "", false
+	}
+	rest := name[segmentNameLen:]
+	if rest == "" || rest == ".partial" || strings.HasSuffix(rest, ".backup") {
+		return name[:segmentNameLen], true
+	}
+	return "", false
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
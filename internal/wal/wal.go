@@ -0,0 +1,32 @@
+// Package wal archives PostgreSQL write-ahead log segments under the wal/
+// prefix of RCLONE_REMOTE and fetches them back for point-in-time
+// recovery. Segments arrive either from archive_command (Push) or from a
+// long-running pg_receivewal (Receive).
+package wal
+
+import (
+	"context"
+
+	"github.com/viperadnan-git/dbstash/internal/archive"
+	"github.com/viperadnan-git/dbstash/internal/config"
+	"github.com/viperadnan-git/dbstash/internal/retention"
+)
+
+// RemoteDir returns the rclone path WAL files are archived to.
+func RemoteDir(cfg *config.Config) string {
+	return archive.RemoteDir(cfg, retention.WALDir)
+}
+
+// Push archives the WAL file at path. A file that is already archived
+// with the same content is accepted, so PostgreSQL can safely retry an
+// archive_command; different content under the same name is an error.
+func Push(ctx context.Context, cfg *config.Config, path string) error {
+	return archive.Push(ctx, cfg, retention.WALDir, path)
+}
+
+// Fetch copies the archived WAL file name to dest, as restore_command
+// expects. It fails if the file is not archived, which tells PostgreSQL
+// it has reached the end of the archive.
+func Fetch(ctx context.Context, cfg *config.Config, name, dest string) error {
+	return archive.Fetch(ctx, cfg, retention.WALDir, name, dest)
+}
@@ -0,0 +1,89 @@
+package wal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/viperadnan-git/dbstash/internal/retention"
+)
+
+func TestSegmentName(t *testing.T) {
+	tests := []struct {
+		lsn     string
+		tli     uint32
+		segSize int64
+		want    string
+	}{
+		{"0/2000028", 1, DefaultSegmentSize, "000000010000000000000002"},
+		{"0/FF000000", 1, DefaultSegmentSize, "0000000100000000000000FF"},
+		{"1/0", 1, DefaultSegmentSize, "000000010000000100000000"},
+		{"A/3C0001A8", 3, DefaultSegmentSize, "000000030000000A0000003C"},
+		{"A/3C0001A8", 3, 64 * 1024 * 1024, "000000030000000A0000000F"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.lsn, func(t *testing.T) {
+			lsn, err := ParseLSN(tt.lsn)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := SegmentName(tt.tli, lsn, tt.segSize); got != tt.want {
+				t.Errorf("SegmentName() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLSN_Invalid(t *testing.T) {
+	for _, s := range []string{"", "2000028", "0/xyz", "100000000/0"} {
+		if _, err := ParseLSN(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestSelectPrunable(t *testing.T) {
+	entries := []retention.RemoteEntry{
+		{Name: "000000010000000000000001", Path: "000000010000000000000001"},
+		{Name: "000000010000000000000002.00000028.backup", Path: "000000010000000000000002.00000028.backup"},
+		{Name: "000000010000000000000002", Path: "000000010000000000000002"},
+		{Name: "000000010000000000000003", Path: "000000010000000000000003"},
+		{Name: "00000002.history", Path: "00000002.history"},
+		{Name: "000000020000000000000003", Path: "000000020000000000000003"},
+	}
+
+	got := selectPrunable(entries, "000000010000000000000003")
+	var names []string
+	for _, e := range got {
+		names = append(names, e.Name)
+	}
+	want := "000000010000000000000001,000000010000000000000002.00000028.backup,000000010000000000000002"
+	if strings.Join(names, ",") != want {
+		t.Errorf("expected %s, got %v", want, names)
+	}
+
+	// A newer timeline drops the segments of the old one
+	if got := selectPrunable(entries, "000000020000000000000003"); len(got) != 4 {
+		t.Errorf("expected 4 prunable files, got %d", len(got))
+	}
+}
+
+func TestRecoverySettings(t *testing.T) {
+	target := time.Date(2026, 2, 7, 13, 30, 0, 0, time.UTC)
+	got := RecoverySettings("dbstash pg --rclone-remote 's3:my bucket' wal-fetch %f %p", target)
+
+	for _, want := range []string{
+		"restore_command = 'dbstash pg --rclone-remote ''s3:my bucket'' wal-fetch %f %p'\n",
+		"recovery_target_time = '2026-02-07 13:30:00+00:00'\n",
+		"recovery_target_action = 'promote'\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in:\n%s", want, got)
+		}
+	}
+
+	if strings.Contains(RecoverySettings("x", time.Time{}), "recovery_target") {
+		t.Error("expected no recovery target without a target time")
+	}
+}